@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"gw-broker/internal/config"
+	"gw-broker/internal/consumer"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const deadLettersUsage = "usage: app dlq list|requeue [limit]"
+
+// runDeadLetters handles the "dlq" subcommand.
+func runDeadLetters(ch *amqp.Channel, cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New(deadLettersUsage)
+	}
+	limit := 100
+	if len(args) > 1 {
+		var err error
+		limit, err = strconv.Atoi(args[1])
+		if err != nil || limit <= 0 {
+			return errors.New(deadLettersUsage)
+		}
+	}
+
+	switch args[0] {
+	case "list":
+		messages, err := consumer.ListDead(ch, cfg, limit)
+		if err != nil {
+			return err
+		}
+		for _, d := range messages {
+			fmt.Printf("%v\t%v\t%s\n", consumer.OriginalRoutingKey(d), d.Headers["x-death"], d.Body)
+		}
+		fmt.Printf("%v message(s) in %v\n", len(messages), consumer.DeadQueue(cfg))
+	case "requeue":
+		requeued, err := consumer.RequeueDead(ch, cfg, limit)
+		fmt.Printf("requeued %v message(s)\n", requeued)
+		return err
+	default:
+		return errors.New(deadLettersUsage)
+	}
+	return nil
+}
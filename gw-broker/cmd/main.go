@@ -2,21 +2,28 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
+	"gw-broker/internal/api"
 	"gw-broker/internal/config"
+	"gw-broker/internal/consumer"
 	"gw-broker/internal/logger"
-	"gw-broker/internal/repository"
-	"gw-broker/internal/repository/mongodb"
+	"gw-broker/internal/notify"
+	"gw-broker/internal/risk"
 
+	"github.com/lynxbites/wallet-services/gw-shared/rabbit"
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
+// connectTimeout bounds how long subcommands wait for RabbitMQ.
+const connectTimeout = 30 * time.Second
+
 func main() {
 
 	// init logger
@@ -32,99 +39,112 @@ func main() {
 		return
 	}
 
-	// init mongoDB
-	storage, err := mongodb.NewOperationStorage(cfg)
-	if err != nil {
-		logger.Error("Error connecting to MongoDB", "error", err.Error())
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(cfg, os.Args[2:]); err != nil {
+			logger.Error("migrate: " + err.Error())
+			os.Exit(1)
+		}
 		return
 	}
-	defer storage.Collection.Database().Client().Disconnect(context.Background())
+	if err := autoMigrate(cfg); err != nil {
+		logger.Error("migrate: " + err.Error())
+		os.Exit(1)
+	}
 
-	logger.Info("Successfully connected to MongoDB")
-	fmt.Printf("cfg.RabbitConfig.Address: %v\n", cfg.RabbitConfig)
-	conn, err := amqp.Dial(cfg.RabbitConfig.Address)
+	// init storage
+	storage, err := newStorage(cfg)
 	if err != nil {
-		logger.Error("main: couldn't connect to amqp")
-		panic(err)
+		logger.Error("Error opening storage", "type", cfg.StorageConfig.Type, "error", err.Error())
+		return
 	}
-	defer conn.Close()
+	defer storage.Close(context.Background())
 
-	ch, err := conn.Channel()
-	if err != nil {
-		logger.Error("main: couldn't open channel")
-		panic(err)
+	logger.Info("Successfully opened storage", "type", cfg.StorageConfig.Type)
+
+	if len(os.Args) > 1 && os.Args[1] == "rollups" {
+		if err := runRollups(storage, os.Args[2:]); err != nil {
+			logger.Error("rollups: " + err.Error())
+			os.Exit(1)
+		}
+		logger.Info("rollups: rebuilt")
+		return
 	}
-	defer ch.Close()
-
-	err = ch.ExchangeDeclare(
-		cfg.RabbitConfig.RabbitExchange, // name
-		"topic",                         // type
-		true,                            // durable
-		false,                           // auto-deleted
-		false,                           // internal
-		false,                           // no-wait
-		nil,                             // arguments
-	)
-	if err != nil {
-		logger.Error("main: failed to declare exchange")
-		panic(err)
+	if len(os.Args) > 1 && os.Args[1] == "users" {
+		if err := runUsers(storage, os.Args[2:]); err != nil {
+			logger.Error("users: " + err.Error())
+			os.Exit(1)
+		}
+		logger.Info("users: backfilled")
+		return
 	}
+	fmt.Printf("cfg.RabbitConfig.Address: %v\n", cfg.RabbitConfig)
+	client := rabbit.NewClient(cfg.RabbitConfig.Address, func(ch *amqp.Channel) error {
+		return consumer.DeclareTopology(ch, cfg)
+	}, logger)
+	defer client.Close()
 
-	q, err := ch.QueueDeclare(
-		cfg.RabbitConfig.RabbitQueue, // name
-		false,                        // durable
-		false,                        // delete when unused
-		false,                        // exclusive
-		false,                        // no-wait
-		nil,                          // arguments
-	)
-	if err != nil {
-		logger.Error("main: failed to declare queue")
-		panic(err)
+	if len(os.Args) > 1 && os.Args[1] == "dlq" {
+		ctx, cancel := context.WithTimeout(context.Background(), connectTimeout)
+		defer cancel()
+		ch, err := client.Channel(ctx)
+		if err != nil {
+			logger.Error("dlq: couldn't connect to amqp", "error", err.Error())
+			os.Exit(1)
+		}
+		if err := runDeadLetters(ch, cfg, os.Args[2:]); err != nil {
+			logger.Error("dlq: " + err.Error())
+			os.Exit(1)
+		}
+		return
 	}
 
-	err = ch.QueueBind(
-		q.Name,                         // queue name ("wallet_processor")
-		cfg.RabbitConfig.RabbitRouting, // routing key pattern (topic filter)
-		"wallet_events",                // exchange name (messages originate here)
-		false,                          // no-wait
-		nil,                            // arguments (optional)
-	)
-	if err != nil {
-		logger.Error("main: failed to bind queue")
-		panic(err)
-	}
+	operations := consumer.NewConsumer(client, storage, logger, cfg)
+	operations.EnableRisk(risk.NewDefaultEngine(storage, cfg), storage)
 
-	msgs, err := ch.Consume(
-		q.Name, // queue
-		"",     // consumer
-		true,   // auto-ack
-		false,  // exclusive
-		false,  // no-local
-		false,  // no-wait
-		nil,    // args
-	)
+	notifier, err := notify.NewNotifier(storage, cfg, logger)
 	if err != nil {
-		logger.Error("main: failed to register a consumer")
-		panic(err)
+		logger.Error("Error loading notification templates", "error", err.Error())
+		return
 	}
+	operations.EnableNotifications(notifier)
+	notifyCtx, stopNotifier := context.WithCancel(context.Background())
+	defer stopNotifier()
+	go notifier.Run(notifyCtx)
 
+	done := make(chan error, 1)
 	go func() {
-		for d := range msgs {
-			log.Printf("Received a message: %s", d.Body)
-			var data *repository.InsertStruct
-			json.Unmarshal(d.Body, &data)
-			fmt.Printf("data: %v\n", data)
-			err := storage.StoreOperation(data)
-			if err != nil {
-				logger.Error("message receive: couldn't insert data")
-			}
-		}
+		done <- operations.Run()
 	}()
 
+	// the query API is only served when there is someone allowed to use it
+	tokens := api.ParseTokens(cfg.ApiConfig.Tokens)
+	writeTokens := api.ParseTokens(cfg.ApiConfig.WriteTokens)
+	server := api.NewServer(storage, logger, tokens, writeTokens)
+	if len(tokens) > 0 || len(writeTokens) > 0 {
+		go func() {
+			if err := server.Start(cfg.ApiConfig.Address); err != nil && err != http.ErrServerClosed {
+				logger.Error("main: query api stopped", "error", err.Error())
+			}
+		}()
+	} else {
+		logger.Warn("main: API_TOKENS and API_WRITE_TOKENS are empty, query api disabled")
+	}
+
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 	log.Println("Waiting for messages. To exit press CTRL+C. Press CTRL+C to exit.")
-	<-sigChan
-	log.Println("Shutting down consumer")
+	select {
+	case <-sigChan:
+		operations.Stop()
+		<-done
+		stopNotifier()
+		stats := operations.Stats()
+		logger.Info("Shutting down consumer", "stored", stats.Stored, "duplicates", stats.Duplicates)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	case err := <-done:
+		logger.Error("main: consumer stopped", "error", err.Error())
+		os.Exit(1)
+	}
 }
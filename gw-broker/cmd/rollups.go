@@ -0,0 +1,18 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"gw-broker/internal/repository"
+)
+
+const rollupsUsage = "usage: app rollups rebuild"
+
+// runRollups handles the "rollups" subcommand.
+func runRollups(storage repository.RollupWriter, args []string) error {
+	if len(args) != 1 || args[0] != "rebuild" {
+		return errors.New(rollupsUsage)
+	}
+	return storage.RebuildRollups(context.Background())
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"gw-broker/internal/config"
+	"gw-broker/internal/repository"
+	"gw-broker/internal/repository/file"
+	"gw-broker/internal/repository/mongodb"
+	"gw-broker/internal/repository/postgres"
+	"gw-broker/internal/repository/postgres/migrations"
+
+	"github.com/lynxbites/wallet-services/gw-shared/migrate"
+)
+
+// newStorage opens the backend chosen with STORAGE_TYPE.
+func newStorage(cfg *config.Config) (repository.Repository, error) {
+	switch cfg.StorageConfig.Type {
+	case "mongodb":
+		return mongodb.NewOperationStorage(cfg)
+	case "postgres":
+		return postgres.NewOperationStorage(cfg.StorageConfig.PostgresAddress)
+	case "file":
+		return file.NewOperationStorage(cfg.StorageConfig.FileDir)
+	}
+	return nil, fmt.Errorf("unknown STORAGE_TYPE %q, expected mongodb, postgres or file", cfg.StorageConfig.Type)
+}
+
+// runMigrate handles the "migrate" subcommand, only the postgres backend
+// has migrations.
+func runMigrate(cfg *config.Config, args []string) error {
+	if cfg.StorageConfig.Type != "postgres" {
+		return errors.New("migrations only apply to STORAGE_TYPE=postgres")
+	}
+	return migrate.Command(migrations.Files, cfg.StorageConfig.PostgresAddress, args)
+}
+
+// autoMigrate applies pending postgres migrations when
+// STORAGE_POSTGRES_AUTO_MIGRATE is set.
+func autoMigrate(cfg *config.Config) error {
+	if cfg.StorageConfig.Type != "postgres" || !cfg.StorageConfig.PostgresAutoMigrate {
+		return nil
+	}
+	return migrate.Up(migrations.Files, cfg.StorageConfig.PostgresAddress)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"gw-broker/internal/repository"
+
+	"github.com/lynxbites/wallet-services/gw-shared/events"
+)
+
+const usersUsage = "usage: app users backfill <file>"
+
+// runUsers handles the "users" subcommand. "backfill" moves what was stored
+// under usernames, from version 2 events, to the ids in the file exported
+// with the wallet's "users export", then rebuilds the rollups.
+func runUsers(storage repository.Repository, args []string) error {
+	if len(args) != 2 || args[0] != "backfill" {
+		return errors.New(usersUsage)
+	}
+	f, err := os.Open(args[1])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	ids, err := events.ReadUserIdMappings(f)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	if err := storage.RenameUsers(ctx, ids); err != nil {
+		return err
+	}
+	return storage.RebuildRollups(ctx)
+}
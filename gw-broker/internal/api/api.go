@@ -0,0 +1,288 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"gw-broker/internal/repository"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+const (
+	defaultLimit = 50
+	maxLimit     = 500
+)
+
+// Storage is what the API reads operations and notification preferences
+// from. AddDelivery queues the code that verifies a new email.
+type Storage interface {
+	repository.OperationReader
+	repository.PreferenceStore
+	AddDelivery(ctx context.Context, delivery *repository.Delivery) error
+}
+
+type Handler struct {
+	storage Storage
+	logger  *slog.Logger
+}
+
+type Operation struct {
+	Id             string    `json:"id"`
+	User           string    `json:"user"`
+	OperationType  string    `json:"operation_type"`
+	Amount         float64   `json:"amount"`
+	Currency       string    `json:"currency,omitempty"`
+	TargetCurrency string    `json:"target_currency,omitempty"`
+	OccurredAt     time.Time `json:"occurred_at"`
+}
+
+type DailyTotal struct {
+	User          string  `json:"user"`
+	Day           string  `json:"day"`
+	OperationType string  `json:"operation_type"`
+	Total         float64 `json:"total"`
+	Count         int64   `json:"count"`
+}
+
+// NewServer builds the query API. Every route needs one of the tokens, sent
+// as "Authorization: Bearer <token>"; tokens and writeTokens map a token to
+// the name of its holder. Only writeTokens may change notification
+// preferences, the rest of the API is read-only.
+func NewServer(storage Storage, logger *slog.Logger, tokens map[string]string, writeTokens map[string]string) *echo.Echo {
+	handler := &Handler{storage: storage, logger: logger}
+
+	e := echo.New()
+	e.HideBanner = true
+	e.Use(middleware.LoggerWithConfig(middleware.LoggerConfig{
+		Format: "INFO ${method}:${uri} ${status} ${error} ${latency_human} \n",
+	}))
+	e.Use(middleware.KeyAuth(func(key string, ctx echo.Context) (bool, error) {
+		for token, name := range writeTokens {
+			if subtle.ConstantTimeCompare([]byte(token), []byte(key)) == 1 {
+				ctx.Set("api_user", name)
+				ctx.Set("api_write", true)
+				return true, nil
+			}
+		}
+		for token, name := range tokens {
+			if subtle.ConstantTimeCompare([]byte(token), []byte(key)) == 1 {
+				ctx.Set("api_user", name)
+				return true, nil
+			}
+		}
+		return false, nil
+	}))
+
+	e.GET("/api/v1/operations", handler.ListOperations)
+	e.GET("/api/v1/users/:user/operations", handler.ListOperations)
+	e.GET("/api/v1/operations/daily", handler.DailyTotals)
+	e.GET("/api/v1/users/:user/operations/daily", handler.DailyTotals)
+	e.GET("/api/v1/rollups", handler.ListRollups)
+	e.GET("/api/v1/users/:user/rollups", handler.ListRollups)
+	e.GET("/api/v1/users/:user/notifications", handler.GetPreferences)
+	e.PUT("/api/v1/users/:user/notifications", handler.PutPreferences, requireWrite)
+	e.POST("/api/v1/users/:user/notifications/email/verify", handler.VerifyEmail, requireWrite)
+	return e
+}
+
+// requireWrite lets through only clients holding a write token.
+func requireWrite(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		if write, _ := ctx.Get("api_write").(bool); !write {
+			return echo.NewHTTPError(http.StatusForbidden, echo.Map{"error": "this token is read-only"})
+		}
+		return next(ctx)
+	}
+}
+
+// ParseTokens reads a "name:token,name:token" list.
+func ParseTokens(list string) map[string]string {
+	tokens := make(map[string]string)
+	for _, entry := range strings.Split(list, ",") {
+		name, token, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok || name == "" || token == "" {
+			continue
+		}
+		tokens[token] = name
+	}
+	return tokens
+}
+
+func (handler *Handler) ListOperations(ctx echo.Context) error {
+	filter, err := parseFilter(ctx)
+	if err != nil {
+		return err
+	}
+	handler.logger.Info("new request: list operations", "api_user", ctx.Get("api_user"), "query", ctx.QueryString(), "user", filter.User)
+
+	stored, total, err := handler.storage.ListOperations(ctx.Request().Context(), filter)
+	if err != nil {
+		handler.logger.Error("internal server error: cannot list operations", "error", err.Error())
+		return echo.ErrInternalServerError
+	}
+	operations := make([]Operation, 0, len(stored))
+	for _, operation := range stored {
+		operations = append(operations, Operation{
+			Id:             operation.Id,
+			User:           operation.User,
+			OperationType:  operation.OperationType,
+			Amount:         operation.Amount,
+			Currency:       operation.Currency,
+			TargetCurrency: operation.TargetCurrency,
+			OccurredAt:     operation.OccurredAt,
+		})
+	}
+	return ctx.JSON(http.StatusOK, echo.Map{
+		"operations": operations,
+		"total":      total,
+		"limit":      filter.Limit,
+		"offset":     filter.Offset,
+	})
+}
+
+func (handler *Handler) DailyTotals(ctx echo.Context) error {
+	filter, err := parseFilter(ctx)
+	if err != nil {
+		return err
+	}
+	handler.logger.Info("new request: daily totals", "api_user", ctx.Get("api_user"), "query", ctx.QueryString(), "user", filter.User)
+
+	stored, err := handler.storage.DailyTotals(ctx.Request().Context(), filter)
+	if err != nil {
+		handler.logger.Error("internal server error: cannot aggregate operations", "error", err.Error())
+		return echo.ErrInternalServerError
+	}
+	totals := make([]DailyTotal, 0, len(stored))
+	for _, total := range stored {
+		totals = append(totals, DailyTotal(total))
+	}
+	return ctx.JSON(http.StatusOK, echo.Map{
+		"totals": totals,
+		"limit":  filter.Limit,
+		"offset": filter.Offset,
+	})
+}
+
+// ListRollups returns daily or monthly totals kept by the broker, selected
+// with period=day|month. from and to are cut to the period.
+func (handler *Handler) ListRollups(ctx echo.Context) error {
+	operationFilter, err := parseFilter(ctx)
+	if err != nil {
+		return err
+	}
+	period := ctx.QueryParam("period")
+	if period == "" {
+		period = repository.PeriodDay
+	}
+	if period != repository.PeriodDay && period != repository.PeriodMonth {
+		return badRequest("period must be day or month")
+	}
+
+	filter := &repository.RollupFilter{
+		Period:        period,
+		User:          operationFilter.User,
+		OperationType: operationFilter.OperationType,
+		Currency:      ctx.QueryParam("currency"),
+		Limit:         operationFilter.Limit,
+		Offset:        operationFilter.Offset,
+	}
+	if !operationFilter.From.IsZero() {
+		filter.From = repository.PeriodKey(period, operationFilter.From)
+	}
+	if !operationFilter.To.IsZero() {
+		filter.To = repository.PeriodKey(period, operationFilter.To)
+	}
+	handler.logger.Info("new request: list rollups", "api_user", ctx.Get("api_user"), "query", ctx.QueryString(), "user", filter.User)
+
+	rollups, err := handler.storage.ListRollups(ctx.Request().Context(), filter)
+	if err != nil {
+		handler.logger.Error("internal server error: cannot list rollups", "error", err.Error())
+		return echo.ErrInternalServerError
+	}
+	if rollups == nil {
+		rollups = []repository.Rollup{}
+	}
+	return ctx.JSON(http.StatusOK, echo.Map{
+		"rollups": rollups,
+		"limit":   filter.Limit,
+		"offset":  filter.Offset,
+	})
+}
+
+// parseFilter reads user, type, min_amount, max_amount, from, to, limit and
+// offset. Times are RFC 3339 or plain dates; to is exclusive.
+func parseFilter(ctx echo.Context) (*repository.OperationFilter, error) {
+	filter := &repository.OperationFilter{
+		User:          ctx.Param("user"),
+		OperationType: ctx.QueryParam("type"),
+		Limit:         defaultLimit,
+	}
+	if filter.User == "" {
+		filter.User = ctx.QueryParam("user")
+	}
+
+	var err error
+	if filter.MinAmount, err = parseAmount(ctx, "min_amount"); err != nil {
+		return nil, err
+	}
+	if filter.MaxAmount, err = parseAmount(ctx, "max_amount"); err != nil {
+		return nil, err
+	}
+	if filter.From, err = parseTime(ctx, "from"); err != nil {
+		return nil, err
+	}
+	if filter.To, err = parseTime(ctx, "to"); err != nil {
+		return nil, err
+	}
+
+	if value := ctx.QueryParam("limit"); value != "" {
+		filter.Limit, err = strconv.ParseInt(value, 10, 64)
+		if err != nil || filter.Limit <= 0 || filter.Limit > maxLimit {
+			return nil, badRequest("limit must be between 1 and " + strconv.Itoa(maxLimit))
+		}
+	}
+	if value := ctx.QueryParam("offset"); value != "" {
+		filter.Offset, err = strconv.ParseInt(value, 10, 64)
+		if err != nil || filter.Offset < 0 {
+			return nil, badRequest("offset must not be negative")
+		}
+	}
+	return filter, nil
+}
+
+func parseAmount(ctx echo.Context, name string) (*float64, error) {
+	value := ctx.QueryParam(name)
+	if value == "" {
+		return nil, nil
+	}
+	amount, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, badRequest(name + " must be a number")
+	}
+	return &amount, nil
+}
+
+func parseTime(ctx echo.Context, name string) (time.Time, error) {
+	value := ctx.QueryParam(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if parsed, err := time.Parse(time.RFC3339, value); err == nil {
+		return parsed, nil
+	}
+	if parsed, err := time.Parse(time.DateOnly, value); err == nil {
+		return parsed, nil
+	}
+	return time.Time{}, badRequest(name + " must be an RFC 3339 time or a date")
+}
+
+func badRequest(message string) error {
+	return echo.NewHTTPError(http.StatusBadRequest, echo.Map{"error": message})
+}
@@ -0,0 +1,194 @@
+package api_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gw-broker/internal/api"
+	"gw-broker/internal/repository"
+)
+
+type fakeReader struct {
+	filter       *repository.OperationFilter
+	rollupFilter *repository.RollupFilter
+	preferences  *repository.Preferences
+	deliveries   []*repository.Delivery
+}
+
+func (reader *fakeReader) ListOperations(ctx context.Context, filter *repository.OperationFilter) ([]repository.InsertStruct, int64, error) {
+	reader.filter = filter
+	return nil, 0, nil
+}
+
+func (reader *fakeReader) DailyTotals(ctx context.Context, filter *repository.OperationFilter) ([]repository.DailyTotal, error) {
+	reader.filter = filter
+	return nil, nil
+}
+
+func TestListOperations(t *testing.T) {
+	reader := &fakeReader{}
+	server := api.NewServer(reader, slog.New(slog.NewTextHandler(io.Discard, nil)), api.ParseTokens("compliance:secret"), nil)
+
+	tests := []struct {
+		name   string
+		token  string
+		target string
+		code   int
+	}{
+		{"no token", "", "/api/v1/operations", http.StatusBadRequest},
+		{"wrong token", "nope", "/api/v1/operations", http.StatusUnauthorized},
+		{"ok", "secret", "/api/v1/users/user/operations?type=deposit&min_amount=30000&from=2025-03-01&limit=10", http.StatusOK},
+		{"bad limit", "secret", "/api/v1/operations?limit=1000", http.StatusBadRequest},
+		{"bad time", "secret", "/api/v1/operations/daily?to=yesterday", http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, test.target, nil)
+			if test.token != "" {
+				req.Header.Set("Authorization", "Bearer "+test.token)
+			}
+			rec := httptest.NewRecorder()
+			server.ServeHTTP(rec, req)
+			if rec.Code != test.code {
+				t.Fatalf("expected %v, got %v\n", test.code, rec.Code)
+			}
+		})
+	}
+
+	filter := reader.filter
+	if filter.User != "user" || filter.OperationType != "deposit" || *filter.MinAmount != 30000 || filter.Limit != 10 || filter.From.IsZero() {
+		t.Fatalf("expected the query in the filter, got %+v\n", filter)
+	}
+}
+
+func (reader *fakeReader) ListRollups(ctx context.Context, filter *repository.RollupFilter) ([]repository.Rollup, error) {
+	reader.rollupFilter = filter
+	return nil, nil
+}
+
+func TestListRollups(t *testing.T) {
+	reader := &fakeReader{}
+	server := api.NewServer(reader, slog.New(slog.NewTextHandler(io.Discard, nil)), api.ParseTokens("compliance:secret"), nil)
+
+	for target, code := range map[string]int{
+		"/api/v1/rollups?period=week":                                          http.StatusBadRequest,
+		"/api/v1/users/user/rollups?period=month&from=2025-03-15&currency=USD": http.StatusOK,
+	} {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, req)
+		if rec.Code != code {
+			t.Fatalf("expected %v for %v, got %v\n", code, target, rec.Code)
+		}
+	}
+
+	filter := reader.rollupFilter
+	if filter.Period != "month" || filter.User != "user" || filter.From != "2025-03" || filter.Currency != "USD" {
+		t.Fatalf("expected the query in the filter, got %+v\n", filter)
+	}
+}
+
+func (reader *fakeReader) GetPreferences(ctx context.Context, user string) (*repository.Preferences, error) {
+	if reader.preferences == nil {
+		return nil, repository.ErrPreferencesNotFound
+	}
+	return reader.preferences, nil
+}
+
+func (reader *fakeReader) SavePreferences(ctx context.Context, preferences *repository.Preferences) error {
+	reader.preferences = preferences
+	return nil
+}
+
+func (reader *fakeReader) AddDelivery(ctx context.Context, delivery *repository.Delivery) error {
+	reader.deliveries = append(reader.deliveries, delivery)
+	return nil
+}
+
+func TestPreferences(t *testing.T) {
+	reader := &fakeReader{}
+	server := api.NewServer(reader, slog.New(slog.NewTextHandler(io.Discard, nil)), api.ParseTokens("compliance:secret"), api.ParseTokens("wallet:writer"))
+
+	tests := []struct {
+		name   string
+		method string
+		token  string
+		body   string
+		code   int
+	}{
+		{"not set", http.MethodGet, "secret", "", http.StatusNotFound},
+		{"read-only token", http.MethodPut, "secret", `{"channels": ["log"]}`, http.StatusForbidden},
+		{"unknown channel", http.MethodPut, "writer", `{"channels": ["sms"]}`, http.StatusBadRequest},
+		{"smtp without email", http.MethodPut, "writer", `{"channels": ["smtp"]}`, http.StatusBadRequest},
+		{"bad email", http.MethodPut, "writer", `{"channels": ["smtp"], "email": "Someone <a@example.com>"}`, http.StatusBadRequest},
+		{"bad webhook", http.MethodPut, "writer", `{"channels": ["webhook"], "webhook_url": "ftp://example.com"}`, http.StatusBadRequest},
+		{"loopback webhook", http.MethodPut, "writer", `{"channels": ["webhook"], "webhook_url": "http://127.0.0.1:8030/api/v1/operations"}`, http.StatusBadRequest},
+		{"private webhook", http.MethodPut, "writer", `{"channels": ["webhook"], "webhook_url": "http://10.0.0.5/hook"}`, http.StatusBadRequest},
+		{"negative amount", http.MethodPut, "writer", `{"channels": ["log"], "min_amount": -1}`, http.StatusBadRequest},
+		{"ok", http.MethodPut, "writer", `{"channels": ["smtp", "webhook"], "email": "a@example.com", "webhook_url": "https://203.0.113.10/hook", "types": ["withdraw"], "min_amount": 40000}`, http.StatusOK},
+		{"same email again", http.MethodPut, "writer", `{"channels": ["smtp"], "email": "a@example.com", "types": ["withdraw"], "min_amount": 40000}`, http.StatusOK},
+		{"saved", http.MethodGet, "secret", "", http.StatusOK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(test.method, "/api/v1/users/user/notifications", strings.NewReader(test.body))
+			req.Header.Set("Authorization", "Bearer "+test.token)
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			server.ServeHTTP(rec, req)
+			if rec.Code != test.code {
+				t.Fatalf("expected %v, got %v: %v\n", test.code, rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	// the email is not used until verified, and the code is mailed once
+	preferences := reader.preferences
+	if preferences.User != "user" || preferences.Email != "" || preferences.PendingEmail != "a@example.com" || preferences.MinAmount != 40000 || len(preferences.Types) != 1 {
+		t.Fatalf("expected the request to be saved with a pending email, got %+v\n", preferences)
+	}
+	if len(reader.deliveries) != 1 || reader.deliveries[0].Recipient != "a@example.com" || reader.deliveries[0].Channel != "smtp" {
+		t.Fatalf("expected one verification mail, got %v\n", reader.deliveries)
+	}
+}
+
+func TestVerifyEmail(t *testing.T) {
+	reader := &fakeReader{}
+	server := api.NewServer(reader, slog.New(slog.NewTextHandler(io.Discard, nil)), nil, api.ParseTokens("wallet:writer"))
+	send := func(method string, target string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer writer")
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := send(http.MethodPut, "/api/v1/users/user/notifications", `{"channels": ["smtp"], "email": "a@example.com"}`); rec.Code != http.StatusOK {
+		t.Fatalf("expected %v, got %v\n", http.StatusOK, rec.Code)
+	}
+	body := reader.deliveries[0].Body
+	code := strings.TrimSuffix(strings.Fields(strings.TrimPrefix(body, "Your confirmation code is "))[0], ".")
+
+	if rec := send(http.MethodPost, "/api/v1/users/user/notifications/email/verify", `{"code": "WRONGCODE"}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected %v, got %v\n", http.StatusBadRequest, rec.Code)
+	}
+	if rec := send(http.MethodPost, "/api/v1/users/user/notifications/email/verify", `{"code": "`+strings.ToLower(code)+`"}`); rec.Code != http.StatusOK {
+		t.Fatalf("expected %v, got %v: %v\n", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	if preferences := reader.preferences; preferences.Email != "a@example.com" || preferences.PendingEmail != "" || preferences.EmailCodeHash != "" {
+		t.Fatalf("expected a verified email, got %+v\n", preferences)
+	}
+	// the code is used up
+	if rec := send(http.MethodPost, "/api/v1/users/user/notifications/email/verify", `{"code": "`+code+`"}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected %v, got %v\n", http.StatusBadRequest, rec.Code)
+	}
+}
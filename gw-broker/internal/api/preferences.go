@@ -0,0 +1,236 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/mail"
+	"slices"
+	"strings"
+	"time"
+
+	"gw-broker/internal/notify"
+	"gw-broker/internal/repository"
+
+	"github.com/labstack/echo/v4"
+)
+
+type Preferences struct {
+	Email      string   `json:"email,omitempty"`
+	WebhookURL string   `json:"webhook_url,omitempty"`
+	Channels   []string `json:"channels"`
+	Types      []string `json:"types,omitempty"`
+	MinAmount  float64  `json:"min_amount"`
+}
+
+// PreferencesView is what the API returns: the saved preferences without the
+// verification code.
+type PreferencesView struct {
+	User         string    `json:"user"`
+	Email        string    `json:"email"`
+	PendingEmail string    `json:"pending_email,omitempty"`
+	WebhookURL   string    `json:"webhook_url"`
+	Channels     []string  `json:"channels"`
+	Types        []string  `json:"types"`
+	MinAmount    float64   `json:"min_amount"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// emailCodeTTL is how long the code sent to a new email is valid.
+const emailCodeTTL = 24 * time.Hour
+
+var (
+	knownChannels = []string{notify.ChannelLog, notify.ChannelSMTP, notify.ChannelWebhook}
+	knownTypes    = []string{"deposit", "withdraw", "exchange"}
+)
+
+func (handler *Handler) GetPreferences(ctx echo.Context) error {
+	user := ctx.Param("user")
+	handler.logger.Info("new request: get notification preferences", "api_user", ctx.Get("api_user"), "user", user)
+
+	preferences, err := handler.storage.GetPreferences(ctx.Request().Context(), user)
+	if errors.Is(err, repository.ErrPreferencesNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, echo.Map{"error": "no preferences for this user"})
+	}
+	if err != nil {
+		handler.logger.Error("internal server error: cannot get preferences", "error", err.Error())
+		return echo.ErrInternalServerError
+	}
+	return ctx.JSON(http.StatusOK, viewPreferences(preferences))
+}
+
+// PutPreferences replaces the user's notification preferences. smtp needs an
+// email; webhook falls back to NOTIFY_WEBHOOK_URL when webhook_url is empty.
+// A new email is not used until it is verified: it is kept as pending and a
+// code is mailed to it, which VerifyEmail takes.
+func (handler *Handler) PutPreferences(ctx echo.Context) error {
+	user := ctx.Param("user")
+	var request Preferences
+	if err := ctx.Bind(&request); err != nil {
+		return badRequest("invalid request body")
+	}
+	if err := validatePreferences(&request); err != nil {
+		return err
+	}
+	if request.WebhookURL != "" {
+		if err := notify.CheckWebhookURL(ctx.Request().Context(), request.WebhookURL); err != nil {
+			return badRequest(err.Error())
+		}
+	}
+	handler.logger.Info("new request: put notification preferences", "api_user", ctx.Get("api_user"), "user", user, "channels", request.Channels)
+
+	current, err := handler.storage.GetPreferences(ctx.Request().Context(), user)
+	if errors.Is(err, repository.ErrPreferencesNotFound) {
+		current = &repository.Preferences{User: user}
+	} else if err != nil {
+		handler.logger.Error("internal server error: cannot get preferences", "error", err.Error())
+		return echo.ErrInternalServerError
+	}
+
+	now := time.Now().UTC()
+	preferences := &repository.Preferences{
+		User:               user,
+		Email:              current.Email,
+		PendingEmail:       current.PendingEmail,
+		EmailCodeHash:      current.EmailCodeHash,
+		EmailCodeExpiresAt: current.EmailCodeExpiresAt,
+		WebhookURL:         request.WebhookURL,
+		Channels:           request.Channels,
+		Types:              request.Types,
+		MinAmount:          request.MinAmount,
+		UpdatedAt:          now,
+	}
+	switch {
+	case request.Email == "" || request.Email == current.Email:
+		preferences.Email = request.Email
+		preferences.PendingEmail, preferences.EmailCodeHash, preferences.EmailCodeExpiresAt = "", "", time.Time{}
+	case request.Email == current.PendingEmail && now.Before(current.EmailCodeExpiresAt):
+		// the code already sent is still good
+	default:
+		code, err := newEmailCode()
+		if err != nil {
+			handler.logger.Error("internal server error: cannot generate email code", "error", err.Error())
+			return echo.ErrInternalServerError
+		}
+		preferences.PendingEmail = request.Email
+		preferences.EmailCodeHash = hashEmailCode(code)
+		preferences.EmailCodeExpiresAt = now.Add(emailCodeTTL)
+		err = handler.storage.AddDelivery(ctx.Request().Context(), &repository.Delivery{
+			Id:            "verify:" + user + ":" + preferences.EmailCodeHash[:16],
+			User:          user,
+			Channel:       notify.ChannelSMTP,
+			Recipient:     request.Email,
+			Subject:       "Confirm your email",
+			Body:          "Your confirmation code is " + code + ". It expires in 24 hours.\n",
+			Status:        repository.DeliveryPending,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		})
+		if err != nil {
+			handler.logger.Error("internal server error: cannot queue email verification", "error", err.Error())
+			return echo.ErrInternalServerError
+		}
+	}
+
+	if err := handler.storage.SavePreferences(ctx.Request().Context(), preferences); err != nil {
+		handler.logger.Error("internal server error: cannot save preferences", "error", err.Error())
+		return echo.ErrInternalServerError
+	}
+	return ctx.JSON(http.StatusOK, viewPreferences(preferences))
+}
+
+// VerifyEmail confirms the pending email with the code that was mailed to
+// it, after which notifications are sent there.
+func (handler *Handler) VerifyEmail(ctx echo.Context) error {
+	user := ctx.Param("user")
+	var request struct {
+		Code string `json:"code"`
+	}
+	if err := ctx.Bind(&request); err != nil || request.Code == "" {
+		return badRequest("invalid request body")
+	}
+	handler.logger.Info("new request: verify notification email", "api_user", ctx.Get("api_user"), "user", user)
+
+	preferences, err := handler.storage.GetPreferences(ctx.Request().Context(), user)
+	if errors.Is(err, repository.ErrPreferencesNotFound) {
+		return badRequest("invalid or expired code")
+	}
+	if err != nil {
+		handler.logger.Error("internal server error: cannot get preferences", "error", err.Error())
+		return echo.ErrInternalServerError
+	}
+	hash := hashEmailCode(strings.ToUpper(strings.TrimSpace(request.Code)))
+	if preferences.PendingEmail == "" || !time.Now().Before(preferences.EmailCodeExpiresAt) ||
+		subtle.ConstantTimeCompare([]byte(hash), []byte(preferences.EmailCodeHash)) != 1 {
+		return badRequest("invalid or expired code")
+	}
+
+	preferences.Email = preferences.PendingEmail
+	preferences.PendingEmail, preferences.EmailCodeHash, preferences.EmailCodeExpiresAt = "", "", time.Time{}
+	preferences.UpdatedAt = time.Now().UTC()
+	if err := handler.storage.SavePreferences(ctx.Request().Context(), preferences); err != nil {
+		handler.logger.Error("internal server error: cannot save preferences", "error", err.Error())
+		return echo.ErrInternalServerError
+	}
+	return ctx.JSON(http.StatusOK, viewPreferences(preferences))
+}
+
+func viewPreferences(preferences *repository.Preferences) *PreferencesView {
+	return &PreferencesView{
+		User:         preferences.User,
+		Email:        preferences.Email,
+		PendingEmail: preferences.PendingEmail,
+		WebhookURL:   preferences.WebhookURL,
+		Channels:     preferences.Channels,
+		Types:        preferences.Types,
+		MinAmount:    preferences.MinAmount,
+		UpdatedAt:    preferences.UpdatedAt,
+	}
+}
+
+// newEmailCode returns 13 random base32 characters.
+func newEmailCode() (string, error) {
+	code := make([]byte, 8)
+	if _, err := rand.Read(code); err != nil {
+		return "", err
+	}
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(code), nil
+}
+
+func hashEmailCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+func validatePreferences(request *Preferences) error {
+	if request.Channels == nil {
+		request.Channels = []string{}
+	}
+	for _, channel := range request.Channels {
+		if !slices.Contains(knownChannels, channel) {
+			return badRequest("unknown channel " + channel)
+		}
+	}
+	for _, operationType := range request.Types {
+		if !slices.Contains(knownTypes, operationType) {
+			return badRequest("unknown operation type " + operationType)
+		}
+	}
+	if request.MinAmount < 0 {
+		return badRequest("min_amount must not be negative")
+	}
+	if request.Email != "" {
+		address, err := mail.ParseAddress(request.Email)
+		if err != nil || address.Address != request.Email {
+			return badRequest("invalid email")
+		}
+	} else if slices.Contains(request.Channels, notify.ChannelSMTP) {
+		return badRequest("smtp needs an email")
+	}
+	return nil
+}
@@ -1,20 +1,46 @@
 package config
 
 import (
+	"fmt"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	MongoConn    mongoConfig
-	RabbitConfig rabbitConfig
+	StorageConfig storageConfig
+	MongoConn     mongoConfig
+	RabbitConfig  rabbitConfig
+	ApiConfig     apiConfig
+	// ConsumerConfig sizes the worker pool that writes events to Mongo.
+	ConsumerConfig consumerConfig
+	RiskConfig     riskConfig
+	NotifyConfig   notifyConfig
+}
+
+// storageConfig picks the backend operations are stored in: mongodb,
+// postgres or file.
+type storageConfig struct {
+	Type            string
+	PostgresAddress string
+	// PostgresAutoMigrate applies pending postgres migrations on start.
+	PostgresAutoMigrate bool
+	FileDir             string
 }
 
 type mongoConfig struct {
 	Address      string
 	DBName       string
 	DBCollection string
+	// AlertsCollection holds the alerts raised by risk rules.
+	AlertsCollection string
+	// RollupsCollection holds the daily and monthly rollups.
+	RollupsCollection string
+	// PreferencesCollection and DeliveriesCollection back notifications.
+	PreferencesCollection string
+	DeliveriesCollection  string
 }
 
 type rabbitConfig struct {
@@ -22,6 +48,54 @@ type rabbitConfig struct {
 	RabbitExchange string
 	RabbitQueue    string
 	RabbitRouting  string
+	// RabbitSecurityQueue receives the wallet's security.* events, which
+	// are passed to the notifier.
+	RabbitSecurityQueue string
+	// RabbitDLX receives messages that could not be stored.
+	RabbitDLX        string
+	RabbitRetryDelay time.Duration
+	RabbitMaxRetries int
+	// RabbitPrefetch is the number of unacked messages the broker holds.
+	RabbitPrefetch int
+}
+
+type consumerConfig struct {
+	Workers     int
+	BatchSize   int
+	BatchWindow time.Duration
+}
+
+// riskConfig sets up the risk rules; a zero window disables a rule.
+type riskConfig struct {
+	WithdrawalCount       int
+	WithdrawalWindow      time.Duration
+	DepositWithdrawWindow time.Duration
+	CycleWindow           time.Duration
+}
+
+// notifyConfig sets up notification channels and retries. DefaultChannels
+// apply to users without preferences; smtp is only available with SMTPAddr.
+type notifyConfig struct {
+	DefaultChannels string
+	TemplatesDir    string
+	SMTPAddr        string
+	SMTPFrom        string
+	SMTPUsername    string
+	SMTPPassword    string
+	WebhookURL      string
+	WebhookSecret   string
+	MaxAttempts     int
+	RetryDelay      time.Duration
+	PollInterval    time.Duration
+}
+
+type apiConfig struct {
+	Address string
+	// Tokens is a "name:token,name:token" list of API clients.
+	Tokens string
+	// WriteTokens are the clients that may also change notification
+	// preferences.
+	WriteTokens string
 }
 
 func NewConfig() (*Config, error) {
@@ -32,18 +106,190 @@ func NewConfig() (*Config, error) {
 		return nil, err
 	}
 
+	securityQueue := os.Getenv("RMQ_SECURITY_QUEUE")
+	if securityQueue == "" {
+		securityQueue = os.Getenv("RMQ_QUEUE") + ".security"
+	}
+	dlx := os.Getenv("RMQ_DLX")
+	if dlx == "" {
+		dlx = os.Getenv("RMQ_EXCHANGE") + ".dlx"
+	}
+	retryDelay, err := getDuration("RMQ_RETRY_DELAY", 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	maxRetries, err := getInt("RMQ_MAX_RETRIES", 5)
+	if err != nil {
+		return nil, err
+	}
+	workers, err := getInt("CONSUMER_WORKERS", 4)
+	if err != nil {
+		return nil, err
+	}
+	batchSize, err := getInt("BATCH_SIZE", 50)
+	if err != nil {
+		return nil, err
+	}
+	batchWindow, err := getDuration("BATCH_WINDOW", time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if workers == 0 || batchSize == 0 {
+		return nil, fmt.Errorf("CONSUMER_WORKERS and BATCH_SIZE must be positive")
+	}
+	// enough for every worker to fill a batch
+	prefetch, err := getInt("RMQ_PREFETCH", workers*batchSize)
+	if err != nil {
+		return nil, err
+	}
+
+	withdrawalCount, err := getInt("RISK_WITHDRAWAL_COUNT", 3)
+	if err != nil {
+		return nil, err
+	}
+	withdrawalWindow, err := getDuration("RISK_WITHDRAWAL_WINDOW", time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	depositWithdrawWindow, err := getDuration("RISK_DEPOSIT_WITHDRAW_WINDOW", 15*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	cycleWindow, err := getDuration("RISK_CYCLE_WINDOW", time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	rollupsCollection := os.Getenv("DB_ROLLUPS_COLLECTION")
+	if rollupsCollection == "" {
+		rollupsCollection = "rollups"
+	}
+	preferencesCollection := os.Getenv("DB_PREFERENCES_COLLECTION")
+	if preferencesCollection == "" {
+		preferencesCollection = "preferences"
+	}
+	deliveriesCollection := os.Getenv("DB_DELIVERIES_COLLECTION")
+	if deliveriesCollection == "" {
+		deliveriesCollection = "deliveries"
+	}
+	alertsCollection := os.Getenv("DB_ALERTS_COLLECTION")
+	if alertsCollection == "" {
+		alertsCollection = "alerts"
+	}
+
+	defaultChannels, ok := os.LookupEnv("NOTIFY_DEFAULT_CHANNELS")
+	if !ok {
+		defaultChannels = "log"
+	}
+	maxAttempts, err := getInt("NOTIFY_MAX_ATTEMPTS", 5)
+	if err != nil {
+		return nil, err
+	}
+	notifyRetryDelay, err := getDuration("NOTIFY_RETRY_DELAY", 30*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	pollInterval, err := getDuration("NOTIFY_POLL_INTERVAL", 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	storageType := os.Getenv("STORAGE_TYPE")
+	if storageType == "" {
+		storageType = "mongodb"
+	}
+	fileDir := os.Getenv("STORAGE_FILE_DIR")
+	if fileDir == "" {
+		fileDir = "data"
+	}
+
+	apiAddress := os.Getenv("API_ADDR")
+	if apiAddress == "" {
+		apiAddress = ":8030"
+	}
+
 	storage := Config{
+		StorageConfig: storageConfig{
+			Type:                storageType,
+			PostgresAddress:     os.Getenv("STORAGE_POSTGRES_CONN"),
+			PostgresAutoMigrate: os.Getenv("STORAGE_POSTGRES_AUTO_MIGRATE") == "true",
+			FileDir:             fileDir,
+		},
 		MongoConn: mongoConfig{
-			Address:      os.Getenv("DB_CONN"),
-			DBName:       os.Getenv("DB_NAME"),
-			DBCollection: os.Getenv("DB_COLLECTION"),
+			Address:               os.Getenv("DB_CONN"),
+			DBName:                os.Getenv("DB_NAME"),
+			DBCollection:          os.Getenv("DB_COLLECTION"),
+			AlertsCollection:      alertsCollection,
+			RollupsCollection:     rollupsCollection,
+			PreferencesCollection: preferencesCollection,
+			DeliveriesCollection:  deliveriesCollection,
 		},
 		RabbitConfig: rabbitConfig{
-			Address:        os.Getenv("RMQ_CONN"),
-			RabbitExchange: os.Getenv("RMQ_EXCHANGE"),
-			RabbitQueue:    os.Getenv("RMQ_QUEUE"),
-			RabbitRouting:  os.Getenv("RMQ_ROUTINGKEY"),
+			Address:             os.Getenv("RMQ_CONN"),
+			RabbitExchange:      os.Getenv("RMQ_EXCHANGE"),
+			RabbitQueue:         os.Getenv("RMQ_QUEUE"),
+			RabbitRouting:       os.Getenv("RMQ_ROUTINGKEY"),
+			RabbitSecurityQueue: securityQueue,
+			RabbitDLX:           dlx,
+			RabbitRetryDelay:    retryDelay,
+			RabbitMaxRetries:    maxRetries,
+			RabbitPrefetch:      prefetch,
+		},
+		NotifyConfig: notifyConfig{
+			DefaultChannels: defaultChannels,
+			TemplatesDir:    os.Getenv("NOTIFY_TEMPLATES_DIR"),
+			SMTPAddr:        os.Getenv("SMTP_ADDR"),
+			SMTPFrom:        os.Getenv("SMTP_FROM"),
+			SMTPUsername:    os.Getenv("SMTP_USERNAME"),
+			SMTPPassword:    os.Getenv("SMTP_PASSWORD"),
+			WebhookURL:      os.Getenv("NOTIFY_WEBHOOK_URL"),
+			WebhookSecret:   os.Getenv("NOTIFY_WEBHOOK_SECRET"),
+			MaxAttempts:     maxAttempts,
+			RetryDelay:      notifyRetryDelay,
+			PollInterval:    pollInterval,
+		},
+		ApiConfig: apiConfig{
+			Address:     apiAddress,
+			Tokens:      os.Getenv("API_TOKENS"),
+			WriteTokens: os.Getenv("API_WRITE_TOKENS"),
+		},
+		ConsumerConfig: consumerConfig{
+			Workers:     workers,
+			BatchSize:   batchSize,
+			BatchWindow: batchWindow,
+		},
+		RiskConfig: riskConfig{
+			WithdrawalCount:       withdrawalCount,
+			WithdrawalWindow:      withdrawalWindow,
+			DepositWithdrawWindow: depositWithdrawWindow,
+			CycleWindow:           cycleWindow,
 		},
 	}
 	return &storage, nil
 }
+
+func getInt(name string, fallback int) (int, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback, nil
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", name, err)
+	}
+	if parsed < 0 {
+		return 0, fmt.Errorf("%s must not be negative", name)
+	}
+	return parsed, nil
+}
+
+func getDuration(name string, fallback time.Duration) (time.Duration, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback, nil
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", name, err)
+	}
+	return parsed, nil
+}
@@ -0,0 +1,506 @@
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gw-broker/internal/config"
+	"gw-broker/internal/notify"
+	"gw-broker/internal/repository"
+	"gw-broker/internal/risk"
+
+	"github.com/lynxbites/wallet-services/gw-shared/events"
+	"github.com/lynxbites/wallet-services/gw-shared/rabbit"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	retryCountHeader  = "x-retry-count"
+	routingKeyHeader  = "x-original-routing-key"
+	publishTimeout    = 5 * time.Second
+	deadQueueSuffix   = ".dead"
+	retryQueueSuffix  = ".retry"
+	deadLetterPattern = "#"
+	consumerTag       = "gw-broker"
+	securityTag       = "gw-broker-security"
+	alertRoutingKey   = "risk.alert."
+)
+
+// Storage writes a batch of operations and reports the outcome of each, and
+// keeps the rollups of the ones it stored.
+type Storage interface {
+	StoreOperations(data []*repository.InsertStruct) []error
+	UpdateRollups(ctx context.Context, operations []*repository.InsertStruct) error
+}
+
+type AlertStorage interface {
+	StoreAlert(ctx context.Context, alert *repository.Alert) error
+}
+
+// Consumer stores wallet events and acks them only once they are stored.
+// Workers collect events into batches that are written when they reach
+// BATCH_SIZE or every BATCH_WINDOW. Failed stores are retried through a
+// delay queue; messages that cannot be decoded or keep failing end up in the
+// dead letter queue. The consumer survives connection loss: it waits for
+// the client to reconnect and subscribes again.
+type Consumer struct {
+	client  *rabbit.Client
+	storage Storage
+	logger  *slog.Logger
+	cfg     *config.Config
+
+	risk     *risk.Engine
+	alerts   AlertStorage
+	notifier *notify.Notifier
+
+	stopCtx context.Context
+	stop    context.CancelFunc
+
+	stored     atomic.Int64
+	duplicates atomic.Int64
+}
+
+// Stats are counted since the consumer was created.
+type Stats struct {
+	Stored     int64
+	Duplicates int64
+}
+
+func NewConsumer(client *rabbit.Client, storage Storage, logger *slog.Logger, cfg *config.Config) *Consumer {
+	stopCtx, stop := context.WithCancel(context.Background())
+	return &Consumer{client: client, storage: storage, logger: logger, cfg: cfg, stopCtx: stopCtx, stop: stop}
+}
+
+// EnableRisk makes the consumer run every stored operation through the risk
+// engine, storing the alerts and publishing them to risk.alert.<rule>.
+func (consumer *Consumer) EnableRisk(engine *risk.Engine, alerts AlertStorage) {
+	consumer.risk = engine
+	consumer.alerts = alerts
+}
+
+// EnableNotifications makes the consumer queue notifications for every
+// stored operation.
+func (consumer *Consumer) EnableNotifications(notifier *notify.Notifier) {
+	consumer.notifier = notifier
+}
+
+// DeclareTopology declares the exchange, the durable work queue, its retry
+// queue and the dead letter exchange and queue.
+func DeclareTopology(ch *amqp.Channel, cfg *config.Config) error {
+	rabbit := cfg.RabbitConfig
+
+	err := ch.ExchangeDeclare(
+		rabbit.RabbitExchange, // name
+		"topic",               // type
+		true,                  // durable
+		false,                 // auto-deleted
+		false,                 // internal
+		false,                 // no-wait
+		nil,                   // arguments
+	)
+	if err != nil {
+		return fmt.Errorf("declare exchange: %w", err)
+	}
+
+	err = ch.ExchangeDeclare(rabbit.RabbitDLX, "topic", true, false, false, false, nil)
+	if err != nil {
+		return fmt.Errorf("declare dead letter exchange: %w", err)
+	}
+	_, err = ch.QueueDeclare(DeadQueue(cfg), true, false, false, false, nil)
+	if err != nil {
+		return fmt.Errorf("declare dead letter queue: %w", err)
+	}
+	err = ch.QueueBind(DeadQueue(cfg), deadLetterPattern, rabbit.RabbitDLX, false, nil)
+	if err != nil {
+		return fmt.Errorf("bind dead letter queue: %w", err)
+	}
+
+	_, err = ch.QueueDeclare(
+		rabbit.RabbitQueue, // name
+		true,               // durable
+		false,              // delete when unused
+		false,              // exclusive
+		false,              // no-wait
+		amqp.Table{"x-dead-letter-exchange": rabbit.RabbitDLX},
+	)
+	if err != nil {
+		return fmt.Errorf("declare queue: %w", err)
+	}
+
+	// expired retries are dead lettered back to the work queue through the
+	// default exchange
+	_, err = ch.QueueDeclare(retryQueue(cfg), true, false, false, false, amqp.Table{
+		"x-message-ttl":             rabbit.RabbitRetryDelay.Milliseconds(),
+		"x-dead-letter-exchange":    "",
+		"x-dead-letter-routing-key": rabbit.RabbitQueue,
+	})
+	if err != nil {
+		return fmt.Errorf("declare retry queue: %w", err)
+	}
+
+	err = ch.QueueBind(
+		rabbit.RabbitQueue,    // queue name
+		rabbit.RabbitRouting,  // routing key pattern (topic filter)
+		rabbit.RabbitExchange, // exchange name (messages originate here)
+		false,                 // no-wait
+		nil,                   // arguments (optional)
+	)
+	if err != nil {
+		return fmt.Errorf("bind queue: %w", err)
+	}
+	return declareSecurityQueue(ch, cfg)
+}
+
+func DeadQueue(cfg *config.Config) string {
+	return cfg.RabbitConfig.RabbitQueue + deadQueueSuffix
+}
+
+func retryQueue(cfg *config.Config) string {
+	return cfg.RabbitConfig.RabbitQueue + retryQueueSuffix
+}
+
+// pending is a decoded message waiting for its batch to be written.
+type pending struct {
+	delivery amqp.Delivery
+	data     *repository.InsertStruct
+}
+
+// Run consumes until Stop is called, resubscribing whenever the channel is
+// lost. It returns an error only if the client is closed.
+func (consumer *Consumer) Run() error {
+	for {
+		ch, err := consumer.client.Channel(consumer.stopCtx)
+		if consumer.stopCtx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := consumer.consume(ch); err != nil {
+			consumer.logger.Error("message receive: couldn't subscribe", "error", err.Error())
+			select {
+			case <-time.After(time.Second):
+			case <-consumer.stopCtx.Done():
+			}
+			continue
+		}
+		if consumer.stopCtx.Err() != nil {
+			return nil
+		}
+		consumer.logger.Warn("message receive: channel closed, waiting for reconnect")
+	}
+}
+
+// consume subscribes on ch and returns once its deliveries stop and every
+// worker has written what it holds.
+func (consumer *Consumer) consume(ch *amqp.Channel) error {
+	err := ch.Qos(consumer.cfg.RabbitConfig.RabbitPrefetch, 0, false)
+	if err != nil {
+		return fmt.Errorf("set prefetch: %w", err)
+	}
+
+	msgs, err := ch.Consume(
+		consumer.cfg.RabbitConfig.RabbitQueue, // queue
+		consumerTag,                           // consumer
+		false,                                 // auto-ack
+		false,                                 // exclusive
+		false,                                 // no-local
+		false,                                 // no-wait
+		nil,                                   // args
+	)
+	if err != nil {
+		return fmt.Errorf("register consumer: %w", err)
+	}
+
+	// security events only go to the notifier
+	var security <-chan amqp.Delivery
+	if consumer.notifier != nil {
+		security, err = ch.Consume(consumer.cfg.RabbitConfig.RabbitSecurityQueue, securityTag, false, false, false, false, nil)
+		if err != nil {
+			return fmt.Errorf("register security consumer: %w", err)
+		}
+	}
+
+	// Stop may have come in before the subscription existed
+	closed := ch.NotifyClose(make(chan *amqp.Error, 1))
+	go func() {
+		select {
+		case <-consumer.stopCtx.Done():
+			ch.Cancel(consumerTag, false)
+			ch.Cancel(securityTag, false)
+		case <-closed:
+		}
+	}()
+
+	var wg sync.WaitGroup
+	if security != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			consumer.notifySecurity(security)
+		}()
+	}
+	for range consumer.cfg.ConsumerConfig.Workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			consumer.work(msgs)
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+// Stop stops deliveries; Run returns once the batches in flight are written.
+func (consumer *Consumer) Stop() {
+	consumer.stop()
+}
+
+func (consumer *Consumer) Stats() Stats {
+	return Stats{Stored: consumer.stored.Load(), Duplicates: consumer.duplicates.Load()}
+}
+
+func (consumer *Consumer) work(msgs <-chan amqp.Delivery) {
+	size := consumer.cfg.ConsumerConfig.BatchSize
+	batch := make([]pending, 0, size)
+	ticker := time.NewTicker(consumer.cfg.ConsumerConfig.BatchWindow)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case d, ok := <-msgs:
+			if !ok {
+				consumer.flush(batch)
+				return
+			}
+			if data := consumer.decode(d); data != nil {
+				batch = append(batch, pending{delivery: d, data: data})
+			}
+			if len(batch) >= size {
+				consumer.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			consumer.flush(batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+// decode returns the operation in the message, or dead letters the message
+// and returns nil.
+func (consumer *Consumer) decode(d amqp.Delivery) *repository.InsertStruct {
+	consumer.logger.Info("message receive: received a message", "body", string(d.Body))
+
+	// unknown versions and invalid events will not get better on retry
+	event, err := events.Decode(d.Body)
+	if err != nil {
+		consumer.logger.Error("message receive: rejected message, dead lettering", "error", err.Error(), "body", string(d.Body))
+		consumer.nack(d)
+		return nil
+	}
+
+	return &repository.InsertStruct{
+		Id:             event.Id,
+		SchemaVersion:  event.SchemaVersion,
+		User:           event.UserId,
+		OperationType:  string(event.Type),
+		Amount:         event.Amount,
+		Currency:       event.Currency,
+		TargetCurrency: event.TargetCurrency,
+		OccurredAt:     event.OccurredAt,
+	}
+}
+
+// flush writes the batch and settles every message in it by its own result,
+// so a partially failed write only retries the documents that failed.
+func (consumer *Consumer) flush(batch []pending) {
+	if len(batch) == 0 {
+		return
+	}
+	data := make([]*repository.InsertStruct, len(batch))
+	for i, p := range batch {
+		data[i] = p.data
+	}
+	results := consumer.storage.StoreOperations(data)
+	rollupErr := consumer.updateRollups(data, results)
+
+	for i, p := range batch {
+		err := results[i]
+		if err != nil && !errors.Is(err, repository.ErrDuplicateOperation) {
+			consumer.logger.Error("message receive: couldn't insert data", "id", p.data.Id, "error", err.Error())
+			consumer.retry(p.delivery)
+			continue
+		}
+		if rollupErr != nil {
+			// stored, but retried until the rollups count it too
+			consumer.retry(p.delivery)
+			continue
+		}
+		if err != nil {
+			consumer.duplicates.Add(1)
+			consumer.logger.Info("message receive: duplicate delivery, already stored", "id", p.data.Id)
+		} else {
+			consumer.stored.Add(1)
+		}
+		consumer.assess(p.data)
+		consumer.notify(p.data)
+		if err := p.delivery.Ack(false); err != nil {
+			consumer.logger.Error("message receive: couldn't ack", "id", p.data.Id, "error", err.Error())
+		}
+	}
+}
+
+// updateRollups adds the operations that are stored, now or before, to the
+// rollups. The storage skips operations it has already counted, so
+// duplicates are passed too: their earlier delivery may have been stored
+// without its rollups.
+func (consumer *Consumer) updateRollups(data []*repository.InsertStruct, results []error) error {
+	var stored []*repository.InsertStruct
+	for i, operation := range data {
+		if results[i] == nil || errors.Is(results[i], repository.ErrDuplicateOperation) {
+			stored = append(stored, operation)
+		}
+	}
+	if len(stored) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+	if err := consumer.storage.UpdateRollups(ctx, stored); err != nil {
+		consumer.logger.Error("rollups: couldn't update, retrying", "operations", len(stored), "error", err.Error())
+		return err
+	}
+	return nil
+}
+
+// assess raises the alerts for a stored operation. Duplicates are assessed
+// too, in case an earlier delivery was stored but never acked; alerts that
+// already exist are not published again. Failures are logged and do not
+// hold up the operation.
+func (consumer *Consumer) assess(data *repository.InsertStruct) {
+	if consumer.risk == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+
+	alerts, err := consumer.risk.Evaluate(ctx, data)
+	if err != nil {
+		consumer.logger.Error("risk: couldn't evaluate operation", "id", data.Id, "error", err.Error())
+		return
+	}
+	for _, alert := range alerts {
+		err := consumer.alerts.StoreAlert(ctx, alert)
+		if errors.Is(err, repository.ErrDuplicateAlert) {
+			continue
+		}
+		if err != nil {
+			consumer.logger.Error("risk: couldn't store alert", "id", alert.Id, "error", err.Error())
+			continue
+		}
+		consumer.logger.Warn("risk: alert raised", "rule", alert.Rule, "user", alert.User, "id", data.Id, "reason", alert.Reason)
+
+		body, err := json.Marshal(alert)
+		if err != nil {
+			consumer.logger.Error("risk: couldn't encode alert", "id", alert.Id, "error", err.Error())
+			continue
+		}
+		err = consumer.client.Publish(ctx, consumer.cfg.RabbitConfig.RabbitExchange, alertRoutingKey+alert.Rule, amqp.Publishing{
+			ContentType:  "application/json",
+			DeliveryMode: amqp.Persistent,
+			MessageId:    alert.Id,
+			Body:         body,
+		})
+		if err != nil {
+			consumer.logger.Error("risk: couldn't publish alert", "id", alert.Id, "error", err.Error())
+		}
+	}
+}
+
+// notify queues the notifications for a stored operation. Like assess it
+// runs for duplicates too; deliveries that are already queued are skipped.
+func (consumer *Consumer) notify(data *repository.InsertStruct) {
+	if consumer.notifier == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+	if err := consumer.notifier.Notify(ctx, data); err != nil {
+		consumer.logger.Error("notify: couldn't queue notifications", "id", data.Id, "error", err.Error())
+	}
+}
+
+// retry sends a copy of the message through the retry queue, or dead
+// letters it once RMQ_MAX_RETRIES is used up. The original is acked only
+// once the server has confirmed the copy; if the copy can't be published
+// the original is dead lettered rather than requeued, so a broken retry
+// queue doesn't spin the message around.
+func (consumer *Consumer) retry(d amqp.Delivery) {
+	attempt := retryCount(d.Headers)
+	if attempt >= consumer.cfg.RabbitConfig.RabbitMaxRetries {
+		consumer.logger.Error("message receive: retries exhausted, dead lettering", "attempts", attempt)
+		consumer.nack(d)
+		return
+	}
+
+	headers := amqp.Table{}
+	for key, value := range d.Headers {
+		headers[key] = value
+	}
+	headers[retryCountHeader] = int32(attempt + 1)
+	headers[routingKeyHeader] = OriginalRoutingKey(d)
+
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+	err := consumer.client.PublishConfirmed(ctx, "", retryQueue(consumer.cfg), amqp.Publishing{
+		ContentType:  d.ContentType,
+		DeliveryMode: amqp.Persistent,
+		MessageId:    d.MessageId,
+		Headers:      headers,
+		Body:         d.Body,
+	})
+	if err != nil {
+		consumer.logger.Error("message receive: couldn't schedule retry, dead lettering", "error", err.Error())
+		consumer.nack(d)
+		return
+	}
+	if err := d.Ack(false); err != nil {
+		consumer.logger.Error("message receive: couldn't ack", "error", err.Error())
+	}
+}
+
+func (consumer *Consumer) nack(d amqp.Delivery) {
+	if err := d.Nack(false, false); err != nil {
+		consumer.logger.Error("message receive: couldn't nack", "error", err.Error())
+	}
+}
+
+func retryCount(headers amqp.Table) int {
+	switch count := headers[retryCountHeader].(type) {
+	case int32:
+		return int(count)
+	case int64:
+		return int(count)
+	case int:
+		return count
+	}
+	return 0
+}
+
+// OriginalRoutingKey is the key the wallet published the message with;
+// retried messages carry it in a header because the retry queue routes them
+// back by queue name.
+func OriginalRoutingKey(d amqp.Delivery) string {
+	if key, ok := d.Headers[routingKeyHeader].(string); ok {
+		return key
+	}
+	return d.RoutingKey
+}
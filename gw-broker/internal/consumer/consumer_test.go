@@ -0,0 +1,221 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"gw-broker/internal/config"
+	"gw-broker/internal/notify"
+	"gw-broker/internal/repository"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+type fakeAcknowledger struct {
+	acked  int
+	nacked int
+}
+
+func (ack *fakeAcknowledger) Ack(tag uint64, multiple bool) error {
+	ack.acked++
+	return nil
+}
+
+func (ack *fakeAcknowledger) Nack(tag uint64, multiple bool, requeue bool) error {
+	ack.nacked++
+	return nil
+}
+
+func (ack *fakeAcknowledger) Reject(tag uint64, requeue bool) error {
+	ack.nacked++
+	return nil
+}
+
+// fakeStorage fails every operation whose id is "bad", and every rollup
+// update while failRollups is set.
+type fakeStorage struct {
+	stored      map[string]bool
+	batches     int
+	rolled      map[string]bool
+	failRollups bool
+}
+
+func (storage *fakeStorage) UpdateRollups(ctx context.Context, operations []*repository.InsertStruct) error {
+	if storage.failRollups {
+		return errors.New("rollups failed")
+	}
+	for _, operation := range operations {
+		storage.rolled[operation.Id] = true
+	}
+	return nil
+}
+
+func (storage *fakeStorage) StoreOperations(data []*repository.InsertStruct) []error {
+	storage.batches++
+	results := make([]error, len(data))
+	for i, operation := range data {
+		switch {
+		case operation.Id == "bad":
+			results[i] = errors.New("write failed")
+		case storage.stored[operation.Id]:
+			results[i] = repository.ErrDuplicateOperation
+		default:
+			storage.stored[operation.Id] = true
+		}
+	}
+	return results
+}
+
+func newTestConsumer(storage Storage, batchSize int) *Consumer {
+	cfg := &config.Config{}
+	cfg.ConsumerConfig.BatchSize = batchSize
+	cfg.ConsumerConfig.BatchWindow = time.Hour
+	return NewConsumer(nil, storage, slog.New(slog.NewTextHandler(io.Discard, nil)), cfg)
+}
+
+// consume runs one worker over the bodies until they are all settled.
+func consume(consumer *Consumer, ack *fakeAcknowledger, bodies ...string) {
+	msgs := make(chan amqp.Delivery, len(bodies))
+	for _, body := range bodies {
+		msgs <- amqp.Delivery{Acknowledger: ack, Body: []byte(body)}
+	}
+	close(msgs)
+	consumer.work(msgs)
+}
+
+// operation is the body of a current version event.
+func operation(id string, operationType string) string {
+	return fmt.Sprintf(`{"schema_version":3,"id":%q,"type":%q,"user_id":"0b7c6e0e-1","amount":50000,"currency":"USD","occurred_at":"2025-03-01T12:00:00Z"}`, id, operationType)
+}
+
+func TestHandleDuplicates(t *testing.T) {
+	consumer := newTestConsumer(&fakeStorage{stored: map[string]bool{}, rolled: map[string]bool{}}, 1)
+	ack := &fakeAcknowledger{}
+
+	body := operation("1", "deposit")
+	consume(consumer, ack, body, body, "not json", `{"schema_version":99,"id":"2"}`)
+
+	if ack.acked != 2 || ack.nacked != 2 {
+		t.Fatalf("expected 2 acks and 2 nacks, got %v and %v\n", ack.acked, ack.nacked)
+	}
+	if stats := consumer.Stats(); stats.Stored != 1 || stats.Duplicates != 1 {
+		t.Fatalf("expected 1 stored and 1 duplicate, got %+v\n", stats)
+	}
+}
+
+func TestBatchPartialFailure(t *testing.T) {
+	storage := &fakeStorage{stored: map[string]bool{"2": true}, rolled: map[string]bool{}}
+	consumer := newTestConsumer(storage, 3)
+	ack := &fakeAcknowledger{}
+
+	// with no retries left the failed message is dead lettered
+	consume(consumer, ack,
+		operation("1", "deposit"),
+		operation("bad", "deposit"),
+		operation("2", "deposit"),
+		operation("3", "withdraw"),
+	)
+
+	if storage.batches != 2 {
+		t.Fatalf("expected 2 batches, got %v\n", storage.batches)
+	}
+	if ack.acked != 3 || ack.nacked != 1 {
+		t.Fatalf("expected 3 acks and 1 nack, got %v and %v\n", ack.acked, ack.nacked)
+	}
+	if stats := consumer.Stats(); stats.Stored != 2 || stats.Duplicates != 1 {
+		t.Fatalf("expected 2 stored and 1 duplicate, got %+v\n", stats)
+	}
+	// the duplicate is passed too, the storage skips it if already counted
+	if len(storage.rolled) != 3 {
+		t.Fatalf("expected 3 operations rolled up, got %v\n", storage.rolled)
+	}
+}
+
+func TestRollupFailureRetries(t *testing.T) {
+	storage := &fakeStorage{stored: map[string]bool{}, rolled: map[string]bool{}, failRollups: true}
+	consumer := newTestConsumer(storage, 1)
+	ack := &fakeAcknowledger{}
+
+	// with no retries left the message is dead lettered instead of acked
+	body := operation("1", "deposit")
+	consume(consumer, ack, body)
+	if ack.acked != 0 || ack.nacked != 1 {
+		t.Fatalf("expected 0 acks and 1 nack, got %v and %v\n", ack.acked, ack.nacked)
+	}
+
+	// the redelivery is a duplicate and is rolled up now
+	storage.failRollups = false
+	consume(consumer, ack, body)
+	if ack.acked != 1 || !storage.rolled["1"] {
+		t.Fatalf("expected the redelivery to be acked and rolled up, got %v acks, %v\n", ack.acked, storage.rolled)
+	}
+}
+
+// fakeNotificationStore keeps the queued deliveries; nobody has
+// preferences, so the default channels are used.
+type fakeNotificationStore struct {
+	deliveries map[string]*repository.Delivery
+}
+
+func (store *fakeNotificationStore) GetPreferences(ctx context.Context, user string) (*repository.Preferences, error) {
+	return nil, repository.ErrPreferencesNotFound
+}
+
+func (store *fakeNotificationStore) SavePreferences(ctx context.Context, preferences *repository.Preferences) error {
+	return nil
+}
+
+func (store *fakeNotificationStore) AddDelivery(ctx context.Context, delivery *repository.Delivery) error {
+	if _, ok := store.deliveries[delivery.Id]; ok {
+		return repository.ErrDuplicateDelivery
+	}
+	store.deliveries[delivery.Id] = delivery
+	return nil
+}
+
+func (store *fakeNotificationStore) UpdateDelivery(ctx context.Context, delivery *repository.Delivery) error {
+	return nil
+}
+
+func (store *fakeNotificationStore) DueDeliveries(ctx context.Context, now time.Time, limit int64) ([]repository.Delivery, error) {
+	return nil, nil
+}
+
+func TestSecurityEvents(t *testing.T) {
+	consumer := newTestConsumer(&fakeStorage{stored: map[string]bool{}, rolled: map[string]bool{}}, 1)
+	store := &fakeNotificationStore{deliveries: map[string]*repository.Delivery{}}
+	templates, err := notify.LoadTemplates("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	consumer.EnableNotifications(notify.NewNotifierWithChannels(store, map[string]notify.Channel{notify.ChannelLog: &notify.LogChannel{Logger: logger}}, templates, logger, &notify.Options{
+		DefaultChannels: []string{notify.ChannelLog},
+	}))
+	ack := &fakeAcknowledger{}
+
+	bodies := []string{
+		`{"schema_version":3,"id":"1","type":"new_device","user_id":"0b7c6e0e-1","ip":"203.0.113.7","details":{"user_agent":"curl/8.0"},"occurred_at":"2025-03-01T12:00:00Z"}`,
+		`{"schema_version":3,"id":"2","type":"login_locked","ip":"203.0.113.7","details":{"scope":"ip"},"occurred_at":"2025-03-01T12:00:00Z"}`,
+		`{"schema_version":3,"id":"3","type":"new_device","occurred_at":"2025-03-01T12:00:00Z"}`,
+		"not json",
+	}
+	msgs := make(chan amqp.Delivery, len(bodies))
+	for _, body := range bodies {
+		msgs <- amqp.Delivery{Acknowledger: ack, Body: []byte(body)}
+	}
+	close(msgs)
+	consumer.notifySecurity(msgs)
+
+	if ack.acked != 2 || ack.nacked != 2 {
+		t.Fatalf("expected 2 acks and 2 nacks, got %v and %v\n", ack.acked, ack.nacked)
+	}
+	if len(store.deliveries) != 1 || store.deliveries["1:log"] == nil || store.deliveries["1:log"].User != "0b7c6e0e-1" {
+		t.Fatalf("expected delivery 1:log to the user, got %v\n", store.deliveries)
+	}
+}
@@ -0,0 +1,71 @@
+package consumer
+
+import (
+	"context"
+
+	"gw-broker/internal/config"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// ListDead returns up to limit messages from the dead letter queue and
+// leaves them in the queue.
+func ListDead(ch *amqp.Channel, cfg *config.Config, limit int) ([]amqp.Delivery, error) {
+	var messages []amqp.Delivery
+	for len(messages) < limit {
+		d, ok, err := ch.Get(DeadQueue(cfg), false)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		messages = append(messages, d)
+	}
+	if len(messages) > 0 {
+		if err := messages[len(messages)-1].Nack(true, true); err != nil {
+			return nil, err
+		}
+	}
+	return messages, nil
+}
+
+// RequeueDead publishes up to limit dead letters back to the wallet
+// exchange under their original routing key, with a fresh retry budget.
+func RequeueDead(ch *amqp.Channel, cfg *config.Config, limit int) (int, error) {
+	requeued := 0
+	for requeued < limit {
+		d, ok, err := ch.Get(DeadQueue(cfg), false)
+		if err != nil {
+			return requeued, err
+		}
+		if !ok {
+			break
+		}
+
+		headers := amqp.Table{}
+		for key, value := range d.Headers {
+			if key != retryCountHeader && key != routingKeyHeader && key != "x-death" {
+				headers[key] = value
+			}
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+		err = ch.PublishWithContext(ctx, cfg.RabbitConfig.RabbitExchange, OriginalRoutingKey(d), false, false, amqp.Publishing{
+			ContentType:  d.ContentType,
+			DeliveryMode: amqp.Persistent,
+			MessageId:    d.MessageId,
+			Headers:      headers,
+			Body:         d.Body,
+		})
+		cancel()
+		if err != nil {
+			d.Nack(false, true)
+			return requeued, err
+		}
+		if err := d.Ack(false); err != nil {
+			return requeued, err
+		}
+		requeued++
+	}
+	return requeued, nil
+}
@@ -0,0 +1,58 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+
+	"gw-broker/internal/config"
+
+	"github.com/lynxbites/wallet-services/gw-shared/events"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// securityPattern matches the routing keys of the wallet's security events.
+const securityPattern = "security.*"
+
+// declareSecurityQueue declares the durable queue security events are
+// routed to. Like the work queue it dead letters to RMQ_DLX.
+func declareSecurityQueue(ch *amqp.Channel, cfg *config.Config) error {
+	rabbit := cfg.RabbitConfig
+	_, err := ch.QueueDeclare(rabbit.RabbitSecurityQueue, true, false, false, false, amqp.Table{
+		"x-dead-letter-exchange": rabbit.RabbitDLX,
+	})
+	if err != nil {
+		return fmt.Errorf("declare security queue: %w", err)
+	}
+	err = ch.QueueBind(rabbit.RabbitSecurityQueue, securityPattern, rabbit.RabbitExchange, false, nil)
+	if err != nil {
+		return fmt.Errorf("bind security queue: %w", err)
+	}
+	return nil
+}
+
+// notifySecurity passes security events to the notifier until deliveries
+// stop. An event is acked once its notices are queued; one that cannot be
+// decoded or queued is dead lettered, and "dlq requeue" routes it back here.
+func (consumer *Consumer) notifySecurity(msgs <-chan amqp.Delivery) {
+	for d := range msgs {
+		event, err := events.DecodeSecurity(d.Body)
+		if err != nil {
+			consumer.logger.Error("security: rejected message, dead lettering", "error", err.Error(), "body", string(d.Body))
+			consumer.nack(d)
+			continue
+		}
+		consumer.logger.Warn("security: event received", "type", event.Type, "user", event.UserId, "ip", event.IP, "id", event.Id)
+
+		ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+		err = consumer.notifier.NotifySecurity(ctx, event)
+		cancel()
+		if err != nil {
+			consumer.logger.Error("security: couldn't queue notifications, dead lettering", "id", event.Id, "error", err.Error())
+			consumer.nack(d)
+			continue
+		}
+		if err := d.Ack(false); err != nil {
+			consumer.logger.Error("security: couldn't ack", "id", event.Id, "error", err.Error())
+		}
+	}
+}
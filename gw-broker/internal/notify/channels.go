@@ -0,0 +1,173 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+
+	"gw-broker/internal/repository"
+)
+
+const (
+	ChannelLog     = "log"
+	ChannelSMTP    = "smtp"
+	ChannelWebhook = "webhook"
+
+	webhookTimeout = 10 * time.Second
+	// SignatureHeader carries the hex HMAC-SHA256 of the webhook body.
+	SignatureHeader = "X-Signature-SHA256"
+)
+
+// Channel sends one delivery to its recipient.
+type Channel interface {
+	Send(ctx context.Context, delivery *repository.Delivery) error
+}
+
+// LogChannel writes notifications to the log, for development and as a
+// fallback that always works.
+type LogChannel struct {
+	Logger *slog.Logger
+}
+
+func (channel *LogChannel) Send(ctx context.Context, delivery *repository.Delivery) error {
+	channel.Logger.Info("notify: notification", "user", delivery.User, "event_id", delivery.EventId, "subject", delivery.Subject)
+	return nil
+}
+
+// ErrPrivateAddress means a webhook URL points at the service's own network.
+var ErrPrivateAddress = errors.New("webhook address is not public")
+
+// WebhookChannel posts the notification as JSON to the recipient URL and
+// expects a 2xx. With a Secret the body is signed in SignatureHeader.
+// Users choose their own URLs, so unless Client is set they are only
+// connected to on public addresses; TrustedURL, the operator's
+// NOTIFY_WEBHOOK_URL, may be internal.
+type WebhookChannel struct {
+	Secret     string
+	TrustedURL string
+	Client     *http.Client
+}
+
+type webhookPayload struct {
+	Id      string `json:"id"`
+	EventId string `json:"event_id"`
+	User    string `json:"user"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+func (channel *WebhookChannel) Send(ctx context.Context, delivery *repository.Delivery) error {
+	body, err := json.Marshal(webhookPayload{
+		Id:      delivery.Id,
+		EventId: delivery.EventId,
+		User:    delivery.User,
+		Subject: delivery.Subject,
+		Body:    delivery.Body,
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.Recipient, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if channel.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(channel.Secret))
+		mac.Write(body)
+		req.Header.Set(SignatureHeader, hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	client := channel.Client
+	if client == nil && delivery.Recipient != "" && delivery.Recipient == channel.TrustedURL {
+		client = http.DefaultClient
+	} else if client == nil {
+		client = publicClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded %s", resp.Status)
+	}
+	return nil
+}
+
+// publicClient refuses to connect to addresses that are not public. The
+// check runs on the address actually dialed, so it also covers redirects
+// and names that resolve differently than when the URL was saved.
+var publicClient = &http.Client{
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: webhookTimeout,
+			Control: func(network, address string, conn syscall.RawConn) error {
+				addrPort, err := netip.ParseAddrPort(address)
+				if err != nil {
+					return err
+				}
+				if !isPublic(addrPort.Addr()) {
+					return fmt.Errorf("%w: %s", ErrPrivateAddress, addrPort.Addr())
+				}
+				return nil
+			},
+		}).DialContext,
+		TLSHandshakeTimeout: webhookTimeout,
+	},
+}
+
+// CheckWebhookURL checks that rawURL is an http or https URL whose host
+// only resolves to public addresses.
+func CheckWebhookURL(ctx context.Context, rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Hostname() == "" {
+		return errors.New("webhook_url must be an http or https url")
+	}
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", parsed.Hostname())
+	if err != nil {
+		return fmt.Errorf("cannot resolve %s: %w", parsed.Hostname(), err)
+	}
+	for _, addr := range addrs {
+		if !isPublic(addr) {
+			return fmt.Errorf("%w: %s resolves to %s", ErrPrivateAddress, parsed.Hostname(), addr)
+		}
+	}
+	return nil
+}
+
+// nonPublicRanges are the ranges IsGlobalUnicast and IsPrivate let through
+// that still reach the local host or network: "this network" and
+// carrier-grade NAT.
+var nonPublicRanges = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+}
+
+func isPublic(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+	for _, prefix := range nonPublicRanges {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,172 @@
+package notify_test
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gw-broker/internal/notify"
+	"gw-broker/internal/repository"
+)
+
+func testDelivery(recipient string) *repository.Delivery {
+	return &repository.Delivery{
+		Id:        "event:channel",
+		EventId:   "event",
+		User:      "user",
+		Recipient: recipient,
+		Subject:   "Large withdrawal",
+		Body:      "You withdrew 50000.\n",
+	}
+}
+
+func TestWebhookSignature(t *testing.T) {
+	var body []byte
+	var signature string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		signature = r.Header.Get(notify.SignatureHeader)
+	}))
+	defer server.Close()
+
+	channel := &notify.WebhookChannel{Secret: "secret", Client: server.Client()}
+	if err := channel.Send(context.Background(), testDelivery(server.URL)); err != nil {
+		t.Fatalf("expected %v, got %v\n", nil, err)
+	}
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write(body)
+	if expected := hex.EncodeToString(mac.Sum(nil)); signature != expected {
+		t.Fatalf("expected %v, got %v\n", expected, signature)
+	}
+}
+
+func TestWebhookRejected(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	channel := &notify.WebhookChannel{Client: server.Client()}
+	if err := channel.Send(context.Background(), testDelivery(server.URL)); err == nil {
+		t.Fatalf("expected an error for a 503, got %v\n", err)
+	}
+}
+
+func TestWebhookPrivateAddress(t *testing.T) {
+	var called bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer server.Close()
+
+	// a user's url on the loopback is refused, the operator's is trusted
+	channel := &notify.WebhookChannel{}
+	if err := channel.Send(context.Background(), testDelivery(server.URL)); !errors.Is(err, notify.ErrPrivateAddress) || called {
+		t.Fatalf("expected %v, got %v\n", notify.ErrPrivateAddress, err)
+	}
+	channel = &notify.WebhookChannel{TrustedURL: server.URL}
+	if err := channel.Send(context.Background(), testDelivery(server.URL)); err != nil || !called {
+		t.Fatalf("expected %v, got %v\n", nil, err)
+	}
+}
+
+func TestCheckWebhookURL(t *testing.T) {
+	tests := []struct {
+		url string
+		ok  bool
+	}{
+		{"https://203.0.113.10/hook", true},
+		{"ftp://203.0.113.10/hook", false},
+		{"http://127.0.0.1:8030/api", false},
+		{"http://localhost/hook", false},
+		{"http://10.1.2.3/hook", false},
+		{"http://169.254.169.254/latest/meta-data", false},
+		{"http://[::1]/hook", false},
+		{"http://[::ffff:192.168.0.1]/hook", false},
+		{"http://100.64.0.1/hook", false},
+	}
+
+	for _, test := range tests {
+		if err := notify.CheckWebhookURL(context.Background(), test.url); (err == nil) != test.ok {
+			t.Fatalf("expected ok %v for %v, got %v\n", test.ok, test.url, err)
+		}
+	}
+}
+
+// fakeSMTP speaks just enough SMTP to accept one message and returns what
+// was sent as DATA.
+func fakeSMTP(t *testing.T) (string, <-chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	data := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+
+		reply("220 localhost ready")
+		var message strings.Builder
+		inData := false
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if inData {
+				if line == ".\r\n" {
+					inData = false
+					data <- message.String()
+					reply("250 queued")
+				} else {
+					message.WriteString(line)
+				}
+				continue
+			}
+			switch command := strings.ToUpper(strings.Fields(line)[0]); command {
+			case "EHLO", "HELO", "MAIL", "RCPT", "RSET", "NOOP":
+				reply("250 ok")
+			case "DATA":
+				inData = true
+				reply("354 go ahead")
+			case "QUIT":
+				reply("221 bye")
+				return
+			default:
+				reply("502 not implemented")
+			}
+		}
+	}()
+	return listener.Addr().String(), data
+}
+
+func TestSMTPSend(t *testing.T) {
+	addr, data := fakeSMTP(t)
+	channel := &notify.SMTPChannel{Addr: addr, From: "wallet@example.com"}
+	if err := channel.Send(context.Background(), testDelivery("user@example.com")); err != nil {
+		t.Fatalf("expected %v, got %v\n", nil, err)
+	}
+
+	message := <-data
+	for _, expected := range []string{"From: wallet@example.com", "To: user@example.com", "Subject: Large withdrawal", "You withdrew 50000."} {
+		if !strings.Contains(message, expected) {
+			t.Fatalf("expected %q in the message, got %v\n", expected, message)
+		}
+	}
+}
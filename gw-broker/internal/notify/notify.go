@@ -0,0 +1,293 @@
+// Package notify tells users about their large operations. Deliveries are
+// queued in storage and sent by a dispatcher loop, which retries failed
+// sends with exponential backoff until NOTIFY_MAX_ATTEMPTS.
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"gw-broker/internal/config"
+	"gw-broker/internal/repository"
+
+	"github.com/lynxbites/wallet-services/gw-shared/events"
+)
+
+const (
+	dueBatch      = 100
+	maxRetryDelay = time.Hour
+)
+
+type Notifier struct {
+	store     repository.NotificationStore
+	channels  map[string]Channel
+	templates *Templates
+	logger    *slog.Logger
+
+	defaultChannels []string
+	webhookURL      string
+	maxAttempts     int
+	retryDelay      time.Duration
+	pollInterval    time.Duration
+
+	wake chan struct{}
+	now  func() time.Time
+}
+
+func NewNotifier(store repository.NotificationStore, cfg *config.Config, logger *slog.Logger) (*Notifier, error) {
+	notifyCfg := cfg.NotifyConfig
+	templates, err := LoadTemplates(notifyCfg.TemplatesDir)
+	if err != nil {
+		return nil, err
+	}
+
+	channels := map[string]Channel{
+		ChannelLog:     &LogChannel{Logger: logger},
+		ChannelWebhook: &WebhookChannel{Secret: notifyCfg.WebhookSecret, TrustedURL: notifyCfg.WebhookURL},
+	}
+	if notifyCfg.SMTPAddr != "" {
+		channels[ChannelSMTP] = &SMTPChannel{
+			Addr:     notifyCfg.SMTPAddr,
+			From:     notifyCfg.SMTPFrom,
+			Username: notifyCfg.SMTPUsername,
+			Password: notifyCfg.SMTPPassword,
+		}
+	}
+
+	var defaultChannels []string
+	for _, name := range strings.Split(notifyCfg.DefaultChannels, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			defaultChannels = append(defaultChannels, name)
+		}
+	}
+	return NewNotifierWithChannels(store, channels, templates, logger, &Options{
+		DefaultChannels: defaultChannels,
+		WebhookURL:      notifyCfg.WebhookURL,
+		MaxAttempts:     notifyCfg.MaxAttempts,
+		RetryDelay:      notifyCfg.RetryDelay,
+		PollInterval:    notifyCfg.PollInterval,
+	}), nil
+}
+
+// Options are the settings NewNotifier reads from the config.
+type Options struct {
+	DefaultChannels []string
+	WebhookURL      string
+	MaxAttempts     int
+	RetryDelay      time.Duration
+	PollInterval    time.Duration
+}
+
+func NewNotifierWithChannels(store repository.NotificationStore, channels map[string]Channel, templates *Templates, logger *slog.Logger, options *Options) *Notifier {
+	return &Notifier{
+		store:           store,
+		channels:        channels,
+		templates:       templates,
+		logger:          logger,
+		defaultChannels: options.DefaultChannels,
+		webhookURL:      options.WebhookURL,
+		maxAttempts:     max(options.MaxAttempts, 1),
+		retryDelay:      options.RetryDelay,
+		pollInterval:    options.PollInterval,
+		wake:            make(chan struct{}, 1),
+		now:             func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// HasChannel reports whether the channel can be used.
+func (notifier *Notifier) HasChannel(name string) bool {
+	return notifier.channels[name] != nil
+}
+
+// Notify queues the deliveries the user's preferences ask for. Users
+// without preferences get the default channels that need no address.
+// Queuing an operation again does nothing.
+func (notifier *Notifier) Notify(ctx context.Context, operation *repository.InsertStruct) error {
+	preferences, err := notifier.preferences(ctx, operation.User)
+	if err != nil {
+		return err
+	}
+	if operation.Amount < preferences.MinAmount {
+		return nil
+	}
+	if len(preferences.Types) > 0 && !slices.Contains(preferences.Types, operation.OperationType) {
+		return nil
+	}
+	return notifier.queue(ctx, preferences, operation.Id, func() (string, string, error) {
+		subject, body, err := notifier.templates.Render(operation)
+		if err != nil {
+			return "", "", fmt.Errorf("render %s: %w", operation.OperationType, err)
+		}
+		return subject, body, nil
+	})
+}
+
+// NotifySecurity queues a security notice on the user's channels. Notices
+// are sent whatever amounts and types the user filtered operations by.
+// Events without a user, such as a locked address, are only logged.
+func (notifier *Notifier) NotifySecurity(ctx context.Context, event *events.SecurityEvent) error {
+	if event.UserId == "" {
+		notifier.logger.Warn("notify: security event without a user", "type", event.Type, "ip", event.IP, "id", event.Id)
+		return nil
+	}
+	preferences, err := notifier.preferences(ctx, event.UserId)
+	if err != nil {
+		return err
+	}
+	return notifier.queue(ctx, preferences, event.Id, func() (string, string, error) {
+		subject, body, err := notifier.templates.RenderSecurity(event)
+		if err != nil {
+			return "", "", fmt.Errorf("render security %s: %w", event.Type, err)
+		}
+		return subject, body, nil
+	})
+}
+
+func (notifier *Notifier) preferences(ctx context.Context, user string) (*repository.Preferences, error) {
+	preferences, err := notifier.store.GetPreferences(ctx, user)
+	if errors.Is(err, repository.ErrPreferencesNotFound) {
+		return &repository.Preferences{User: user, Channels: notifier.defaultChannels}, nil
+	}
+	return preferences, err
+}
+
+// queue adds a delivery of the event per channel of the preferences,
+// rendering the text once the first channel is known to be usable.
+func (notifier *Notifier) queue(ctx context.Context, preferences *repository.Preferences, eventId string, render func() (string, string, error)) error {
+	var subject, body string
+	queued := false
+	for _, channel := range preferences.Channels {
+		recipient := notifier.recipient(channel, preferences)
+		if recipient == "" || !notifier.HasChannel(channel) {
+			notifier.logger.Warn("notify: channel unavailable, skipping", "user", preferences.User, "channel", channel)
+			continue
+		}
+		if subject == "" {
+			var err error
+			if subject, body, err = render(); err != nil {
+				return err
+			}
+		}
+
+		now := notifier.now()
+		err := notifier.store.AddDelivery(ctx, &repository.Delivery{
+			Id:            eventId + ":" + channel,
+			EventId:       eventId,
+			User:          preferences.User,
+			Channel:       channel,
+			Recipient:     recipient,
+			Subject:       subject,
+			Body:          body,
+			Status:        repository.DeliveryPending,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		})
+		if errors.Is(err, repository.ErrDuplicateDelivery) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		queued = true
+	}
+
+	if queued {
+		select {
+		case notifier.wake <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+func (notifier *Notifier) recipient(channel string, preferences *repository.Preferences) string {
+	switch channel {
+	case ChannelLog:
+		return preferences.User
+	case ChannelSMTP:
+		return preferences.Email
+	case ChannelWebhook:
+		if preferences.WebhookURL != "" {
+			return preferences.WebhookURL
+		}
+		return notifier.webhookURL
+	}
+	return ""
+}
+
+// Run sends due deliveries every poll interval, or as soon as Notify queues
+// one, until ctx is done.
+func (notifier *Notifier) Run(ctx context.Context) {
+	ticker := time.NewTicker(notifier.pollInterval)
+	defer ticker.Stop()
+	for {
+		notifier.SendDue(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-notifier.wake:
+		}
+	}
+}
+
+// SendDue makes one attempt at up to dueBatch due deliveries.
+func (notifier *Notifier) SendDue(ctx context.Context) {
+	due, err := notifier.store.DueDeliveries(ctx, notifier.now(), dueBatch)
+	if err != nil {
+		notifier.logger.Error("notify: couldn't load due deliveries", "error", err.Error())
+		return
+	}
+	for i := range due {
+		if ctx.Err() != nil {
+			return
+		}
+		notifier.attempt(ctx, &due[i])
+	}
+}
+
+// attempt sends the delivery once. A delivery queued for a channel that is
+// no longer configured fails at once.
+func (notifier *Notifier) attempt(ctx context.Context, delivery *repository.Delivery) {
+	var err error
+	channel, ok := notifier.channels[delivery.Channel]
+	if ok {
+		err = channel.Send(ctx, delivery)
+	} else {
+		err = fmt.Errorf("channel %s is not configured", delivery.Channel)
+	}
+	delivery.Attempts++
+	delivery.UpdatedAt = notifier.now()
+
+	switch {
+	case err == nil:
+		delivery.Status = repository.DeliverySent
+		delivery.LastError = ""
+	case !ok || delivery.Attempts >= notifier.maxAttempts:
+		delivery.Status = repository.DeliveryFailed
+		delivery.LastError = err.Error()
+		notifier.logger.Error("notify: giving up", "id", delivery.Id, "attempts", delivery.Attempts, "error", err.Error())
+	default:
+		delivery.LastError = err.Error()
+		delivery.NextAttemptAt = delivery.UpdatedAt.Add(notifier.backoff(delivery.Attempts))
+		notifier.logger.Warn("notify: send failed, will retry", "id", delivery.Id, "attempts", delivery.Attempts, "next_attempt_at", delivery.NextAttemptAt, "error", err.Error())
+	}
+
+	if err := notifier.store.UpdateDelivery(ctx, delivery); err != nil {
+		notifier.logger.Error("notify: couldn't record delivery", "id", delivery.Id, "error", err.Error())
+	}
+}
+
+func (notifier *Notifier) backoff(attempts int) time.Duration {
+	delay := notifier.retryDelay
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryDelay)
+}
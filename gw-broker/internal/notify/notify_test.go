@@ -0,0 +1,198 @@
+package notify_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"gw-broker/internal/notify"
+	"gw-broker/internal/repository"
+
+	"github.com/lynxbites/wallet-services/gw-shared/events"
+)
+
+type fakeStore struct {
+	preferences map[string]*repository.Preferences
+	deliveries  map[string]*repository.Delivery
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{preferences: map[string]*repository.Preferences{}, deliveries: map[string]*repository.Delivery{}}
+}
+
+func (store *fakeStore) GetPreferences(ctx context.Context, user string) (*repository.Preferences, error) {
+	if preferences, ok := store.preferences[user]; ok {
+		return preferences, nil
+	}
+	return nil, repository.ErrPreferencesNotFound
+}
+
+func (store *fakeStore) SavePreferences(ctx context.Context, preferences *repository.Preferences) error {
+	store.preferences[preferences.User] = preferences
+	return nil
+}
+
+func (store *fakeStore) AddDelivery(ctx context.Context, delivery *repository.Delivery) error {
+	if _, ok := store.deliveries[delivery.Id]; ok {
+		return repository.ErrDuplicateDelivery
+	}
+	copied := *delivery
+	store.deliveries[delivery.Id] = &copied
+	return nil
+}
+
+func (store *fakeStore) UpdateDelivery(ctx context.Context, delivery *repository.Delivery) error {
+	copied := *delivery
+	store.deliveries[delivery.Id] = &copied
+	return nil
+}
+
+func (store *fakeStore) DueDeliveries(ctx context.Context, now time.Time, limit int64) ([]repository.Delivery, error) {
+	var due []repository.Delivery
+	for _, delivery := range store.deliveries {
+		if delivery.Status == repository.DeliveryPending && !delivery.NextAttemptAt.After(now) {
+			due = append(due, *delivery)
+		}
+	}
+	return due, nil
+}
+
+type fakeChannel struct {
+	err  error
+	sent []string
+}
+
+func (channel *fakeChannel) Send(ctx context.Context, delivery *repository.Delivery) error {
+	channel.sent = append(channel.sent, delivery.Recipient)
+	return channel.err
+}
+
+func newTestNotifier(t *testing.T, store *fakeStore, channels map[string]notify.Channel) *notify.Notifier {
+	templates, err := notify.LoadTemplates("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return notify.NewNotifierWithChannels(store, channels, templates, slog.New(slog.NewTextHandler(io.Discard, nil)), &notify.Options{
+		DefaultChannels: []string{notify.ChannelLog},
+		MaxAttempts:     2,
+		RetryDelay:      time.Minute,
+		PollInterval:    time.Second,
+	})
+}
+
+func TestNotifyPreferences(t *testing.T) {
+	store := newFakeStore()
+	store.preferences["picky"] = &repository.Preferences{User: "picky", Email: "picky@example.com", Channels: []string{notify.ChannelSMTP, notify.ChannelWebhook}, Types: []string{"withdraw"}}
+	log, smtp := &fakeChannel{}, &fakeChannel{}
+	notifier := newTestNotifier(t, store, map[string]notify.Channel{notify.ChannelLog: log, notify.ChannelSMTP: smtp})
+
+	operations := []*repository.InsertStruct{
+		{Id: "1", User: "someone", OperationType: "deposit", Amount: 50000},
+		{Id: "2", User: "picky", OperationType: "deposit", Amount: 50000},
+		{Id: "3", User: "picky", OperationType: "withdraw", Amount: 50000},
+		{Id: "3", User: "picky", OperationType: "withdraw", Amount: 50000},
+	}
+	for _, operation := range operations {
+		if err := notifier.Notify(context.Background(), operation); err != nil {
+			t.Fatalf("expected %v, got %v\n", nil, err)
+		}
+	}
+
+	// webhook has neither a url nor a default one, so only smtp is queued
+	// for picky
+	if len(store.deliveries) != 2 || store.deliveries["1:log"] == nil || store.deliveries["3:smtp"] == nil {
+		t.Fatalf("expected deliveries 1:log and 3:smtp, got %v\n", store.deliveries)
+	}
+	if subject := store.deliveries["3:smtp"].Subject; subject == "" {
+		t.Fatalf("expected a rendered subject, got %q\n", subject)
+	}
+
+	notifier.SendDue(context.Background())
+	if len(log.sent) != 1 || len(smtp.sent) != 1 || smtp.sent[0] != "picky@example.com" {
+		t.Fatalf("expected one send per channel, got %v and %v\n", log.sent, smtp.sent)
+	}
+	if status := store.deliveries["3:smtp"].Status; status != repository.DeliverySent {
+		t.Fatalf("expected %v, got %v\n", repository.DeliverySent, status)
+	}
+}
+
+func TestNotifyRetry(t *testing.T) {
+	store := newFakeStore()
+	failing := &fakeChannel{err: errors.New("connection refused")}
+	notifier := newTestNotifier(t, store, map[string]notify.Channel{notify.ChannelLog: failing})
+
+	if err := notifier.Notify(context.Background(), &repository.InsertStruct{Id: "1", User: "user", OperationType: "withdraw", Amount: 50000}); err != nil {
+		t.Fatalf("expected %v, got %v\n", nil, err)
+	}
+
+	notifier.SendDue(context.Background())
+	delivery := store.deliveries["1:log"]
+	if delivery.Status != repository.DeliveryPending || delivery.Attempts != 1 || delivery.LastError != "connection refused" {
+		t.Fatalf("expected a pending delivery with one attempt, got %+v\n", delivery)
+	}
+
+	// the retry is scheduled in the future, so nothing is due yet
+	notifier.SendDue(context.Background())
+	if len(failing.sent) != 1 {
+		t.Fatalf("expected %v, got %v\n", 1, len(failing.sent))
+	}
+
+	delivery.NextAttemptAt = time.Time{}
+	notifier.SendDue(context.Background())
+	delivery = store.deliveries["1:log"]
+	if delivery.Status != repository.DeliveryFailed || delivery.Attempts != 2 {
+		t.Fatalf("expected a failed delivery after two attempts, got %+v\n", delivery)
+	}
+}
+
+func TestNotifyUnconfiguredChannel(t *testing.T) {
+	store := newFakeStore()
+	notifier := newTestNotifier(t, store, map[string]notify.Channel{notify.ChannelLog: &fakeChannel{}})
+
+	// queued while smtp was configured, sent after it was turned off
+	store.deliveries["1:smtp"] = &repository.Delivery{Id: "1:smtp", Channel: notify.ChannelSMTP, Recipient: "user@example.com", Status: repository.DeliveryPending}
+	notifier.SendDue(context.Background())
+	delivery := store.deliveries["1:smtp"]
+	if delivery.Status != repository.DeliveryFailed || delivery.LastError == "" {
+		t.Fatalf("expected a failed delivery with an error, got %+v\n", delivery)
+	}
+}
+
+func TestNotifySecurity(t *testing.T) {
+	store := newFakeStore()
+	// the filters for operations do not hold back security notices
+	store.preferences["picky"] = &repository.Preferences{User: "picky", Email: "picky@example.com", Channels: []string{notify.ChannelSMTP}, Types: []string{"withdraw"}, MinAmount: 100000}
+	notifier := newTestNotifier(t, store, map[string]notify.Channel{notify.ChannelLog: &fakeChannel{}, notify.ChannelSMTP: &fakeChannel{}})
+
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	securityEvents := []*events.SecurityEvent{
+		{Id: "1", Type: events.SecurityNewDevice, UserId: "picky", IP: "203.0.113.7", Details: map[string]string{"user_agent": "curl/8.0"}, OccurredAt: now},
+		{Id: "2", Type: events.SecurityLoginLocked, UserId: "someone", Details: map[string]string{"failures": "10", "locked_until": "2025-03-01T12:15:00Z"}, OccurredAt: now},
+		// a locked address is nobody's to be told about
+		{Id: "3", Type: events.SecurityLoginLocked, IP: "203.0.113.7", Details: map[string]string{"scope": "ip"}, OccurredAt: now},
+		{Id: "4", Type: "password_changed", UserId: "someone", OccurredAt: now},
+	}
+	for _, event := range securityEvents {
+		if err := notifier.NotifySecurity(context.Background(), event); err != nil {
+			t.Fatalf("expected %v, got %v\n", nil, err)
+		}
+	}
+
+	if len(store.deliveries) != 3 || store.deliveries["1:smtp"] == nil || store.deliveries["2:log"] == nil || store.deliveries["4:log"] == nil {
+		t.Fatalf("expected deliveries 1:smtp, 2:log and 4:log, got %v\n", store.deliveries)
+	}
+	if body := store.deliveries["1:smtp"].Body; !strings.Contains(body, "curl/8.0") || !strings.Contains(body, "203.0.113.7") {
+		t.Fatalf("expected the device in the body, got %q\n", body)
+	}
+	if body := store.deliveries["2:log"].Body; !strings.Contains(body, "2025-03-01T12:15:00Z") {
+		t.Fatalf("expected the lock end in the body, got %q\n", body)
+	}
+	// types without a template of their own use security.tmpl
+	if subject := store.deliveries["4:log"].Subject; !strings.Contains(subject, "password_changed") {
+		t.Fatalf("expected the type in the subject, got %q\n", subject)
+	}
+}
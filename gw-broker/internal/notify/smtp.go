@@ -0,0 +1,91 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"gw-broker/internal/repository"
+)
+
+const smtpTimeout = 30 * time.Second
+
+// SMTPChannel mails the notification through Addr. Auth is only used when
+// Username is set; net/smtp refuses to send it unencrypted except to
+// localhost.
+type SMTPChannel struct {
+	Addr     string
+	From     string
+	Username string
+	Password string
+}
+
+// Send does what smtp.SendMail does, but bounded by smtpTimeout so a stuck
+// server cannot hold up the dispatcher.
+func (channel *SMTPChannel) Send(ctx context.Context, delivery *repository.Delivery) error {
+	host, _, err := net.SplitHostPort(channel.Addr)
+	if err != nil {
+		return err
+	}
+	dialer := &net.Dialer{Timeout: smtpTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", channel.Addr)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(smtpTimeout))
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if channel.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", channel.Username, channel.Password, host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(channel.From); err != nil {
+		return err
+	}
+	if err := client.Rcpt(delivery.Recipient); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(channel.message(delivery)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+func (channel *SMTPChannel) message(delivery *repository.Delivery) []byte {
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", channel.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", delivery.Recipient)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", delivery.Subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "Message-ID: <%s@gw-broker>\r\n", strings.ReplaceAll(delivery.Id, ":", "."))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("\r\n")
+	msg.Write(bytes.ReplaceAll([]byte(delivery.Body), []byte("\n"), []byte("\r\n")))
+	return msg.Bytes()
+}
@@ -0,0 +1,111 @@
+package notify
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"gw-broker/internal/repository"
+
+	"github.com/lynxbites/wallet-services/gw-shared/events"
+)
+
+//go:embed templates/*.tmpl
+var builtinTemplates embed.FS
+
+const (
+	defaultTemplate  = "default"
+	securityTemplate = "security"
+)
+
+// Templates render a subject and a body per operation type. Each template
+// defines "subject" and "body"; types without one use default.tmpl.
+// Security events use security_<type>.tmpl, or security.tmpl.
+type Templates struct {
+	byType map[string]*template.Template
+}
+
+// LoadTemplates parses the built-in templates, then the *.tmpl files in dir,
+// if given, which replace the built-in ones of the same name.
+func LoadTemplates(dir string) (*Templates, error) {
+	templates := &Templates{byType: map[string]*template.Template{}}
+
+	builtin, err := builtinTemplates.ReadDir("templates")
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range builtin {
+		text, err := builtinTemplates.ReadFile("templates/" + entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		if err := templates.add(entry.Name(), string(text)); err != nil {
+			return nil, err
+		}
+	}
+
+	if dir != "" {
+		paths, err := filepath.Glob(filepath.Join(dir, "*.tmpl"))
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range paths {
+			text, err := os.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			if err := templates.add(filepath.Base(path), string(text)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if templates.byType[defaultTemplate] == nil || templates.byType[securityTemplate] == nil {
+		return nil, errors.New("notify: no default or security template")
+	}
+	return templates, nil
+}
+
+func (templates *Templates) add(name string, text string) error {
+	parsed, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return fmt.Errorf("notify: template %s: %w", name, err)
+	}
+	if parsed.Lookup("subject") == nil || parsed.Lookup("body") == nil {
+		return fmt.Errorf("notify: template %s must define subject and body", name)
+	}
+	templates.byType[strings.TrimSuffix(name, ".tmpl")] = parsed
+	return nil
+}
+
+func (templates *Templates) Render(operation *repository.InsertStruct) (string, string, error) {
+	parsed := templates.byType[operation.OperationType]
+	if parsed == nil {
+		parsed = templates.byType[defaultTemplate]
+	}
+	return execute(parsed, operation)
+}
+
+func (templates *Templates) RenderSecurity(event *events.SecurityEvent) (string, string, error) {
+	parsed := templates.byType[securityTemplate+"_"+string(event.Type)]
+	if parsed == nil {
+		parsed = templates.byType[securityTemplate]
+	}
+	return execute(parsed, event)
+}
+
+func execute(parsed *template.Template, data any) (string, string, error) {
+	var subject, body bytes.Buffer
+	if err := parsed.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return "", "", err
+	}
+	if err := parsed.ExecuteTemplate(&body, "body", data); err != nil {
+		return "", "", err
+	}
+	return strings.TrimSpace(subject.String()), strings.TrimSpace(body.String()) + "\n", nil
+}
@@ -0,0 +1,328 @@
+// Package file stores operations and alerts as newline delimited JSON, one
+// append-only file each. Ids are indexed in memory on start and queries scan
+// the file, which is fine for the small deployments it is meant for.
+// Rollups are kept in memory and built from the file on start.
+package file
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"gw-broker/internal/repository"
+)
+
+const (
+	operationsFile  = "operations.ndjson"
+	alertsFile      = "alerts.ndjson"
+	preferencesFile = "preferences.ndjson"
+	deliveriesFile  = "deliveries.ndjson"
+)
+
+type OperationStorage struct {
+	mu           sync.Mutex
+	dir          string
+	operations   *os.File
+	alerts       *os.File
+	operationIds map[string]bool
+	alertIds     map[string]bool
+	rollups      map[rollupKey]*repository.Rollup
+	// rolledUp holds the ids of the operations counted in rollups
+	rolledUp map[string]bool
+
+	// preferences and deliveries are logs of every saved state; the last
+	// record for a key wins
+	preferencesLog *os.File
+	deliveriesLog  *os.File
+	preferences    map[string]repository.Preferences
+	deliveries     map[string]repository.Delivery
+}
+
+type rollupKey struct{ period, key, user, operationType, currency string }
+
+func NewOperationStorage(dir string) (*OperationStorage, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+	storage := &OperationStorage{
+		dir:          dir,
+		operationIds: map[string]bool{},
+		alertIds:     map[string]bool{},
+		preferences:  map[string]repository.Preferences{},
+		deliveries:   map[string]repository.Delivery{},
+	}
+
+	files := []struct {
+		target **os.File
+		name   string
+		read   func(line []byte)
+	}{
+		{&storage.operations, operationsFile, indexIds(storage.operationIds)},
+		{&storage.alerts, alertsFile, indexIds(storage.alertIds)},
+		{&storage.preferencesLog, preferencesFile, func(line []byte) {
+			var preferences repository.Preferences
+			if json.Unmarshal(line, &preferences) == nil {
+				storage.preferences[preferences.User] = preferences
+			}
+		}},
+		{&storage.deliveriesLog, deliveriesFile, func(line []byte) {
+			var delivery repository.Delivery
+			if json.Unmarshal(line, &delivery) == nil {
+				storage.deliveries[delivery.Id] = delivery
+			}
+		}},
+	}
+	for _, file := range files {
+		f, err := openLog(filepath.Join(dir, file.name), file.read)
+		if err != nil {
+			storage.Close(context.Background())
+			return nil, err
+		}
+		*file.target = f
+	}
+	if err := storage.RebuildRollups(context.Background()); err != nil {
+		storage.Close(context.Background())
+		return nil, err
+	}
+	return storage, nil
+}
+
+// openLog opens the file for appending and reads every line in it. A line
+// torn by a crash mid-write is terminated so later records start on a line
+// of their own; read is expected to skip it.
+func openLog(path string, read func(line []byte)) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o640)
+	if err != nil {
+		return nil, err
+	}
+	err = terminate(f)
+	if err == nil {
+		err = scan(f, read)
+	}
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	return f, nil
+}
+
+func indexIds(ids map[string]bool) func(line []byte) {
+	return func(line []byte) {
+		var record struct {
+			Id string `json:"id"`
+		}
+		if json.Unmarshal(line, &record) == nil {
+			ids[record.Id] = true
+		}
+	}
+}
+
+func terminate(f *os.File) error {
+	info, err := f.Stat()
+	if err != nil || info.Size() == 0 {
+		return err
+	}
+	last := make([]byte, 1)
+	if _, err := f.ReadAt(last, info.Size()-1); err != nil {
+		return err
+	}
+	if last[0] != '\n' {
+		_, err = f.Write([]byte{'\n'})
+	}
+	return err
+}
+
+// StoreOperations appends the new operations and syncs the file before
+// returning, so an acked event is on disk. A failed write fails the whole
+// batch; the ids are only indexed once the write succeeded.
+func (storage *OperationStorage) StoreOperations(data []*repository.InsertStruct) []error {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	results := make([]error, len(data))
+	var lines []byte
+	fresh := map[string]bool{}
+	for i, operation := range data {
+		if storage.operationIds[operation.Id] || fresh[operation.Id] {
+			results[i] = repository.ErrDuplicateOperation
+			continue
+		}
+		line, err := json.Marshal(operation)
+		if err != nil {
+			results[i] = err
+			continue
+		}
+		fresh[operation.Id] = true
+		lines = append(append(lines, line...), '\n')
+	}
+
+	if err := storage.append(storage.operations, lines); err != nil {
+		for i := range results {
+			if results[i] == nil {
+				results[i] = err
+			}
+		}
+		return results
+	}
+	for id := range fresh {
+		storage.operationIds[id] = true
+	}
+	return results
+}
+
+func (storage *OperationStorage) StoreAlert(ctx context.Context, alert *repository.Alert) error {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	if storage.alertIds[alert.Id] {
+		return repository.ErrDuplicateAlert
+	}
+	line, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	if err := storage.append(storage.alerts, append(line, '\n')); err != nil {
+		return err
+	}
+	storage.alertIds[alert.Id] = true
+	return nil
+}
+
+func (storage *OperationStorage) append(f *os.File, lines []byte) error {
+	if len(lines) == 0 {
+		return nil
+	}
+	if _, err := f.Write(lines); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+func (storage *OperationStorage) ListOperations(ctx context.Context, filter *repository.OperationFilter) ([]repository.InsertStruct, int64, error) {
+	matched, err := storage.find(filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		if !matched[i].OccurredAt.Equal(matched[j].OccurredAt) {
+			return matched[i].OccurredAt.After(matched[j].OccurredAt)
+		}
+		return matched[i].Id < matched[j].Id
+	})
+	return page(matched, filter), int64(len(matched)), nil
+}
+
+func (storage *OperationStorage) DailyTotals(ctx context.Context, filter *repository.OperationFilter) ([]repository.DailyTotal, error) {
+	matched, err := storage.find(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	type key struct{ user, day, operationType string }
+	byKey := map[key]*repository.DailyTotal{}
+	for _, operation := range matched {
+		k := key{operation.User, operation.OccurredAt.UTC().Format("2006-01-02"), operation.OperationType}
+		total, ok := byKey[k]
+		if !ok {
+			total = &repository.DailyTotal{User: k.user, Day: k.day, OperationType: k.operationType}
+			byKey[k] = total
+		}
+		total.Total += operation.Amount
+		total.Count++
+	}
+
+	totals := make([]repository.DailyTotal, 0, len(byKey))
+	for _, total := range byKey {
+		totals = append(totals, *total)
+	}
+	sort.Slice(totals, func(i, j int) bool {
+		if totals[i].Day != totals[j].Day {
+			return totals[i].Day > totals[j].Day
+		}
+		if totals[i].User != totals[j].User {
+			return totals[i].User < totals[j].User
+		}
+		return totals[i].OperationType < totals[j].OperationType
+	})
+	return page(totals, filter), nil
+}
+
+func (storage *OperationStorage) Close(ctx context.Context) error {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+	var errs []error
+	for _, f := range []*os.File{storage.operations, storage.alerts, storage.preferencesLog, storage.deliveriesLog} {
+		if f != nil {
+			errs = append(errs, f.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (storage *OperationStorage) find(filter *repository.OperationFilter) ([]repository.InsertStruct, error) {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+	return storage.findLocked(filter)
+}
+
+// findLocked is find for callers that hold storage.mu.
+func (storage *OperationStorage) findLocked(filter *repository.OperationFilter) ([]repository.InsertStruct, error) {
+	var matched []repository.InsertStruct
+	err := scan(storage.operations, func(line []byte) {
+		var operation repository.InsertStruct
+		if json.Unmarshal(line, &operation) == nil && matches(&operation, filter) {
+			matched = append(matched, operation)
+		}
+	})
+	return matched, err
+}
+
+func matches(operation *repository.InsertStruct, filter *repository.OperationFilter) bool {
+	switch {
+	case filter.User != "" && operation.User != filter.User:
+		return false
+	case filter.OperationType != "" && operation.OperationType != filter.OperationType:
+		return false
+	case filter.MinAmount != nil && operation.Amount < *filter.MinAmount:
+		return false
+	case filter.MaxAmount != nil && operation.Amount > *filter.MaxAmount:
+		return false
+	case !filter.From.IsZero() && operation.OccurredAt.Before(filter.From):
+		return false
+	case !filter.To.IsZero() && !operation.OccurredAt.Before(filter.To):
+		return false
+	}
+	return true
+}
+
+func page[T any](items []T, filter *repository.OperationFilter) []T {
+	start := min(int(filter.Offset), len(items))
+	end := len(items)
+	if filter.Limit > 0 {
+		end = min(start+int(filter.Limit), len(items))
+	}
+	return items[start:end]
+}
+
+// scan calls read for every line of the file from the start. Lines that
+// are not valid JSON are left to read to skip.
+func scan(f *os.File, read func(line []byte)) error {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) > 0 {
+			read(scanner.Bytes())
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,153 @@
+package file_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gw-broker/internal/repository"
+	"gw-broker/internal/repository/file"
+)
+
+func TestStoreAndQuery(t *testing.T) {
+	dir := t.TempDir()
+	storage, err := file.NewOperationStorage(dir)
+	if err != nil {
+		t.Fatalf("expected no error, got %v\n", err)
+	}
+
+	day := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	results := storage.StoreOperations([]*repository.InsertStruct{
+		{Id: "1", User: "user", OperationType: "deposit", Amount: 50000, Currency: "USD", OccurredAt: day},
+		{Id: "2", User: "user", OperationType: "withdraw", Amount: 40000, Currency: "USD", OccurredAt: day.Add(time.Hour)},
+		{Id: "1", User: "user", OperationType: "deposit", Amount: 50000, Currency: "USD", OccurredAt: day},
+	})
+	if results[0] != nil || results[1] != nil || !errors.Is(results[2], repository.ErrDuplicateOperation) {
+		t.Fatalf("expected stored, stored, duplicate, got %v\n", results)
+	}
+	storage.Close(context.Background())
+
+	// a torn last line is skipped and does not swallow the next record
+	f, _ := os.OpenFile(filepath.Join(dir, "operations.ndjson"), os.O_APPEND|os.O_WRONLY, 0)
+	f.WriteString(`{"id":"torn"`)
+	f.Close()
+
+	storage, err = file.NewOperationStorage(dir)
+	if err != nil {
+		t.Fatalf("expected no error, got %v\n", err)
+	}
+	defer storage.Close(context.Background())
+	results = storage.StoreOperations([]*repository.InsertStruct{
+		{Id: "2", User: "user", OperationType: "withdraw", Amount: 40000, Currency: "USD", OccurredAt: day.Add(time.Hour)},
+		{Id: "3", User: "other", OperationType: "deposit", Amount: 30000, Currency: "EUR", OccurredAt: day.Add(24 * time.Hour)},
+	})
+	if !errors.Is(results[0], repository.ErrDuplicateOperation) || results[1] != nil {
+		t.Fatalf("expected duplicate, stored, got %v\n", results)
+	}
+
+	operations, total, err := storage.ListOperations(context.Background(), &repository.OperationFilter{User: "user", Limit: 1})
+	if err != nil || total != 2 || len(operations) != 1 || operations[0].Id != "2" {
+		t.Fatalf("expected the newest of 2 operations, got %v of %v, %v\n", operations, total, err)
+	}
+
+	// rollups are rebuilt from the file on open and updated incrementally,
+	// counting each operation once
+	for range 2 {
+		storage.UpdateRollups(context.Background(), []*repository.InsertStruct{
+			{Id: "2", User: "user", OperationType: "withdraw", Amount: 40000, Currency: "USD", OccurredAt: day.Add(time.Hour)},
+			{Id: "3", User: "other", OperationType: "deposit", Amount: 30000, Currency: "EUR", OccurredAt: day.Add(24 * time.Hour)},
+		})
+	}
+	rollups, err := storage.ListRollups(context.Background(), &repository.RollupFilter{Period: repository.PeriodMonth, Limit: 10})
+	if err != nil || len(rollups) != 3 || rollups[0].User != "other" || rollups[1].Total != 50000 || rollups[1].Count != 1 {
+		t.Fatalf("expected 3 monthly rollups, got %+v, %v\n", rollups, err)
+	}
+
+	totals, err := storage.DailyTotals(context.Background(), &repository.OperationFilter{Limit: 10})
+	if err != nil || len(totals) != 3 || totals[0].Day != "2025-03-02" || totals[1].Total != 50000 {
+		t.Fatalf("expected 3 daily totals, got %+v, %v\n", totals, err)
+	}
+}
+
+func TestRenameUsers(t *testing.T) {
+	dir := t.TempDir()
+	storage, err := file.NewOperationStorage(dir)
+	if err != nil {
+		t.Fatalf("expected no error, got %v\n", err)
+	}
+	ctx := context.Background()
+	day := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	storage.StoreOperations([]*repository.InsertStruct{
+		{Id: "1", User: "user", OperationType: "deposit", Amount: 100, Currency: "USD", OccurredAt: day},
+		{Id: "2", User: "other", OperationType: "deposit", Amount: 50, Currency: "USD", OccurredAt: day},
+	})
+	storage.StoreAlert(ctx, &repository.Alert{Id: "alert", User: "user", CreatedAt: day})
+	storage.SavePreferences(ctx, &repository.Preferences{User: "user", Email: "old@example.com"})
+	storage.SavePreferences(ctx, &repository.Preferences{User: "other", Email: "other@example.com"})
+	// preferences saved under the id after the switch win over the old ones
+	storage.SavePreferences(ctx, &repository.Preferences{User: "other-id", Email: "new@example.com"})
+	storage.AddDelivery(ctx, &repository.Delivery{Id: "delivery", User: "user", Status: repository.DeliveryPending, NextAttemptAt: day})
+
+	ids := map[string]string{"user": "user-id", "other": "other-id"}
+	for range 2 {
+		if err := storage.RenameUsers(ctx, ids); err != nil {
+			t.Fatalf("expected no error, got %v\n", err)
+		}
+	}
+	if err := storage.RebuildRollups(ctx); err != nil {
+		t.Fatalf("expected no error, got %v\n", err)
+	}
+	// appends after the rewrite go to the new files
+	storage.StoreOperations([]*repository.InsertStruct{
+		{Id: "3", User: "user-id", OperationType: "deposit", Amount: 10, Currency: "USD", OccurredAt: day},
+	})
+	storage.Close(ctx)
+
+	storage, err = file.NewOperationStorage(dir)
+	if err != nil {
+		t.Fatalf("expected no error, got %v\n", err)
+	}
+	defer storage.Close(ctx)
+
+	operations, total, err := storage.ListOperations(ctx, &repository.OperationFilter{User: "user-id", Limit: 10})
+	if err != nil || total != 2 {
+		t.Fatalf("expected 2 operations, got %v, %v\n", operations, err)
+	}
+	if _, total, _ := storage.ListOperations(ctx, &repository.OperationFilter{User: "user", Limit: 10}); total != 0 {
+		t.Fatalf("expected %v, got %v\n", 0, total)
+	}
+	rollups, err := storage.ListRollups(ctx, &repository.RollupFilter{Period: repository.PeriodDay, User: "user-id", Limit: 10})
+	if err != nil || len(rollups) != 1 || rollups[0].Total != 110 {
+		t.Fatalf("expected one rollup of 110, got %+v, %v\n", rollups, err)
+	}
+
+	tests := []struct {
+		user  string
+		email string
+		err   error
+	}{
+		{"user-id", "old@example.com", nil},
+		{"other-id", "new@example.com", nil},
+		{"user", "", repository.ErrPreferencesNotFound},
+		{"other", "", repository.ErrPreferencesNotFound},
+	}
+	for _, test := range tests {
+		preferences, err := storage.GetPreferences(ctx, test.user)
+		if !errors.Is(err, test.err) || (err == nil && preferences.Email != test.email) {
+			t.Fatalf("expected %v, %v for %v, got %+v, %v\n", test.email, test.err, test.user, preferences, err)
+		}
+	}
+
+	deliveries, err := storage.DueDeliveries(ctx, day, 10)
+	if err != nil || len(deliveries) != 1 || deliveries[0].User != "user-id" {
+		t.Fatalf("expected the delivery under the id, got %+v, %v\n", deliveries, err)
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, "alerts.ndjson"))
+	if !strings.Contains(string(data), `"user":"user-id"`) {
+		t.Fatalf("expected the alert under the id, got %s\n", data)
+	}
+}
@@ -0,0 +1,78 @@
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sort"
+	"time"
+
+	"gw-broker/internal/repository"
+)
+
+func (storage *OperationStorage) GetPreferences(ctx context.Context, user string) (*repository.Preferences, error) {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+	preferences, ok := storage.preferences[user]
+	if !ok {
+		return nil, repository.ErrPreferencesNotFound
+	}
+	return &preferences, nil
+}
+
+func (storage *OperationStorage) SavePreferences(ctx context.Context, preferences *repository.Preferences) error {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+	if err := storage.appendJSON(storage.preferencesLog, preferences); err != nil {
+		return err
+	}
+	storage.preferences[preferences.User] = *preferences
+	return nil
+}
+
+func (storage *OperationStorage) AddDelivery(ctx context.Context, delivery *repository.Delivery) error {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+	if _, ok := storage.deliveries[delivery.Id]; ok {
+		return repository.ErrDuplicateDelivery
+	}
+	return storage.saveDelivery(delivery)
+}
+
+func (storage *OperationStorage) UpdateDelivery(ctx context.Context, delivery *repository.Delivery) error {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+	return storage.saveDelivery(delivery)
+}
+
+func (storage *OperationStorage) DueDeliveries(ctx context.Context, now time.Time, limit int64) ([]repository.Delivery, error) {
+	storage.mu.Lock()
+	var due []repository.Delivery
+	for _, delivery := range storage.deliveries {
+		if delivery.Status == repository.DeliveryPending && !delivery.NextAttemptAt.After(now) {
+			due = append(due, delivery)
+		}
+	}
+	storage.mu.Unlock()
+
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].NextAttemptAt.Before(due[j].NextAttemptAt)
+	})
+	return page(due, &repository.OperationFilter{Limit: limit}), nil
+}
+
+func (storage *OperationStorage) saveDelivery(delivery *repository.Delivery) error {
+	if err := storage.appendJSON(storage.deliveriesLog, delivery); err != nil {
+		return err
+	}
+	storage.deliveries[delivery.Id] = *delivery
+	return nil
+}
+
+func (storage *OperationStorage) appendJSON(f *os.File, record any) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return storage.append(f, append(line, '\n'))
+}
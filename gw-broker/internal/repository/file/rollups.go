@@ -0,0 +1,92 @@
+package file
+
+import (
+	"context"
+	"sort"
+
+	"gw-broker/internal/repository"
+)
+
+// UpdateRollups adds the operations that are not in the rollups yet.
+func (storage *OperationStorage) UpdateRollups(ctx context.Context, operations []*repository.InsertStruct) error {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+	var pending []*repository.InsertStruct
+	for _, operation := range operations {
+		if !storage.rolledUp[operation.Id] {
+			storage.rolledUp[operation.Id] = true
+			pending = append(pending, operation)
+		}
+	}
+	storage.addRollups(repository.RollupsOf(pending))
+	return nil
+}
+
+// RebuildRollups reads the operations under the same lock it replaces the
+// rollups under, so an operation stored meanwhile is either read here or
+// added by UpdateRollups afterwards.
+func (storage *OperationStorage) RebuildRollups(ctx context.Context) error {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+	operations, err := storage.findLocked(&repository.OperationFilter{})
+	if err != nil {
+		return err
+	}
+	data := make([]*repository.InsertStruct, len(operations))
+	for i := range operations {
+		data[i] = &operations[i]
+	}
+
+	storage.rollups = map[rollupKey]*repository.Rollup{}
+	storage.rolledUp = map[string]bool{}
+	for _, operation := range data {
+		storage.rolledUp[operation.Id] = true
+	}
+	storage.addRollups(repository.RollupsOf(data))
+	return nil
+}
+
+func (storage *OperationStorage) addRollups(rollups []repository.Rollup) {
+	for _, rollup := range rollups {
+		k := rollupKey{rollup.Period, rollup.Key, rollup.User, rollup.OperationType, rollup.Currency}
+		if existing, ok := storage.rollups[k]; ok {
+			existing.Total += rollup.Total
+			existing.Count += rollup.Count
+			continue
+		}
+		storage.rollups[k] = &rollup
+	}
+}
+
+func (storage *OperationStorage) ListRollups(ctx context.Context, filter *repository.RollupFilter) ([]repository.Rollup, error) {
+	storage.mu.Lock()
+	var rollups []repository.Rollup
+	for _, rollup := range storage.rollups {
+		switch {
+		case rollup.Period != filter.Period:
+		case filter.User != "" && rollup.User != filter.User:
+		case filter.OperationType != "" && rollup.OperationType != filter.OperationType:
+		case filter.Currency != "" && rollup.Currency != filter.Currency:
+		case filter.From != "" && rollup.Key < filter.From:
+		case filter.To != "" && rollup.Key >= filter.To:
+		default:
+			rollups = append(rollups, *rollup)
+		}
+	}
+	storage.mu.Unlock()
+
+	sort.Slice(rollups, func(i, j int) bool {
+		a, b := rollups[i], rollups[j]
+		if a.Key != b.Key {
+			return a.Key > b.Key
+		}
+		if a.User != b.User {
+			return a.User < b.User
+		}
+		if a.OperationType != b.OperationType {
+			return a.OperationType < b.OperationType
+		}
+		return a.Currency < b.Currency
+	})
+	return page(rollups, &repository.OperationFilter{Limit: filter.Limit, Offset: filter.Offset}), nil
+}
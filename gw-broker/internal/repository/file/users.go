@@ -0,0 +1,146 @@
+package file
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// RenameUsers rewrites the operation and alert files with the ids in place
+// of the usernames and compacts the preference and delivery logs to their
+// renamed records. Each file is written next to the old one and renamed
+// over it, so a crash leaves either file whole; running it again finishes
+// the rest.
+func (storage *OperationStorage) RenameUsers(ctx context.Context, ids map[string]string) error {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	for _, log := range []struct {
+		target **os.File
+		name   string
+	}{
+		{&storage.operations, operationsFile},
+		{&storage.alerts, alertsFile},
+	} {
+		err := storage.replace(log.target, log.name, func(w *bufio.Writer) error {
+			var err error
+			scanErr := scan(*log.target, func(line []byte) {
+				if err == nil {
+					_, err = w.Write(append(renameUser(line, ids), '\n'))
+				}
+			})
+			if err != nil {
+				return err
+			}
+			return scanErr
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for name, preferences := range storage.preferences {
+		id, ok := ids[name]
+		if !ok {
+			continue
+		}
+		if _, exists := storage.preferences[id]; !exists {
+			preferences.User = id
+			storage.preferences[id] = preferences
+		}
+		delete(storage.preferences, name)
+	}
+	for key, delivery := range storage.deliveries {
+		if id, ok := ids[delivery.User]; ok {
+			delivery.User = id
+			storage.deliveries[key] = delivery
+		}
+	}
+	err := storage.replace(&storage.preferencesLog, preferencesFile, func(w *bufio.Writer) error {
+		for _, preferences := range storage.preferences {
+			if err := writeJSON(w, preferences); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return storage.replace(&storage.deliveriesLog, deliveriesFile, func(w *bufio.Writer) error {
+		for _, delivery := range storage.deliveries {
+			if err := writeJSON(w, delivery); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// renameUser replaces the "user" of a JSON record found in ids. Other
+// fields are kept as they are, and lines that are not JSON objects are
+// returned unchanged.
+func renameUser(line []byte, ids map[string]string) []byte {
+	var record map[string]json.RawMessage
+	var user string
+	if json.Unmarshal(line, &record) != nil || json.Unmarshal(record["user"], &user) != nil {
+		return line
+	}
+	id, ok := ids[user]
+	if !ok {
+		return line
+	}
+	record["user"], _ = json.Marshal(id)
+	renamed, err := json.Marshal(record)
+	if err != nil {
+		return line
+	}
+	return renamed
+}
+
+// replace writes a new version of the log and renames it over the old
+// one, then reopens it for appending in place of target.
+func (storage *OperationStorage) replace(target **os.File, name string, write func(w *bufio.Writer) error) error {
+	path := filepath.Join(storage.dir, name)
+	tmp, err := os.OpenFile(path+".tmp", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o640)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(tmp)
+	err = write(w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(path+".tmp", path)
+	}
+	if err != nil {
+		os.Remove(path + ".tmp")
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND, 0o640)
+	if err != nil {
+		return err
+	}
+	(*target).Close()
+	*target = f
+	return nil
+}
+
+func writeJSON(w *bufio.Writer, record any) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(line, '\n'))
+	return err
+}
@@ -0,0 +1,19 @@
+package mongodb
+
+import (
+	"context"
+
+	"gw-broker/internal/repository"
+
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// StoreAlert inserts the alert, or returns repository.ErrDuplicateAlert if
+// it was already raised.
+func (storage *OperationStorage) StoreAlert(ctx context.Context, alert *repository.Alert) error {
+	_, err := storage.Alerts.InsertOne(ctx, alert)
+	if mongo.IsDuplicateKeyError(err) {
+		return repository.ErrDuplicateAlert
+	}
+	return err
+}
@@ -2,17 +2,23 @@ package mongodb
 
 import (
 	"context"
+	"errors"
 
 	"gw-broker/internal/config"
 	"gw-broker/internal/repository"
 
+	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
 	"go.mongodb.org/mongo-driver/v2/mongo/options"
 	"go.mongodb.org/mongo-driver/v2/mongo/readpref"
 )
 
 type OperationStorage struct {
-	Collection *mongo.Collection
+	Collection  *mongo.Collection
+	Alerts      *mongo.Collection
+	Rollups     *mongo.Collection
+	Preferences *mongo.Collection
+	Deliveries  *mongo.Collection
 }
 
 func NewOperationStorage(cfg *config.Config) (*OperationStorage, error) {
@@ -27,15 +33,79 @@ func NewOperationStorage(cfg *config.Config) (*OperationStorage, error) {
 	}
 
 	storage := client.Database("transactions").Collection("operations")
+	_, err = storage.Indexes().CreateOne(context.TODO(), mongo.IndexModel{
+		Keys: bson.D{{Key: "user", Value: 1}, {Key: "occurred_at", Value: -1}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	alerts := storage.Database().Collection(cfg.MongoConn.AlertsCollection)
+	_, err = alerts.Indexes().CreateOne(context.TODO(), mongo.IndexModel{
+		Keys: bson.D{{Key: "user", Value: 1}, {Key: "created_at", Value: -1}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	rollups := storage.Database().Collection(cfg.MongoConn.RollupsCollection)
+	_, err = rollups.Indexes().CreateOne(context.TODO(), mongo.IndexModel{
+		Keys:    rollupKey,
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+	deliveries := storage.Database().Collection(cfg.MongoConn.DeliveriesCollection)
+	_, err = deliveries.Indexes().CreateOne(context.TODO(), mongo.IndexModel{
+		Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}},
+	})
+	if err != nil {
+		return nil, err
+	}
 	return &OperationStorage{
-		Collection: storage,
+		Collection:  storage,
+		Alerts:      alerts,
+		Rollups:     rollups,
+		Preferences: storage.Database().Collection(cfg.MongoConn.PreferencesCollection),
+		Deliveries:  deliveries,
 	}, nil
 }
 
-func (storage *OperationStorage) StoreOperation(data *repository.InsertStruct) error {
-	_, err := storage.Collection.InsertOne(context.Background(), &data)
-	if err != nil {
-		return err
+// StoreOperations inserts the operations under their event ids in one
+// unordered write, so one bad document does not stop the rest. The result
+// has an error per operation: nil when it was stored,
+// repository.ErrDuplicateOperation when it already was, or the write error.
+func (storage *OperationStorage) StoreOperations(data []*repository.InsertStruct) []error {
+	results := make([]error, len(data))
+	if len(data) == 0 {
+		return results
+	}
+
+	_, err := storage.Collection.InsertMany(context.Background(), data, options.InsertMany().SetOrdered(false))
+	if err == nil {
+		return results
+	}
+
+	var bulkErr mongo.BulkWriteException
+	if !errors.As(err, &bulkErr) || bulkErr.WriteConcernError != nil {
+		// nothing is known about individual documents
+		for i := range results {
+			results[i] = err
+		}
+		return results
+	}
+	for _, writeErr := range bulkErr.WriteErrors {
+		if writeErr.Index < 0 || writeErr.Index >= len(results) {
+			continue
+		}
+		if mongo.IsDuplicateKeyError(writeErr.WriteError) {
+			results[writeErr.Index] = repository.ErrDuplicateOperation
+		} else {
+			results[writeErr.Index] = writeErr.WriteError
+		}
 	}
-	return nil
+	return results
+}
+
+func (storage *OperationStorage) Close(ctx context.Context) error {
+	return storage.Collection.Database().Client().Disconnect(ctx)
 }
@@ -0,0 +1,58 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gw-broker/internal/repository"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+func (storage *OperationStorage) GetPreferences(ctx context.Context, user string) (*repository.Preferences, error) {
+	var preferences repository.Preferences
+	err := storage.Preferences.FindOne(ctx, bson.D{{Key: "_id", Value: user}}).Decode(&preferences)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, repository.ErrPreferencesNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &preferences, nil
+}
+
+func (storage *OperationStorage) SavePreferences(ctx context.Context, preferences *repository.Preferences) error {
+	_, err := storage.Preferences.ReplaceOne(ctx, bson.D{{Key: "_id", Value: preferences.User}}, preferences, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (storage *OperationStorage) AddDelivery(ctx context.Context, delivery *repository.Delivery) error {
+	_, err := storage.Deliveries.InsertOne(ctx, delivery)
+	if mongo.IsDuplicateKeyError(err) {
+		return repository.ErrDuplicateDelivery
+	}
+	return err
+}
+
+func (storage *OperationStorage) UpdateDelivery(ctx context.Context, delivery *repository.Delivery) error {
+	_, err := storage.Deliveries.ReplaceOne(ctx, bson.D{{Key: "_id", Value: delivery.Id}}, delivery)
+	return err
+}
+
+func (storage *OperationStorage) DueDeliveries(ctx context.Context, now time.Time, limit int64) ([]repository.Delivery, error) {
+	cursor, err := storage.Deliveries.Find(ctx, bson.D{
+		{Key: "status", Value: repository.DeliveryPending},
+		{Key: "next_attempt_at", Value: bson.D{{Key: "$lte", Value: now}}},
+	}, options.Find().SetSort(bson.D{{Key: "next_attempt_at", Value: 1}}).SetLimit(limit))
+	if err != nil {
+		return nil, err
+	}
+	deliveries := []repository.Delivery{}
+	if err := cursor.All(ctx, &deliveries); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
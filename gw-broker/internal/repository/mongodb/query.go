@@ -0,0 +1,101 @@
+package mongodb
+
+import (
+	"context"
+
+	"gw-broker/internal/repository"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+func (storage *OperationStorage) ListOperations(ctx context.Context, filter *repository.OperationFilter) ([]repository.InsertStruct, int64, error) {
+	query := operationQuery(filter)
+
+	total, err := storage.Collection.CountDocuments(ctx, query)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	cursor, err := storage.Collection.Find(ctx, query, options.Find().
+		SetSort(bson.D{{Key: "occurred_at", Value: -1}, {Key: "_id", Value: 1}}).
+		SetSkip(filter.Offset).
+		SetLimit(filter.Limit))
+	if err != nil {
+		return nil, 0, err
+	}
+	operations := []repository.InsertStruct{}
+	if err := cursor.All(ctx, &operations); err != nil {
+		return nil, 0, err
+	}
+	return operations, total, nil
+}
+
+func (storage *OperationStorage) DailyTotals(ctx context.Context, filter *repository.OperationFilter) ([]repository.DailyTotal, error) {
+	pipeline := bson.A{
+		bson.D{{Key: "$match", Value: operationQuery(filter)}},
+		bson.D{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: bson.D{
+				{Key: "user", Value: "$user"},
+				{Key: "day", Value: bson.D{{Key: "$dateToString", Value: bson.D{{Key: "format", Value: "%Y-%m-%d"}, {Key: "date", Value: "$occurred_at"}}}}},
+				{Key: "operation_type", Value: "$operation_type"},
+			}},
+			{Key: "total", Value: bson.D{{Key: "$sum", Value: "$amount"}}},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+		}}},
+		bson.D{{Key: "$project", Value: bson.D{
+			{Key: "_id", Value: 0},
+			{Key: "user", Value: "$_id.user"},
+			{Key: "day", Value: "$_id.day"},
+			{Key: "operation_type", Value: "$_id.operation_type"},
+			{Key: "total", Value: 1},
+			{Key: "count", Value: 1},
+		}}},
+		bson.D{{Key: "$sort", Value: bson.D{{Key: "day", Value: -1}, {Key: "user", Value: 1}, {Key: "operation_type", Value: 1}}}},
+		bson.D{{Key: "$skip", Value: filter.Offset}},
+		bson.D{{Key: "$limit", Value: filter.Limit}},
+	}
+
+	cursor, err := storage.Collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	totals := []repository.DailyTotal{}
+	if err := cursor.All(ctx, &totals); err != nil {
+		return nil, err
+	}
+	return totals, nil
+}
+
+func operationQuery(filter *repository.OperationFilter) bson.D {
+	query := bson.D{}
+	if filter.User != "" {
+		query = append(query, bson.E{Key: "user", Value: filter.User})
+	}
+	if filter.OperationType != "" {
+		query = append(query, bson.E{Key: "operation_type", Value: filter.OperationType})
+	}
+
+	amount := bson.D{}
+	if filter.MinAmount != nil {
+		amount = append(amount, bson.E{Key: "$gte", Value: *filter.MinAmount})
+	}
+	if filter.MaxAmount != nil {
+		amount = append(amount, bson.E{Key: "$lte", Value: *filter.MaxAmount})
+	}
+	if len(amount) > 0 {
+		query = append(query, bson.E{Key: "amount", Value: amount})
+	}
+
+	occurredAt := bson.D{}
+	if !filter.From.IsZero() {
+		occurredAt = append(occurredAt, bson.E{Key: "$gte", Value: filter.From})
+	}
+	if !filter.To.IsZero() {
+		occurredAt = append(occurredAt, bson.E{Key: "$lt", Value: filter.To})
+	}
+	if len(occurredAt) > 0 {
+		query = append(query, bson.E{Key: "occurred_at", Value: occurredAt})
+	}
+	return query
+}
@@ -0,0 +1,297 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+
+	"gw-broker/internal/repository"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// rollupKey identifies a rollup and is unique.
+var rollupKey = bson.D{
+	{Key: "period", Value: 1},
+	{Key: "key", Value: 1},
+	{Key: "user", Value: 1},
+	{Key: "operation_type", Value: 1},
+	{Key: "currency", Value: 1},
+}
+
+// periodFormats are the $dateToString formats of the period keys.
+var periodFormats = map[string]string{
+	repository.PeriodDay:   "%Y-%m-%d",
+	repository.PeriodMonth: "%Y-%m",
+}
+
+// appliedWindow is how many of the latest operation ids a rollup keeps, so
+// that an operation is counted once however often it is passed in. Retries
+// come back within minutes, long before a rollup sees that many newer
+// operations.
+const appliedWindow = 1000
+
+// UpdateRollups increments the rollups with upserts, so the first
+// operation of a period creates its rollup. Each operation is applied on
+// its own, guarded by the ids the rollup remembers: the update does not
+// match a rollup that already counts the operation, and its upsert then
+// hits the unique key.
+func (storage *OperationStorage) UpdateRollups(ctx context.Context, operations []*repository.InsertStruct) error {
+	if err := storage.notePending(ctx, operations); err != nil {
+		return err
+	}
+	var models []mongo.WriteModel
+	for _, operation := range operations {
+		for _, rollup := range repository.RollupsOf([]*repository.InsertStruct{operation}) {
+			filter := append(rollupFilter(&rollup), bson.E{Key: "applied", Value: bson.D{{Key: "$ne", Value: operation.Id}}})
+			models = append(models, mongo.NewUpdateOneModel().
+				SetFilter(filter).
+				SetUpdate(bson.D{
+					{Key: "$inc", Value: bson.D{
+						{Key: "total", Value: rollup.Total},
+						{Key: "count", Value: rollup.Count},
+					}},
+					{Key: "$push", Value: bson.D{{Key: "applied", Value: bson.D{
+						{Key: "$each", Value: bson.A{operation.Id}},
+						{Key: "$slice", Value: -appliedWindow},
+					}}}},
+				}).
+				SetUpsert(true))
+		}
+	}
+
+	// two operations creating the same rollup at once fail one upsert on
+	// the unique key without it being counted; run those once more, a
+	// second duplicate key means the rollup already counts the operation
+	for attempt := 0; attempt < 2 && len(models) > 0; attempt++ {
+		_, err := storage.Rollups.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+		if err == nil {
+			return nil
+		}
+		var bulkErr mongo.BulkWriteException
+		if !errors.As(err, &bulkErr) || bulkErr.WriteConcernError != nil {
+			return err
+		}
+		var retry []mongo.WriteModel
+		for _, writeErr := range bulkErr.WriteErrors {
+			if !mongo.IsDuplicateKeyError(writeErr.WriteError) {
+				return err
+			}
+			retry = append(retry, models[writeErr.Index])
+		}
+		models = retry
+	}
+	return nil
+}
+
+func rollupFilter(rollup *repository.Rollup) bson.D {
+	return bson.D{
+		{Key: "period", Value: rollup.Period},
+		{Key: "key", Value: rollup.Key},
+		{Key: "user", Value: rollup.User},
+		{Key: "operation_type", Value: rollup.OperationType},
+		{Key: "currency", Value: rollup.Currency},
+	}
+}
+
+// rebuildMarker is the document in the pending collection that says a
+// rebuild is running.
+const rebuildMarker = "rebuilding"
+
+// pending holds the ids of the operations UpdateRollups applied while a
+// rebuild was running, as those increments may go to the rollups the
+// rebuild is about to replace.
+func (storage *OperationStorage) pending() *mongo.Collection {
+	return storage.Rollups.Database().Collection(storage.Rollups.Name() + "_pending")
+}
+
+// notePending records the operations while a rebuild runs. It is done
+// before the rollups are incremented, so an increment that may be lost is
+// always noted first.
+func (storage *OperationStorage) notePending(ctx context.Context, operations []*repository.InsertStruct) error {
+	if len(operations) == 0 {
+		return nil
+	}
+	pending := storage.pending()
+	err := pending.FindOne(ctx, bson.D{{Key: "_id", Value: rebuildMarker}}).Err()
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	ids := make([]any, len(operations))
+	for i, operation := range operations {
+		ids[i] = bson.D{{Key: "_id", Value: operation.Id}}
+	}
+	_, err = pending.InsertMany(ctx, ids, options.InsertMany().SetOrdered(false))
+	var bulkErr mongo.BulkWriteException
+	if !errors.As(err, &bulkErr) || bulkErr.WriteConcernError != nil {
+		return err
+	}
+	// an operation noted twice is still noted
+	for _, writeErr := range bulkErr.WriteErrors {
+		if !mongo.IsDuplicateKeyError(writeErr.WriteError) {
+			return err
+		}
+	}
+	return nil
+}
+
+// RebuildRollups aggregates the rollups from the operations into a
+// separate collection and renames it over the rollups, so readers see the
+// old rollups until the new ones are complete. Operations stored without
+// occurred_at are left out. Increments made to the old rollups meanwhile
+// are lost with them, so the operations UpdateRollups noted during the
+// rebuild are applied again afterwards; the ids the rollups remember keep
+// the ones the aggregation already counted from being counted twice.
+func (storage *OperationStorage) RebuildRollups(ctx context.Context) error {
+	pending := storage.pending()
+	if err := pending.Drop(ctx); err != nil {
+		return err
+	}
+	if _, err := pending.InsertOne(ctx, bson.D{{Key: "_id", Value: rebuildMarker}}); err != nil {
+		return err
+	}
+	if err := storage.replaceRollups(ctx); err != nil {
+		pending.Drop(ctx)
+		return err
+	}
+	if err := storage.replayPending(ctx); err != nil {
+		// the marker stays, so operations keep being noted until the
+		// rebuild is run again
+		return err
+	}
+	return pending.Drop(ctx)
+}
+
+// replayPending applies the noted operations to the new rollups.
+func (storage *OperationStorage) replayPending(ctx context.Context) error {
+	cursor, err := storage.pending().Find(ctx, bson.D{{Key: "_id", Value: bson.D{{Key: "$ne", Value: rebuildMarker}}}})
+	if err != nil {
+		return err
+	}
+	var noted []struct {
+		Id string `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &noted); err != nil {
+		return err
+	}
+	if len(noted) == 0 {
+		return nil
+	}
+	ids := make([]string, len(noted))
+	for i, note := range noted {
+		ids[i] = note.Id
+	}
+	cursor, err = storage.Collection.Find(ctx, bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}})
+	if err != nil {
+		return err
+	}
+	var operations []*repository.InsertStruct
+	if err := cursor.All(ctx, &operations); err != nil {
+		return err
+	}
+	return storage.UpdateRollups(ctx, operations)
+}
+
+// replaceRollups builds the rollups into a separate collection and renames
+// it over the rollups.
+func (storage *OperationStorage) replaceRollups(ctx context.Context) error {
+	database := storage.Rollups.Database()
+	rebuild := database.Collection(storage.Rollups.Name() + "_rebuild")
+	if err := rebuild.Drop(ctx); err != nil {
+		return err
+	}
+	_, err := rebuild.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    rollupKey,
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, period := range repository.Periods {
+		pipeline := bson.A{
+			bson.D{{Key: "$match", Value: bson.D{{Key: "occurred_at", Value: bson.D{{Key: "$type", Value: "date"}}}}}},
+			bson.D{{Key: "$sort", Value: bson.D{{Key: "occurred_at", Value: 1}}}},
+			bson.D{{Key: "$group", Value: bson.D{
+				{Key: "_id", Value: bson.D{
+					{Key: "key", Value: bson.D{{Key: "$dateToString", Value: bson.D{{Key: "format", Value: periodFormats[period]}, {Key: "date", Value: "$occurred_at"}}}}},
+					{Key: "user", Value: "$user"},
+					{Key: "operation_type", Value: "$operation_type"},
+					{Key: "currency", Value: bson.D{{Key: "$ifNull", Value: bson.A{"$currency", ""}}}},
+				}},
+				{Key: "total", Value: bson.D{{Key: "$sum", Value: "$amount"}}},
+				{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+				{Key: "applied", Value: bson.D{{Key: "$push", Value: "$_id"}}},
+			}}},
+			bson.D{{Key: "$project", Value: bson.D{
+				{Key: "_id", Value: 0},
+				{Key: "period", Value: bson.D{{Key: "$literal", Value: period}}},
+				{Key: "key", Value: "$_id.key"},
+				{Key: "user", Value: "$_id.user"},
+				{Key: "operation_type", Value: "$_id.operation_type"},
+				{Key: "currency", Value: "$_id.currency"},
+				{Key: "total", Value: 1},
+				{Key: "count", Value: 1},
+				{Key: "applied", Value: bson.D{{Key: "$slice", Value: bson.A{"$applied", -appliedWindow}}}},
+			}}},
+			bson.D{{Key: "$merge", Value: bson.D{
+				{Key: "into", Value: rebuild.Name()},
+				{Key: "on", Value: bson.A{"period", "key", "user", "operation_type", "currency"}},
+				{Key: "whenMatched", Value: "replace"},
+				{Key: "whenNotMatched", Value: "insert"},
+			}}},
+		}
+		cursor, err := storage.Collection.Aggregate(ctx, pipeline)
+		if err != nil {
+			return err
+		}
+		cursor.Close(ctx)
+	}
+
+	return database.Client().Database("admin").RunCommand(ctx, bson.D{
+		{Key: "renameCollection", Value: database.Name() + "." + rebuild.Name()},
+		{Key: "to", Value: database.Name() + "." + storage.Rollups.Name()},
+		{Key: "dropTarget", Value: true},
+	}).Err()
+}
+
+func (storage *OperationStorage) ListRollups(ctx context.Context, filter *repository.RollupFilter) ([]repository.Rollup, error) {
+	query := bson.D{{Key: "period", Value: filter.Period}}
+	if filter.User != "" {
+		query = append(query, bson.E{Key: "user", Value: filter.User})
+	}
+	if filter.OperationType != "" {
+		query = append(query, bson.E{Key: "operation_type", Value: filter.OperationType})
+	}
+	if filter.Currency != "" {
+		query = append(query, bson.E{Key: "currency", Value: filter.Currency})
+	}
+	key := bson.D{}
+	if filter.From != "" {
+		key = append(key, bson.E{Key: "$gte", Value: filter.From})
+	}
+	if filter.To != "" {
+		key = append(key, bson.E{Key: "$lt", Value: filter.To})
+	}
+	if len(key) > 0 {
+		query = append(query, bson.E{Key: "key", Value: key})
+	}
+
+	cursor, err := storage.Rollups.Find(ctx, query, options.Find().
+		SetProjection(bson.D{{Key: "_id", Value: 0}, {Key: "applied", Value: 0}}).
+		SetSort(bson.D{{Key: "key", Value: -1}, {Key: "user", Value: 1}, {Key: "operation_type", Value: 1}, {Key: "currency", Value: 1}}).
+		SetSkip(filter.Offset).
+		SetLimit(filter.Limit))
+	if err != nil {
+		return nil, err
+	}
+	rollups := []repository.Rollup{}
+	if err := cursor.All(ctx, &rollups); err != nil {
+		return nil, err
+	}
+	return rollups, nil
+}
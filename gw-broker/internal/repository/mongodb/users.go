@@ -0,0 +1,53 @@
+package mongodb
+
+import (
+	"context"
+
+	"gw-broker/internal/repository"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// RenameUsers updates each collection in one unordered bulk write.
+// Preferences are keyed by the user, so they are copied under the id and
+// the old document is removed. A failed run can be repeated.
+func (storage *OperationStorage) RenameUsers(ctx context.Context, ids map[string]string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(ids))
+	var models []mongo.WriteModel
+	for name, id := range ids {
+		names = append(names, name)
+		models = append(models, mongo.NewUpdateManyModel().
+			SetFilter(bson.D{{Key: "user", Value: name}}).
+			SetUpdate(bson.D{{Key: "$set", Value: bson.D{{Key: "user", Value: id}}}}))
+	}
+	for _, collection := range []*mongo.Collection{storage.Collection, storage.Alerts, storage.Deliveries} {
+		if _, err := collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false)); err != nil {
+			return err
+		}
+	}
+
+	cursor, err := storage.Preferences.Find(ctx, bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: names}}}})
+	if err != nil {
+		return err
+	}
+	var stored []repository.Preferences
+	if err := cursor.All(ctx, &stored); err != nil {
+		return err
+	}
+	for _, preferences := range stored {
+		name := preferences.User
+		preferences.User = ids[name]
+		if _, err := storage.Preferences.InsertOne(ctx, preferences); err != nil && !mongo.IsDuplicateKeyError(err) {
+			return err
+		}
+		if _, err := storage.Preferences.DeleteOne(ctx, bson.D{{Key: "_id", Value: name}}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,2 @@
+drop table if exists alerts;
+drop table if exists operations;
@@ -0,0 +1,24 @@
+create table if not exists operations (
+    id text primary key,
+    schema_version integer not null,
+    username text not null,
+    operation_type text not null,
+    amount double precision not null,
+    currency text not null default '',
+    target_currency text not null default '',
+    occurred_at timestamptz not null
+);
+
+create index if not exists operations_user_occurred_at on operations (username, occurred_at desc);
+
+create table if not exists alerts (
+    id text primary key,
+    rule text not null,
+    username text not null,
+    event_id text not null,
+    related_ids text[] not null default '{}',
+    reason text not null,
+    created_at timestamptz not null
+);
+
+create index if not exists alerts_user_created_at on alerts (username, created_at desc);
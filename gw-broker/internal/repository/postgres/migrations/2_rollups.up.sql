@@ -0,0 +1,10 @@
+create table if not exists rollups (
+    period text not null,
+    period_key text not null,
+    username text not null,
+    operation_type text not null,
+    currency text not null,
+    total double precision not null,
+    count bigint not null,
+    primary key (period, period_key, username, operation_type, currency)
+);
@@ -0,0 +1,2 @@
+drop table if exists deliveries;
+drop table if exists preferences;
@@ -0,0 +1,27 @@
+create table if not exists preferences (
+    username text primary key,
+    email text not null default '',
+    webhook_url text not null default '',
+    channels text[] not null default '{}',
+    types text[] not null default '{}',
+    min_amount double precision not null default 0,
+    updated_at timestamptz not null
+);
+
+create table if not exists deliveries (
+    id text primary key,
+    event_id text not null,
+    username text not null,
+    channel text not null,
+    recipient text not null,
+    subject text not null,
+    body text not null,
+    status text not null,
+    attempts integer not null,
+    last_error text not null default '',
+    next_attempt_at timestamptz not null,
+    created_at timestamptz not null,
+    updated_at timestamptz not null
+);
+
+create index if not exists deliveries_due on deliveries (next_attempt_at) where status = 'pending';
@@ -0,0 +1,3 @@
+-- operations stored so far are already in the rollups
+alter table operations add column rolled_up boolean not null default true;
+alter table operations alter column rolled_up set default false;
@@ -0,0 +1,3 @@
+alter table preferences drop column if exists email_code_expires_at;
+alter table preferences drop column if exists email_code_hash;
+alter table preferences drop column if exists pending_email;
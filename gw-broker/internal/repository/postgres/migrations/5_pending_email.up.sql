@@ -0,0 +1,4 @@
+-- addresses saved before verification existed stay in use
+alter table preferences add column pending_email text not null default '';
+alter table preferences add column email_code_hash text not null default '';
+alter table preferences add column email_code_expires_at timestamptz not null default '0001-01-01 00:00:00+00';
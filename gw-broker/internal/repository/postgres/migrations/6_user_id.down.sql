@@ -0,0 +1,5 @@
+alter table deliveries rename column user_id to username;
+alter table preferences rename column user_id to username;
+alter table rollups rename column user_id to username;
+alter table alerts rename column user_id to username;
+alter table operations rename column user_id to username;
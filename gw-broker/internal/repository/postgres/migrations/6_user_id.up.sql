@@ -0,0 +1,6 @@
+-- the columns hold user ids since the wallet moved to them
+alter table operations rename column username to user_id;
+alter table alerts rename column username to user_id;
+alter table rollups rename column username to user_id;
+alter table preferences rename column username to user_id;
+alter table deliveries rename column username to user_id;
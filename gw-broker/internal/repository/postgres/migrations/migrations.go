@@ -0,0 +1,10 @@
+// Package migrations embeds the SQL migrations of the broker's postgres
+// storage, they are applied with gw-shared/migrate. The first ones create
+// their tables only if missing, so databases set up before the migrations
+// existed are taken over as they are.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var Files embed.FS
@@ -0,0 +1,94 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gw-broker/internal/repository"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func (storage *OperationStorage) GetPreferences(ctx context.Context, user string) (*repository.Preferences, error) {
+	var preferences repository.Preferences
+	err := storage.db.QueryRow(ctx, `select user_id, email, pending_email, email_code_hash, email_code_expires_at,
+		webhook_url, channels, types, min_amount, updated_at
+		from preferences where user_id = $1`, user).Scan(&preferences.User, &preferences.Email, &preferences.PendingEmail,
+		&preferences.EmailCodeHash, &preferences.EmailCodeExpiresAt, &preferences.WebhookURL,
+		&preferences.Channels, &preferences.Types, &preferences.MinAmount, &preferences.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, repository.ErrPreferencesNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &preferences, nil
+}
+
+func (storage *OperationStorage) SavePreferences(ctx context.Context, preferences *repository.Preferences) error {
+	_, err := storage.db.Exec(ctx, `insert into preferences (user_id, email, pending_email, email_code_hash,
+		email_code_expires_at, webhook_url, channels, types, min_amount, updated_at)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		on conflict (user_id) do update set email = excluded.email, pending_email = excluded.pending_email,
+		email_code_hash = excluded.email_code_hash, email_code_expires_at = excluded.email_code_expires_at,
+		webhook_url = excluded.webhook_url, channels = excluded.channels, types = excluded.types,
+		min_amount = excluded.min_amount, updated_at = excluded.updated_at`,
+		preferences.User, preferences.Email, preferences.PendingEmail, preferences.EmailCodeHash,
+		preferences.EmailCodeExpiresAt, preferences.WebhookURL, nonNil(preferences.Channels), nonNil(preferences.Types),
+		preferences.MinAmount, preferences.UpdatedAt)
+	return err
+}
+
+func (storage *OperationStorage) AddDelivery(ctx context.Context, delivery *repository.Delivery) error {
+	tag, err := storage.db.Exec(ctx, `insert into deliveries (id, event_id, user_id, channel, recipient, subject, body,
+		status, attempts, last_error, next_attempt_at, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13) on conflict (id) do nothing`,
+		delivery.Id, delivery.EventId, delivery.User, delivery.Channel, delivery.Recipient, delivery.Subject, delivery.Body,
+		delivery.Status, delivery.Attempts, delivery.LastError, delivery.NextAttemptAt, delivery.CreatedAt, delivery.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return repository.ErrDuplicateDelivery
+	}
+	return nil
+}
+
+func (storage *OperationStorage) UpdateDelivery(ctx context.Context, delivery *repository.Delivery) error {
+	_, err := storage.db.Exec(ctx, `update deliveries set status = $2, attempts = $3, last_error = $4,
+		next_attempt_at = $5, updated_at = $6 where id = $1`,
+		delivery.Id, delivery.Status, delivery.Attempts, delivery.LastError, delivery.NextAttemptAt, delivery.UpdatedAt)
+	return err
+}
+
+func (storage *OperationStorage) DueDeliveries(ctx context.Context, now time.Time, limit int64) ([]repository.Delivery, error) {
+	rows, err := storage.db.Query(ctx, `select id, event_id, user_id, channel, recipient, subject, body,
+		status, attempts, last_error, next_attempt_at, created_at, updated_at
+		from deliveries where status = $1 and next_attempt_at <= $2 order by next_attempt_at limit $3`,
+		repository.DeliveryPending, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []repository.Delivery{}
+	for rows.Next() {
+		var delivery repository.Delivery
+		err := rows.Scan(&delivery.Id, &delivery.EventId, &delivery.User, &delivery.Channel, &delivery.Recipient,
+			&delivery.Subject, &delivery.Body, &delivery.Status, &delivery.Attempts, &delivery.LastError,
+			&delivery.NextAttemptAt, &delivery.CreatedAt, &delivery.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
@@ -0,0 +1,176 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"gw-broker/internal/repository"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type OperationStorage struct {
+	db *pgxpool.Pool
+}
+
+// NewOperationStorage expects the tables from the migrations package, see
+// the "migrate" subcommand and STORAGE_POSTGRES_AUTO_MIGRATE.
+func NewOperationStorage(connStr string) (*OperationStorage, error) {
+	pool, err := pgxpool.New(context.Background(), connStr)
+	if err != nil {
+		return nil, err
+	}
+	return &OperationStorage{db: pool}, nil
+}
+
+// StoreOperations inserts the batch in one round trip. The batch runs in a
+// single implicit transaction, so a failure fails every operation in it.
+func (storage *OperationStorage) StoreOperations(data []*repository.InsertStruct) []error {
+	results := make([]error, len(data))
+	if len(data) == 0 {
+		return results
+	}
+
+	batch := &pgx.Batch{}
+	for _, operation := range data {
+		batch.Queue(`insert into operations (id, schema_version, user_id, operation_type, amount, currency, target_currency, occurred_at)
+			values ($1, $2, $3, $4, $5, $6, $7, $8) on conflict (id) do nothing`,
+			operation.Id, operation.SchemaVersion, operation.User, operation.OperationType,
+			operation.Amount, operation.Currency, operation.TargetCurrency, operation.OccurredAt)
+	}
+
+	batchResults := storage.db.SendBatch(context.Background(), batch)
+	tags := make([]pgconn.CommandTag, len(data))
+	var err error
+	for i := range data {
+		tags[i], err = batchResults.Exec()
+		if err != nil {
+			break
+		}
+	}
+	if closeErr := batchResults.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		for i := range results {
+			results[i] = err
+		}
+		return results
+	}
+
+	for i, tag := range tags {
+		if tag.RowsAffected() == 0 {
+			results[i] = repository.ErrDuplicateOperation
+		}
+	}
+	return results
+}
+
+func (storage *OperationStorage) StoreAlert(ctx context.Context, alert *repository.Alert) error {
+	tag, err := storage.db.Exec(ctx, `insert into alerts (id, rule, user_id, event_id, related_ids, reason, created_at)
+		values ($1, $2, $3, $4, $5, $6, $7) on conflict (id) do nothing`,
+		alert.Id, alert.Rule, alert.User, alert.EventId, nonNil(alert.RelatedIds), alert.Reason, alert.CreatedAt)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return repository.ErrDuplicateAlert
+	}
+	return nil
+}
+
+func (storage *OperationStorage) ListOperations(ctx context.Context, filter *repository.OperationFilter) ([]repository.InsertStruct, int64, error) {
+	where, args := operationQuery(filter)
+
+	var total int64
+	err := storage.db.QueryRow(ctx, "select count(*) from operations"+where, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	args = append(args, filter.Limit, filter.Offset)
+	rows, err := storage.db.Query(ctx, fmt.Sprintf(`select id, schema_version, user_id, operation_type, amount, currency, target_currency, occurred_at
+		from operations%s order by occurred_at desc, id limit $%d offset $%d`, where, len(args)-1, len(args)), args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	operations := []repository.InsertStruct{}
+	for rows.Next() {
+		var operation repository.InsertStruct
+		err := rows.Scan(&operation.Id, &operation.SchemaVersion, &operation.User, &operation.OperationType,
+			&operation.Amount, &operation.Currency, &operation.TargetCurrency, &operation.OccurredAt)
+		if err != nil {
+			return nil, 0, err
+		}
+		operation.OccurredAt = operation.OccurredAt.UTC()
+		operations = append(operations, operation)
+	}
+	return operations, total, rows.Err()
+}
+
+func (storage *OperationStorage) DailyTotals(ctx context.Context, filter *repository.OperationFilter) ([]repository.DailyTotal, error) {
+	where, args := operationQuery(filter)
+	args = append(args, filter.Limit, filter.Offset)
+	rows, err := storage.db.Query(ctx, fmt.Sprintf(`select user_id, to_char(occurred_at at time zone 'UTC', 'YYYY-MM-DD') as day, operation_type, sum(amount), count(*)
+		from operations%s group by user_id, day, operation_type
+		order by day desc, user_id, operation_type limit $%d offset $%d`, where, len(args)-1, len(args)), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	totals := []repository.DailyTotal{}
+	for rows.Next() {
+		var total repository.DailyTotal
+		if err := rows.Scan(&total.User, &total.Day, &total.OperationType, &total.Total, &total.Count); err != nil {
+			return nil, err
+		}
+		totals = append(totals, total)
+	}
+	return totals, rows.Err()
+}
+
+func (storage *OperationStorage) Close(ctx context.Context) error {
+	storage.db.Close()
+	return nil
+}
+
+// operationQuery builds the where clause for a filter, with numbered
+// arguments starting at $1.
+func operationQuery(filter *repository.OperationFilter) (string, []any) {
+	var conditions []string
+	var args []any
+	add := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.User != "" {
+		add("user_id = $%d", filter.User)
+	}
+	if filter.OperationType != "" {
+		add("operation_type = $%d", filter.OperationType)
+	}
+	if filter.MinAmount != nil {
+		add("amount >= $%d", *filter.MinAmount)
+	}
+	if filter.MaxAmount != nil {
+		add("amount <= $%d", *filter.MaxAmount)
+	}
+	if !filter.From.IsZero() {
+		add("occurred_at >= $%d", filter.From)
+	}
+	if !filter.To.IsZero() {
+		add("occurred_at < $%d", filter.To)
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return " where " + strings.Join(conditions, " and "), args
+}
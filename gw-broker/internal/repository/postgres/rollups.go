@@ -0,0 +1,156 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gw-broker/internal/repository"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// periodFormats are the to_char formats of the period keys.
+var periodFormats = map[string]string{
+	repository.PeriodDay:   "YYYY-MM-DD",
+	repository.PeriodMonth: "YYYY-MM",
+}
+
+// UpdateRollups marks the operations rolled up and adds the ones that were
+// not yet to their rollups, in one transaction.
+func (storage *OperationStorage) UpdateRollups(ctx context.Context, operations []*repository.InsertStruct) error {
+	ids := make([]string, len(operations))
+	for i, operation := range operations {
+		ids[i] = operation.Id
+	}
+	tx, err := storage.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `update operations set rolled_up = true where id = any($1) and not rolled_up
+		returning id, user_id, operation_type, amount, currency, occurred_at`, ids)
+	if err != nil {
+		return err
+	}
+	pending, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*repository.InsertStruct, error) {
+		operation := new(repository.InsertStruct)
+		err := row.Scan(&operation.Id, &operation.User, &operation.OperationType, &operation.Amount, &operation.Currency, &operation.OccurredAt)
+		return operation, err
+	})
+	if err != nil {
+		return err
+	}
+
+	rollups := repository.RollupsOf(pending)
+	if len(rollups) == 0 {
+		return nil
+	}
+	batch := &pgx.Batch{}
+	for _, rollup := range rollups {
+		batch.Queue(`insert into rollups (period, period_key, user_id, operation_type, currency, total, count)
+			values ($1, $2, $3, $4, $5, $6, $7)
+			on conflict (period, period_key, user_id, operation_type, currency)
+			do update set total = rollups.total + excluded.total, count = rollups.count + excluded.count`,
+			rollup.Period, rollup.Key, rollup.User, rollup.OperationType, rollup.Currency, rollup.Total, rollup.Count)
+	}
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// serializationFailure is the error of a REPEATABLE READ transaction that
+// would overwrite a newer change.
+const serializationFailure = "40001"
+
+// rebuildAttempts is how often RebuildRollups starts over after a
+// concurrent UpdateRollups made its snapshot stale.
+const rebuildAttempts = 3
+
+// RebuildRollups replaces the rollups in one transaction, so readers never
+// see them half built, and marks every operation rolled up. The transaction
+// is REPEATABLE READ, so the flags and the sums come from the same
+// operations: one stored meanwhile is neither marked nor counted and is
+// left to UpdateRollups.
+func (storage *OperationStorage) RebuildRollups(ctx context.Context) error {
+	var err error
+	for attempt := 0; attempt < rebuildAttempts; attempt++ {
+		var pgErr *pgconn.PgError
+		if err = storage.rebuildRollups(ctx); !errors.As(err, &pgErr) || pgErr.Code != serializationFailure {
+			return err
+		}
+	}
+	return err
+}
+
+func (storage *OperationStorage) rebuildRollups(ctx context.Context) error {
+	tx, err := storage.db.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, "update operations set rolled_up = true where not rolled_up"); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, "delete from rollups"); err != nil {
+		return err
+	}
+	for _, period := range repository.Periods {
+		_, err := tx.Exec(ctx, `insert into rollups (period, period_key, user_id, operation_type, currency, total, count)
+			select $1, to_char(occurred_at at time zone 'UTC', $2), user_id, operation_type, currency, sum(amount), count(*)
+			from operations group by 2, user_id, operation_type, currency`, period, periodFormats[period])
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+func (storage *OperationStorage) ListRollups(ctx context.Context, filter *repository.RollupFilter) ([]repository.Rollup, error) {
+	conditions := []string{"period = $1"}
+	args := []any{filter.Period}
+	add := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if filter.User != "" {
+		add("user_id = $%d", filter.User)
+	}
+	if filter.OperationType != "" {
+		add("operation_type = $%d", filter.OperationType)
+	}
+	if filter.Currency != "" {
+		add("currency = $%d", filter.Currency)
+	}
+	if filter.From != "" {
+		add("period_key >= $%d", filter.From)
+	}
+	if filter.To != "" {
+		add("period_key < $%d", filter.To)
+	}
+	args = append(args, filter.Limit, filter.Offset)
+
+	rows, err := storage.db.Query(ctx, fmt.Sprintf(`select period, period_key, user_id, operation_type, currency, total, count
+		from rollups where %s order by period_key desc, user_id, operation_type, currency limit $%d offset $%d`,
+		strings.Join(conditions, " and "), len(args)-1, len(args)), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rollups := []repository.Rollup{}
+	for rows.Next() {
+		var rollup repository.Rollup
+		err := rows.Scan(&rollup.Period, &rollup.Key, &rollup.User, &rollup.OperationType, &rollup.Currency, &rollup.Total, &rollup.Count)
+		if err != nil {
+			return nil, err
+		}
+		rollups = append(rollups, rollup)
+	}
+	return rollups, rows.Err()
+}
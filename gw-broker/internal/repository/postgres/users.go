@@ -0,0 +1,37 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// RenameUsers rewrites every table in one transaction, so a failed run
+// leaves nothing half moved.
+func (storage *OperationStorage) RenameUsers(ctx context.Context, ids map[string]string) error {
+	names := make([]string, 0, len(ids))
+	userIds := make([]string, 0, len(ids))
+	for name, id := range ids {
+		names = append(names, name)
+		userIds = append(userIds, id)
+	}
+	tx, err := storage.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	batch := &pgx.Batch{}
+	batch.Queue(`create temporary table user_ids (username text primary key, id text not null) on commit drop`)
+	batch.Queue(`insert into user_ids (username, id) select * from unnest($1::text[], $2::text[])`, names, userIds)
+	for _, table := range []string{"operations", "alerts", "deliveries"} {
+		batch.Queue(`update ` + table + ` t set user_id = u.id from user_ids u where t.user_id = u.username`)
+	}
+	batch.Queue(`update preferences p set user_id = u.id from user_ids u
+		where p.user_id = u.username and not exists (select 1 from preferences q where q.user_id = u.id)`)
+	batch.Queue(`delete from preferences p using user_ids u where p.user_id = u.username`)
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
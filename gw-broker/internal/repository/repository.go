@@ -1,12 +1,231 @@
 package repository
 
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrDuplicateOperation means an operation with the same id is already
+// stored, i.e. the event was delivered more than once.
+var ErrDuplicateOperation = errors.New("operation already stored")
+
+// ErrDuplicateAlert means the alert was already raised for the same event.
+var ErrDuplicateAlert = errors.New("alert already stored")
+
+var (
+	// ErrDuplicateDelivery means the notification was already queued.
+	ErrDuplicateDelivery = errors.New("delivery already queued")
+	// ErrPreferencesNotFound means the user never set notification
+	// preferences.
+	ErrPreferencesNotFound = errors.New("notification preferences not found")
+)
+
+// Repository is implemented by every storage backend: mongodb, postgres and
+// file, selected with STORAGE_TYPE.
 type Repository interface {
-	StoreOperation(id string, amount string) error
+	// StoreOperations writes a batch and returns an error per operation:
+	// nil when it was stored, ErrDuplicateOperation when it already was, or
+	// the write error.
+	StoreOperations(data []*InsertStruct) []error
+	// StoreAlert returns ErrDuplicateAlert for an alert that already exists.
+	StoreAlert(ctx context.Context, alert *Alert) error
+	RollupWriter
+	OperationReader
+	NotificationStore
+	// RenameUsers moves operations, alerts, deliveries and preferences
+	// stored under a username in ids, which maps usernames to user ids, to
+	// the id. Preferences already saved under the id are kept. Rollups are
+	// left alone, rebuild them afterwards.
+	RenameUsers(ctx context.Context, ids map[string]string) error
+	Close(ctx context.Context) error
 }
+
+// PreferenceStore keeps notification preferences; GetPreferences returns
+// ErrPreferencesNotFound for a user without any.
+type PreferenceStore interface {
+	GetPreferences(ctx context.Context, user string) (*Preferences, error)
+	SavePreferences(ctx context.Context, preferences *Preferences) error
+}
+
+// NotificationStore keeps notification preferences and the deliveries the
+// dispatcher works through.
+type NotificationStore interface {
+	PreferenceStore
+	// AddDelivery queues a delivery, or returns ErrDuplicateDelivery.
+	AddDelivery(ctx context.Context, delivery *Delivery) error
+	UpdateDelivery(ctx context.Context, delivery *Delivery) error
+	// DueDeliveries returns pending deliveries whose next attempt is not
+	// after now, oldest first.
+	DueDeliveries(ctx context.Context, now time.Time, limit int64) ([]Delivery, error)
+}
+
+// RollupWriter maintains the daily and monthly rollups.
+type RollupWriter interface {
+	// UpdateRollups adds stored operations to their rollups. Operations it
+	// has already counted are skipped, so it can be called again for the
+	// same operations after a failure or a redelivery.
+	UpdateRollups(ctx context.Context, operations []*InsertStruct) error
+	// RebuildRollups regenerates every rollup from the stored operations.
+	RebuildRollups(ctx context.Context) error
+}
+
+// OperationReader is the read side used by the query API.
+type OperationReader interface {
+	ListOperations(ctx context.Context, filter *OperationFilter) ([]InsertStruct, int64, error)
+	DailyTotals(ctx context.Context, filter *OperationFilter) ([]DailyTotal, error)
+	ListRollups(ctx context.Context, filter *RollupFilter) ([]Rollup, error)
+}
+
+// InsertStruct is a stored wallet event. Documents written before the
+// versioned schema have no currency and carry their time as a "timestamp"
+// string next to occurred_at.
 type InsertStruct struct {
-	Id            string  `bson:"_id"`
+	Id             string    `bson:"_id" json:"id"`
+	SchemaVersion  int       `bson:"schema_version" json:"schema_version"`
+	User           string    `bson:"user" json:"user"`
+	OperationType  string    `bson:"operation_type" json:"operation_type"`
+	Amount         float64   `bson:"amount" json:"amount"`
+	Currency       string    `bson:"currency" json:"currency"`
+	TargetCurrency string    `bson:"target_currency,omitempty" json:"target_currency,omitempty"`
+	OccurredAt     time.Time `bson:"occurred_at" json:"occurred_at"`
+}
+
+// OperationFilter narrows a query. Zero values mean no restriction, except
+// Limit which is always applied.
+type OperationFilter struct {
+	User          string
+	OperationType string
+	MinAmount     *float64
+	MaxAmount     *float64
+	From          time.Time
+	To            time.Time
+	Limit         int64
+	Offset        int64
+}
+
+// DailyTotal is the sum of one user's operations of one type on one UTC day.
+type DailyTotal struct {
 	User          string  `bson:"user"`
+	Day           string  `bson:"day"`
 	OperationType string  `bson:"operation_type"`
-	Amount        float64 `bson:"amount"`
-	Timestamp     string  `bson:"timestamp"`
+	Total         float64 `bson:"total"`
+	Count         int64   `bson:"count"`
+}
+
+// Alert is raised by a risk rule for one operation. Its id is derived from
+// the rule and the operation, so evaluating a redelivered event again does
+// not raise a second alert.
+type Alert struct {
+	Id         string    `bson:"_id" json:"id"`
+	Rule       string    `bson:"rule" json:"rule"`
+	User       string    `bson:"user" json:"user"`
+	EventId    string    `bson:"event_id" json:"event_id"`
+	RelatedIds []string  `bson:"related_ids" json:"related_ids"`
+	Reason     string    `bson:"reason" json:"reason"`
+	CreatedAt  time.Time `bson:"created_at" json:"created_at"`
+}
+
+const (
+	PeriodDay   = "day"
+	PeriodMonth = "month"
+)
+
+// Periods lists the periods rollups are kept for.
+var Periods = []string{PeriodDay, PeriodMonth}
+
+// PeriodKey is the UTC day (2006-01-02) or month (2006-01) t falls in.
+func PeriodKey(period string, t time.Time) string {
+	if period == PeriodMonth {
+		return t.UTC().Format("2006-01")
+	}
+	return t.UTC().Format(time.DateOnly)
+}
+
+// Rollup is the total of one user's operations of one type and currency in
+// one day or month.
+type Rollup struct {
+	Period        string  `bson:"period" json:"period"`
+	Key           string  `bson:"key" json:"key"`
+	User          string  `bson:"user" json:"user"`
+	OperationType string  `bson:"operation_type" json:"operation_type"`
+	Currency      string  `bson:"currency" json:"currency"`
+	Total         float64 `bson:"total" json:"total"`
+	Count         int64   `bson:"count" json:"count"`
+}
+
+// RollupFilter selects rollups of one period. From and To are period keys;
+// To is exclusive. Empty strings mean no restriction, except Limit which is
+// always applied.
+type RollupFilter struct {
+	Period        string
+	User          string
+	OperationType string
+	Currency      string
+	From          string
+	To            string
+	Limit         int64
+	Offset        int64
+}
+
+// RollupsOf adds up operations into rollups for every period.
+func RollupsOf(operations []*InsertStruct) []Rollup {
+	type key struct{ period, key, user, operationType, currency string }
+	index := map[key]int{}
+	var rollups []Rollup
+	for _, operation := range operations {
+		for _, period := range Periods {
+			k := key{period, PeriodKey(period, operation.OccurredAt), operation.User, operation.OperationType, operation.Currency}
+			i, ok := index[k]
+			if !ok {
+				i = len(rollups)
+				index[k] = i
+				rollups = append(rollups, Rollup{Period: k.period, Key: k.key, User: k.user, OperationType: k.operationType, Currency: k.currency})
+			}
+			rollups[i].Total += operation.Amount
+			rollups[i].Count++
+		}
+	}
+	return rollups
+}
+
+// Preferences say how a user wants to hear about their operations. Empty
+// Channels means no notifications; empty Types means every type. Email is
+// only used once verified: a new address waits in PendingEmail until the
+// code sent to it, kept as EmailCodeHash, is confirmed.
+type Preferences struct {
+	User               string    `bson:"_id" json:"user"`
+	Email              string    `bson:"email" json:"email"`
+	PendingEmail       string    `bson:"pending_email" json:"pending_email"`
+	EmailCodeHash      string    `bson:"email_code_hash" json:"email_code_hash"`
+	EmailCodeExpiresAt time.Time `bson:"email_code_expires_at" json:"email_code_expires_at"`
+	WebhookURL         string    `bson:"webhook_url" json:"webhook_url"`
+	Channels           []string  `bson:"channels" json:"channels"`
+	Types              []string  `bson:"types" json:"types"`
+	MinAmount          float64   `bson:"min_amount" json:"min_amount"`
+	UpdatedAt          time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+const (
+	DeliveryPending = "pending"
+	DeliverySent    = "sent"
+	DeliveryFailed  = "failed"
+)
+
+// Delivery is one notification on one channel. Its id is derived from the
+// event and the channel, so an event is not notified twice.
+type Delivery struct {
+	Id            string    `bson:"_id" json:"id"`
+	EventId       string    `bson:"event_id" json:"event_id"`
+	User          string    `bson:"user" json:"user"`
+	Channel       string    `bson:"channel" json:"channel"`
+	Recipient     string    `bson:"recipient" json:"recipient"`
+	Subject       string    `bson:"subject" json:"subject"`
+	Body          string    `bson:"body" json:"body"`
+	Status        string    `bson:"status" json:"status"`
+	Attempts      int       `bson:"attempts" json:"attempts"`
+	LastError     string    `bson:"last_error" json:"last_error"`
+	NextAttemptAt time.Time `bson:"next_attempt_at" json:"next_attempt_at"`
+	CreatedAt     time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt     time.Time `bson:"updated_at" json:"updated_at"`
 }
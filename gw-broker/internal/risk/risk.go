@@ -0,0 +1,104 @@
+// Package risk evaluates stored wallet operations against fraud and velocity
+// rules.
+package risk
+
+import (
+	"context"
+	"time"
+
+	"gw-broker/internal/config"
+	"gw-broker/internal/repository"
+)
+
+// historyLimit caps how many earlier operations of a user a rule sees.
+const historyLimit = 500
+
+// Rule looks at an operation and the user's operations in the Window before
+// it, and returns an alert with Reason and RelatedIds set, or nil.
+type Rule interface {
+	Name() string
+	Window() time.Duration
+	Check(operation *repository.InsertStruct, history []repository.InsertStruct) *repository.Alert
+}
+
+type Engine struct {
+	rules    []Rule
+	history  repository.OperationReader
+	lookback time.Duration
+}
+
+func NewEngine(history repository.OperationReader, rules ...Rule) *Engine {
+	engine := &Engine{history: history}
+	for _, rule := range rules {
+		engine.rules = append(engine.rules, rule)
+		engine.lookback = max(engine.lookback, rule.Window())
+	}
+	return engine
+}
+
+// NewDefaultEngine builds an engine with the rules enabled in the config; a
+// rule with a zero window is disabled.
+func NewDefaultEngine(history repository.OperationReader, cfg *config.Config) *Engine {
+	risk := cfg.RiskConfig
+	var rules []Rule
+	if risk.WithdrawalWindow > 0 {
+		rules = append(rules, &RapidWithdrawals{Count: risk.WithdrawalCount, Period: risk.WithdrawalWindow})
+	}
+	if risk.DepositWithdrawWindow > 0 {
+		rules = append(rules, &DepositThenWithdraw{Period: risk.DepositWithdrawWindow})
+	}
+	if risk.CycleWindow > 0 {
+		rules = append(rules, &CurrencyCycling{Period: risk.CycleWindow})
+	}
+	return NewEngine(history, rules...)
+}
+
+// Evaluate runs every rule against the operation, which is expected to be
+// stored already.
+func (engine *Engine) Evaluate(ctx context.Context, operation *repository.InsertStruct) ([]*repository.Alert, error) {
+	if len(engine.rules) == 0 {
+		return nil, nil
+	}
+
+	stored, _, err := engine.history.ListOperations(ctx, &repository.OperationFilter{
+		User:  operation.User,
+		From:  operation.OccurredAt.Add(-engine.lookback),
+		To:    operation.OccurredAt.Add(time.Nanosecond),
+		Limit: historyLimit,
+	})
+	if err != nil {
+		return nil, err
+	}
+	history := make([]repository.InsertStruct, 0, len(stored))
+	for _, earlier := range stored {
+		if earlier.Id != operation.Id {
+			history = append(history, earlier)
+		}
+	}
+
+	var alerts []*repository.Alert
+	for _, rule := range engine.rules {
+		since := operation.OccurredAt.Add(-rule.Window())
+		alert := rule.Check(operation, within(history, since))
+		if alert == nil {
+			continue
+		}
+		alert.Id = rule.Name() + ":" + operation.Id
+		alert.Rule = rule.Name()
+		alert.User = operation.User
+		alert.EventId = operation.Id
+		alert.CreatedAt = time.Now().UTC()
+		alerts = append(alerts, alert)
+	}
+	return alerts, nil
+}
+
+func within(history []repository.InsertStruct, since time.Time) []repository.InsertStruct {
+	var recent []repository.InsertStruct
+	for _, operation := range history {
+		if !operation.OccurredAt.Before(since) {
+			recent = append(recent, operation)
+		}
+	}
+	return recent
+}
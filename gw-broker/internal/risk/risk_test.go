@@ -0,0 +1,85 @@
+package risk_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gw-broker/internal/repository"
+	"gw-broker/internal/risk"
+)
+
+// fakeHistory filters like the Mongo query: by user and [From, To).
+type fakeHistory struct {
+	operations []repository.InsertStruct
+}
+
+func (history *fakeHistory) ListOperations(ctx context.Context, filter *repository.OperationFilter) ([]repository.InsertStruct, int64, error) {
+	var found []repository.InsertStruct
+	for _, operation := range history.operations {
+		if operation.User == filter.User && !operation.OccurredAt.Before(filter.From) && operation.OccurredAt.Before(filter.To) {
+			found = append(found, operation)
+		}
+	}
+	return found, int64(len(found)), nil
+}
+
+func (history *fakeHistory) DailyTotals(ctx context.Context, filter *repository.OperationFilter) ([]repository.DailyTotal, error) {
+	return nil, nil
+}
+
+func (history *fakeHistory) ListRollups(ctx context.Context, filter *repository.RollupFilter) ([]repository.Rollup, error) {
+	return nil, nil
+}
+
+func TestEvaluate(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	history := &fakeHistory{operations: []repository.InsertStruct{
+		{Id: "d1", User: "user", OperationType: "deposit", Currency: "USD", OccurredAt: now.Add(-2 * time.Hour)},
+		{Id: "w1", User: "user", OperationType: "withdraw", Currency: "USD", OccurredAt: now.Add(-50 * time.Minute)},
+		{Id: "w2", User: "user", OperationType: "withdraw", Currency: "USD", OccurredAt: now.Add(-20 * time.Minute)},
+		{Id: "d2", User: "user", OperationType: "deposit", Currency: "USD", OccurredAt: now.Add(-5 * time.Minute)},
+		{Id: "x1", User: "user", OperationType: "exchange", Currency: "USD", TargetCurrency: "EUR", OccurredAt: now.Add(-30 * time.Minute)},
+		{Id: "x2", User: "user", OperationType: "exchange", Currency: "EUR", TargetCurrency: "RUB", OccurredAt: now.Add(-10 * time.Minute)},
+		{Id: "o1", User: "other", OperationType: "withdraw", Currency: "USD", OccurredAt: now.Add(-time.Minute)},
+	}}
+	engine := risk.NewEngine(history,
+		&risk.RapidWithdrawals{Count: 3, Period: time.Hour},
+		&risk.DepositThenWithdraw{Period: 15 * time.Minute},
+		&risk.CurrencyCycling{Period: time.Hour},
+	)
+
+	tests := []struct {
+		name      string
+		operation repository.InsertStruct
+		rules     []string
+	}{
+		{"third withdrawal after deposit", repository.InsertStruct{Id: "w3", User: "user", OperationType: "withdraw", Currency: "USD"}, []string{"rapid_withdrawals", "deposit_then_withdraw"}},
+		{"cycle back", repository.InsertStruct{Id: "x3", User: "user", OperationType: "exchange", Currency: "RUB", TargetCurrency: "USD"}, []string{"currency_cycling"}},
+		{"no cycle", repository.InsertStruct{Id: "x3", User: "user", OperationType: "exchange", Currency: "RUB", TargetCurrency: "CNY"}, nil},
+		{"deposit", repository.InsertStruct{Id: "d3", User: "user", OperationType: "deposit", Currency: "USD"}, nil},
+		{"other user", repository.InsertStruct{Id: "o2", User: "other", OperationType: "withdraw", Currency: "USD"}, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			operation := test.operation
+			operation.OccurredAt = now
+			history.operations = append(history.operations, operation)
+			defer func() { history.operations = history.operations[:len(history.operations)-1] }()
+
+			alerts, err := engine.Evaluate(context.Background(), &operation)
+			if err != nil {
+				t.Fatalf("expected no error, got %v\n", err)
+			}
+			if len(alerts) != len(test.rules) {
+				t.Fatalf("expected %v, got %v alerts\n", test.rules, len(alerts))
+			}
+			for i, alert := range alerts {
+				if alert.Rule != test.rules[i] || alert.Id != test.rules[i]+":"+operation.Id || alert.User != operation.User {
+					t.Fatalf("expected rule %v, got %+v\n", test.rules[i], alert)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package risk
+
+import (
+	"fmt"
+	"time"
+
+	"gw-broker/internal/repository"
+
+	"github.com/lynxbites/wallet-services/gw-shared/events"
+)
+
+// RapidWithdrawals flags the Count-th large withdrawal within Period.
+type RapidWithdrawals struct {
+	Count  int
+	Period time.Duration
+}
+
+func (rule *RapidWithdrawals) Name() string          { return "rapid_withdrawals" }
+func (rule *RapidWithdrawals) Window() time.Duration { return rule.Period }
+
+func (rule *RapidWithdrawals) Check(operation *repository.InsertStruct, history []repository.InsertStruct) *repository.Alert {
+	if operation.OperationType != string(events.TypeWithdraw) {
+		return nil
+	}
+	related := idsOf(history, func(earlier repository.InsertStruct) bool {
+		return earlier.OperationType == string(events.TypeWithdraw)
+	})
+	if len(related)+1 < rule.Count {
+		return nil
+	}
+	return &repository.Alert{
+		RelatedIds: related,
+		Reason:     fmt.Sprintf("%d large withdrawals within %s", len(related)+1, rule.Period),
+	}
+}
+
+// DepositThenWithdraw flags a large withdrawal shortly after a large deposit.
+type DepositThenWithdraw struct {
+	Period time.Duration
+}
+
+func (rule *DepositThenWithdraw) Name() string          { return "deposit_then_withdraw" }
+func (rule *DepositThenWithdraw) Window() time.Duration { return rule.Period }
+
+func (rule *DepositThenWithdraw) Check(operation *repository.InsertStruct, history []repository.InsertStruct) *repository.Alert {
+	if operation.OperationType != string(events.TypeWithdraw) {
+		return nil
+	}
+	related := idsOf(history, func(earlier repository.InsertStruct) bool {
+		return earlier.OperationType == string(events.TypeDeposit)
+	})
+	if len(related) == 0 {
+		return nil
+	}
+	return &repository.Alert{
+		RelatedIds: related,
+		Reason:     fmt.Sprintf("withdrawal within %s of a deposit", rule.Period),
+	}
+}
+
+// CurrencyCycling flags an exchange that brings funds back into a currency
+// they were exchanged out of within Period, directly or through other
+// currencies.
+type CurrencyCycling struct {
+	Period time.Duration
+}
+
+func (rule *CurrencyCycling) Name() string          { return "currency_cycling" }
+func (rule *CurrencyCycling) Window() time.Duration { return rule.Period }
+
+func (rule *CurrencyCycling) Check(operation *repository.InsertStruct, history []repository.InsertStruct) *repository.Alert {
+	if operation.OperationType != string(events.TypeExchange) || operation.TargetCurrency == "" {
+		return nil
+	}
+	related := idsOf(history, func(earlier repository.InsertStruct) bool {
+		return earlier.OperationType == string(events.TypeExchange) && earlier.Currency == operation.TargetCurrency
+	})
+	if len(related) == 0 {
+		return nil
+	}
+	return &repository.Alert{
+		RelatedIds: related,
+		Reason:     fmt.Sprintf("%s exchanged back within %s", operation.TargetCurrency, rule.Period),
+	}
+}
+
+func idsOf(history []repository.InsertStruct, match func(repository.InsertStruct) bool) []string {
+	var ids []string
+	for _, operation := range history {
+		if match(operation) {
+			ids = append(ids, operation.Id)
+		}
+	}
+	return ids
+}
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"gw-wallet/internal/auth"
 	"gw-wallet/internal/config"
-	"gw-wallet/internal/handler"
+	hdl "gw-wallet/internal/handler"
+	"gw-wallet/internal/migrations"
 	"gw-wallet/internal/repository/postgres"
 	"gw-wallet/internal/service"
 	"gw-wallet/internal/types"
@@ -10,12 +12,10 @@ import (
 	"os"
 
 	"github.com/golang-jwt/jwt/v5"
-	_ "github.com/golang-migrate/migrate/v4/database/pgx"
-	_ "github.com/golang-migrate/migrate/v4/database/postgres"
-	_ "github.com/golang-migrate/migrate/v4/source/file"
 	echojwt "github.com/labstack/echo-jwt/v4"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"github.com/lynxbites/wallet-services/gw-shared/migrate"
 )
 
 func main() {
@@ -25,6 +25,27 @@ func main() {
 		return
 	}
 
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := migrate.Command(migrations.Files, cfg.DbConfig.Address, os.Args[2:]); err != nil {
+			slog.Error("migrate: " + err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "users" {
+		if err := runUsers(cfg, os.Args[2:]); err != nil {
+			slog.Error("users: " + err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+	if cfg.DbConfig.AutoMigrate {
+		if err := migrate.Up(migrations.Files, cfg.DbConfig.Address); err != nil {
+			slog.Error("migrate: " + err.Error())
+			os.Exit(1)
+		}
+	}
+
 	var newservice service.Service
 	dbType := os.Getenv("DB_TYPE")
 	switch dbType {
@@ -34,32 +55,75 @@ func main() {
 			panic(err)
 		}
 		newservice = *service.NewService(repo, cfg)
+		go pruneSessions(repo, cfg.SessionConfig.PruneInterval, cfg.SessionConfig.Retention)
+		if cfg.PasswordConfig.CheckBreached {
+			if err := newservice.LoadBreachedPasswords(cfg.PasswordConfig.BreachedList); err != nil {
+				slog.Error("password policy: cannot load breached passwords: " + err.Error())
+				os.Exit(1)
+			}
+		} else {
+			slog.Warn("password policy: breached passwords are not checked")
+		}
 	default:
 		panic("database unsupported")
 	}
 
-	handler := handler.NewHandler(&newservice)
+	handler := hdl.NewHandler(&newservice)
 
 	config := echojwt.Config{
-		SigningKey: []byte(os.Getenv("SIGNING_KEY")),
+		SigningKey: []byte(cfg.AuthConfig.SigningKey),
 		NewClaimsFunc: func(c echo.Context) jwt.Claims {
 			return new(types.JwtClaims)
 		},
 	}
 
 	e := echo.New()
+	// the client address counts failed logins, so it is only taken from
+	// headers when a proxy in front of the service sets them
+	if cfg.LoginConfig.TrustProxyHeaders {
+		e.IPExtractor = echo.ExtractIPFromXFFHeader()
+	} else {
+		e.IPExtractor = echo.ExtractIPDirect()
+	}
 	e.Use(middleware.LoggerWithConfig(middleware.LoggerConfig{
 		Format: "INFO ${method}:${path} ${status} ${error} ${latency_human} \n",
 	}))
 
+	// authenticated routes need a valid token that was not revoked since
+	authenticated := []echo.MiddlewareFunc{echojwt.WithConfig(config), handler.RequireSession}
+
 	e.POST("/api/v1/register", handler.Register)
 	e.POST("/api/v1/login", handler.Login)
-	e.GET("/api/v1/balance", handler.GetBalance, echojwt.WithConfig(config))
-	e.POST("/api/v1/wallet/deposit", handler.Deposit, echojwt.WithConfig(config))
-	e.POST("/api/v1/wallet/withdraw", handler.Withdraw, echojwt.WithConfig(config))
+	e.POST("/api/v1/login/mfa", handler.LoginMFA)
+	e.GET("/api/v1/verify", handler.VerifyEmail)
+	e.POST("/api/v1/password/forgot", handler.ForgotPassword)
+	e.POST("/api/v1/password/reset", handler.ResetPassword)
+
+	// any logged in user, customer or staff, manages their own account
+	account := e.Group("/api/v1", authenticated...)
+	account.GET("/me", handler.GetProfile)
+	account.PATCH("/me", handler.UpdateProfile)
+	account.GET("/sessions", handler.ListSessions)
+	account.DELETE("/sessions/:id", handler.RevokeSession)
+	account.POST("/verify/resend", handler.ResendVerification)
+	account.POST("/password/change", handler.ChangePassword)
+	account.POST("/auth/step-up", handler.StepUp)
+	account.POST("/mfa/totp/enroll", handler.EnrollTOTP)
+	account.POST("/mfa/totp/confirm", handler.ConfirmTOTP)
+
+	// customers only reach their own wallet, which the token names
+	wallet := e.Group("/api/v1", append(authenticated, hdl.RequirePermission(auth.PermissionWallet))...)
+	wallet.GET("/balance", handler.GetBalance)
+	wallet.POST("/wallet/deposit", handler.Deposit)
+	wallet.POST("/wallet/withdraw", handler.Withdraw)
+	wallet.GET("/exchange/rates", handler.GetExchangeRates)
+	wallet.POST("/exchange", handler.Exchange)
 
-	e.GET("/api/v1/exchange/rates", handler.GetExchangeRates, echojwt.WithConfig(config))
-	e.POST("/api/v1/exchange", handler.Exchange, echojwt.WithConfig(config))
+	// support reads any user, admins also change them
+	admin := e.Group("/api/v1/admin", append(authenticated, hdl.RequirePermission(auth.PermissionUsersRead))...)
+	admin.GET("/users/:username", handler.GetUser)
+	admin.PUT("/users/:username/roles", handler.SetRoles, hdl.RequirePermission(auth.PermissionUsersWrite))
+	admin.DELETE("/users/:username/lockout", handler.Unlock, hdl.RequirePermission(auth.PermissionUsersWrite))
 
 	e.Start(":8000")
 }
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"gw-wallet/internal/repository/postgres"
+	"log/slog"
+	"time"
+)
+
+// pruneSessions deletes, every interval, the sessions that ended more than
+// retention ago. Known devices are kept apart from sessions, so an old
+// device does not look new once its sessions are gone.
+func pruneSessions(repo *postgres.PostgresRepo, interval time.Duration, retention time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		deleted, err := repo.PruneSessions(time.Now().Add(-retention))
+		if err != nil {
+			slog.Error("sessions: cannot prune: " + err.Error())
+		} else if deleted > 0 {
+			slog.Info("sessions: pruned ended sessions", "deleted", deleted)
+		}
+		<-ticker.C
+	}
+}
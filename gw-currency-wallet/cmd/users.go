@@ -0,0 +1,34 @@
+package main
+
+import (
+	"errors"
+	"gw-wallet/internal/config"
+	"gw-wallet/internal/repository/postgres"
+	"os"
+)
+
+// runUsers handles "app users export [file]", which writes the id of every
+// user next to their username, one JSON object per line, to the file or to
+// stdout. The broker's "app users backfill" reads it.
+func runUsers(cfg *config.Config, args []string) error {
+	if len(args) == 0 || args[0] != "export" || len(args) > 2 {
+		return errors.New("usage: app users export [file]")
+	}
+	repo, err := postgres.NewPostgresRepo(cfg.DbConfig.Address)
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 1 {
+		return repo.ExportUserIds(os.Stdout)
+	}
+	out, err := os.Create(args[1])
+	if err != nil {
+		return err
+	}
+	if err := repo.ExportUserIds(out); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,246 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrUnknownHash = errors.New("unknown password hash")
+	// ErrHasherBusy is returned while as many passwords are being hashed or
+	// checked as the hasher is limited to.
+	ErrHasherBusy = errors.New("too many passwords are being hashed")
+)
+
+// PasswordScheme is one way of hashing passwords. Its hashes are encoded
+// with the scheme and its parameters, so hashes made with other parameters
+// or by an older scheme can still be checked.
+type PasswordScheme interface {
+	Hash(password string) (string, error)
+	// Recognizes reports whether the encoded hash is of this scheme.
+	Recognizes(encoded string) bool
+	Verify(encoded string, password string) bool
+	// Current reports whether the encoded hash was made with the parameters
+	// the scheme has now.
+	Current(encoded string) bool
+}
+
+// Argon2id hashes into the PHC string format,
+// $argon2id$v=19$m=<memory>,t=<time>,p=<threads>$<salt>$<key>. Memory is
+// in KiB.
+type Argon2id struct {
+	Memory     uint32
+	Time       uint32
+	Threads    uint8
+	SaltLength uint32
+	KeyLength  uint32
+}
+
+type argon2Hash struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+func (scheme *Argon2id) Hash(password string) (string, error) {
+	salt := make([]byte, scheme.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, scheme.Time, scheme.Memory, scheme.Threads, scheme.KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, scheme.Memory, scheme.Time, scheme.Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (scheme *Argon2id) Recognizes(encoded string) bool {
+	return strings.HasPrefix(encoded, "$argon2id$")
+}
+
+func (scheme *Argon2id) Verify(encoded string, password string) bool {
+	hash, err := parseArgon2(encoded)
+	if err != nil {
+		return false
+	}
+	key := argon2.IDKey([]byte(password), hash.salt, hash.time, hash.memory, hash.threads, uint32(len(hash.key)))
+	return subtle.ConstantTimeCompare(key, hash.key) == 1
+}
+
+func (scheme *Argon2id) Current(encoded string) bool {
+	hash, err := parseArgon2(encoded)
+	if err != nil {
+		return false
+	}
+	return hash.memory == scheme.Memory && hash.time == scheme.Time && hash.threads == scheme.Threads &&
+		len(hash.salt) == int(scheme.SaltLength) && len(hash.key) == int(scheme.KeyLength)
+}
+
+func parseArgon2(encoded string) (*argon2Hash, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return nil, ErrUnknownHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, ErrUnknownHash
+	}
+	hash := new(argon2Hash)
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &hash.memory, &hash.time, &hash.threads); err != nil {
+		return nil, ErrUnknownHash
+	}
+	var err error
+	if hash.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, ErrUnknownHash
+	}
+	if hash.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(hash.key) == 0 {
+		return nil, ErrUnknownHash
+	}
+	return hash, nil
+}
+
+// Bcrypt is the scheme passwords were hashed with before Argon2id. Its
+// hashes carry the cost.
+type Bcrypt struct {
+	Cost int
+}
+
+func (scheme *Bcrypt) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), scheme.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func (scheme *Bcrypt) Recognizes(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+func (scheme *Bcrypt) Verify(encoded string, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password)) == nil
+}
+
+func (scheme *Bcrypt) Current(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err == nil && cost == scheme.Cost
+}
+
+// PasswordHasher hashes new passwords with its current scheme and checks
+// hashes of that and of its legacy schemes.
+type PasswordHasher struct {
+	current   PasswordScheme
+	schemes   []PasswordScheme
+	dummy     string
+	dummyOnce sync.Once
+	// slots holds a token per hash or check in progress; nil means no limit.
+	slots chan struct{}
+}
+
+func NewPasswordHasher(current PasswordScheme, legacy ...PasswordScheme) *PasswordHasher {
+	return &PasswordHasher{current: current, schemes: append([]PasswordScheme{current}, legacy...)}
+}
+
+// Limit lets at most concurrent hashes and checks run at once, since each
+// Argon2id one holds its memory until it is done. The ones over the limit
+// fail with ErrHasherBusy instead of waiting. Zero means no limit. It is
+// set before the hasher is used.
+func (hasher *PasswordHasher) Limit(concurrent int) *PasswordHasher {
+	hasher.slots = nil
+	if concurrent > 0 {
+		hasher.slots = make(chan struct{}, concurrent)
+	}
+	return hasher
+}
+
+func (hasher *PasswordHasher) acquire() error {
+	if hasher.slots == nil {
+		return nil
+	}
+	select {
+	case hasher.slots <- struct{}{}:
+		return nil
+	default:
+		return ErrHasherBusy
+	}
+}
+
+func (hasher *PasswordHasher) release() {
+	if hasher.slots != nil {
+		<-hasher.slots
+	}
+}
+
+func (hasher *PasswordHasher) Hash(password string) (string, error) {
+	if err := hasher.acquire(); err != nil {
+		return "", err
+	}
+	defer hasher.release()
+	return hasher.current.Hash(password)
+}
+
+// Verify checks the password and, when it matches, reports whether the
+// hash should be replaced by one of the current scheme and parameters.
+// Passwords longer than the policy allows never match and are not hashed.
+func (hasher *PasswordHasher) Verify(encoded string, password string) (bool, bool, error) {
+	if tooLong(password) {
+		return false, false, nil
+	}
+	if err := hasher.acquire(); err != nil {
+		return false, false, err
+	}
+	defer hasher.release()
+	for _, scheme := range hasher.schemes {
+		if !scheme.Recognizes(encoded) {
+			continue
+		}
+		if !scheme.Verify(encoded, password) {
+			return false, false, nil
+		}
+		return true, scheme != hasher.current || !scheme.Current(encoded), nil
+	}
+	return false, false, nil
+}
+
+// VerifyDummy costs as much as checking a real password, so a login for an
+// unknown user takes as long as one with a wrong password.
+func (hasher *PasswordHasher) VerifyDummy(password string) error {
+	if tooLong(password) {
+		return nil
+	}
+	if err := hasher.acquire(); err != nil {
+		return err
+	}
+	defer hasher.release()
+	hasher.dummyOnce.Do(func() {
+		hasher.dummy, _ = hasher.current.Hash("dummy password for unknown users")
+	})
+	hasher.current.Verify(hasher.dummy, password)
+	return nil
+}
+
+// NewOpaqueToken returns a random token for the user and the hash to store
+// in its place.
+func NewOpaqueToken() (string, string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	return token, HashOpaqueToken(token), nil
+}
+
+func HashOpaqueToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,128 @@
+package auth_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"gw-wallet/internal/auth"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func testArgon2(memory uint32) *auth.Argon2id {
+	return &auth.Argon2id{Memory: memory, Time: 1, Threads: 1, SaltLength: 16, KeyLength: 32}
+}
+
+func TestPasswordHasher(t *testing.T) {
+	hasher := auth.NewPasswordHasher(testArgon2(64), &auth.Bcrypt{Cost: bcrypt.MinCost})
+	hash, err := hasher.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Fatalf("expected argon2id hash with params, got %v\n", hash)
+	}
+	if ok, rehash, _ := hasher.Verify(hash, "correct horse"); !ok || rehash {
+		t.Fatalf("expected %v %v, got %v %v\n", true, false, ok, rehash)
+	}
+	if ok, _, _ := hasher.Verify(hash, "wrong horse"); ok {
+		t.Fatalf("expected %v, got %v\n", false, ok)
+	}
+	if other, _ := hasher.Hash("correct horse"); other == hash {
+		t.Fatalf("expected a new salt, got %v\n", other)
+	}
+}
+
+func TestPasswordHasherUpgrade(t *testing.T) {
+	legacy, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old, err := auth.NewPasswordHasher(testArgon2(32)).Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hasher := auth.NewPasswordHasher(testArgon2(64), &auth.Bcrypt{Cost: bcrypt.MinCost})
+
+	tests := []struct {
+		name   string
+		hash   string
+		ok     bool
+		rehash bool
+	}{
+		{"bcrypt", string(legacy), true, true},
+		{"older params", old, true, true},
+		{"unknown scheme", "$md5$abc", false, false},
+		{"malformed", "$argon2id$v=19$m=64", false, false},
+	}
+	for _, test := range tests {
+		ok, rehash, _ := hasher.Verify(test.hash, "correct horse")
+		if ok != test.ok || rehash != test.rehash {
+			t.Fatalf("%v: expected %v %v, got %v %v\n", test.name, test.ok, test.rehash, ok, rehash)
+		}
+	}
+
+	if ok, rehash, _ := hasher.Verify(string(legacy), "wrong horse"); ok || rehash {
+		t.Fatalf("expected %v %v, got %v %v\n", false, false, ok, rehash)
+	}
+}
+
+func TestPasswordHasherLimit(t *testing.T) {
+	// a scheme that blocks keeps the only slot taken
+	scheme := &blockingScheme{Argon2id: testArgon2(64), started: make(chan struct{}), done: make(chan struct{})}
+	hasher := auth.NewPasswordHasher(scheme).Limit(1)
+	finished := make(chan struct{})
+	go func() {
+		hasher.Hash("correct horse")
+		close(finished)
+	}()
+	<-scheme.started
+
+	if _, err := hasher.Hash("correct horse"); !errors.Is(err, auth.ErrHasherBusy) {
+		t.Fatalf("expected %v, got %v\n", auth.ErrHasherBusy, err)
+	}
+	if _, _, err := hasher.Verify("$argon2id$", "correct horse"); !errors.Is(err, auth.ErrHasherBusy) {
+		t.Fatalf("expected %v, got %v\n", auth.ErrHasherBusy, err)
+	}
+	if err := hasher.VerifyDummy("correct horse"); !errors.Is(err, auth.ErrHasherBusy) {
+		t.Fatalf("expected %v, got %v\n", auth.ErrHasherBusy, err)
+	}
+	// a password too long to match needs no slot
+	if ok, _, err := hasher.Verify("$argon2id$", strings.Repeat("a", 257)); ok || err != nil {
+		t.Fatalf("expected %v %v, got %v %v\n", false, nil, ok, err)
+	}
+
+	close(scheme.done)
+	<-finished
+	scheme.started = nil
+	if _, err := hasher.Hash("correct horse"); err != nil {
+		t.Fatalf("expected %v, got %v\n", nil, err)
+	}
+}
+
+func TestPasswordHasherTooLong(t *testing.T) {
+	hasher := auth.NewPasswordHasher(testArgon2(64))
+	long := strings.Repeat("a", 257)
+	hash, err := hasher.Hash(long)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, _, _ := hasher.Verify(hash, long); ok {
+		t.Fatalf("expected %v, got %v\n", false, ok)
+	}
+}
+
+type blockingScheme struct {
+	*auth.Argon2id
+	started chan struct{}
+	done    chan struct{}
+}
+
+func (scheme *blockingScheme) Hash(password string) (string, error) {
+	if scheme.started != nil {
+		close(scheme.started)
+		<-scheme.done
+	}
+	return scheme.Argon2id.Hash(password)
+}
@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"bufio"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// defaultBreached is a short list of the most common passwords, used when
+// no other list is given.
+//
+//go:embed breached.txt
+var defaultBreached string
+
+// maxPasswordLength is the most characters a new password may have.
+// PasswordHasher.Verify refuses longer ones without hashing them, so no
+// password check runs Argon2id over an arbitrarily long input.
+const maxPasswordLength = 256
+
+var ErrWeakPassword = errors.New("password does not meet the policy")
+
+// PasswordPolicy is what new passwords are checked against. Passwords that
+// are already set are not checked again.
+type PasswordPolicy struct {
+	MinLength int
+	breached  map[string]struct{}
+}
+
+// LoadBreached reads a list of breached passwords, one per line. They are
+// compared ignoring case.
+func (policy *PasswordPolicy) LoadBreached(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return policy.readBreached(file)
+}
+
+// LoadDefaultBreached uses the list of common passwords built into the
+// service.
+func (policy *PasswordPolicy) LoadDefaultBreached() error {
+	return policy.readBreached(strings.NewReader(defaultBreached))
+}
+
+func (policy *PasswordPolicy) readBreached(list io.Reader) error {
+	breached := make(map[string]struct{})
+	scanner := bufio.NewScanner(list)
+	for scanner.Scan() {
+		if line := strings.TrimRight(scanner.Text(), "\r"); line != "" {
+			breached[strings.ToLower(line)] = struct{}{}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	policy.breached = breached
+	return nil
+}
+
+// Check returns an error wrapping ErrWeakPassword that tells the user what
+// is wrong with the password.
+func (policy *PasswordPolicy) Check(password string) error {
+	if utf8.RuneCountInString(password) < policy.MinLength {
+		return fmt.Errorf("%w: it needs at least %d characters", ErrWeakPassword, policy.MinLength)
+	}
+	if tooLong(password) {
+		return fmt.Errorf("%w: it may have at most %d characters", ErrWeakPassword, maxPasswordLength)
+	}
+	if _, ok := policy.breached[strings.ToLower(password)]; ok {
+		return fmt.Errorf("%w: it is known from data breaches", ErrWeakPassword)
+	}
+	return nil
+}
+
+func tooLong(password string) bool {
+	return utf8.RuneCountInString(password) > maxPasswordLength
+}
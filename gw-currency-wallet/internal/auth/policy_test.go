@@ -0,0 +1,53 @@
+package auth_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gw-wallet/internal/auth"
+)
+
+func TestPasswordPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	if err := os.WriteFile(path, []byte("Password1234\r\nqwertyuiopas\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	policy := &auth.PasswordPolicy{MinLength: 12}
+	if err := policy.LoadBreached(path); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		password string
+		weak     bool
+	}{
+		{"correct horse", false},
+		{"short", true},
+		{"пароль-пароль", false},
+		{"password1234", true},
+		{"QWERTYUIOPAS", true},
+		{strings.Repeat("a", 257), true},
+	}
+	for _, test := range tests {
+		err := policy.Check(test.password)
+		if errors.Is(err, auth.ErrWeakPassword) != test.weak {
+			t.Fatalf("%v: expected weak %v, got %v\n", test.password, test.weak, err)
+		}
+	}
+}
+
+func TestPasswordPolicyDefaultBreached(t *testing.T) {
+	policy := &auth.PasswordPolicy{MinLength: 8}
+	if err := policy.LoadDefaultBreached(); err != nil {
+		t.Fatal(err)
+	}
+	if err := policy.Check("Password123!"); !errors.Is(err, auth.ErrWeakPassword) {
+		t.Fatalf("expected %v, got %v\n", auth.ErrWeakPassword, err)
+	}
+	if err := policy.Check("correct horse"); err != nil {
+		t.Fatalf("expected %v, got %v\n", nil, err)
+	}
+}
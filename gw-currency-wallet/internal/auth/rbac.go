@@ -0,0 +1,24 @@
+package auth
+
+import "slices"
+
+// Roles and permissions live in the database; these are the ones the code
+// refers to. Roles are granted permissions in role_permissions, and tokens
+// carry both.
+const (
+	RoleCustomer = "customer"
+	RoleSupport  = "support"
+	RoleAdmin    = "admin"
+
+	// PermissionWallet lets a user use their own wallet.
+	PermissionWallet = "wallet:use"
+	// PermissionUsersRead lets staff look at any user.
+	PermissionUsersRead = "users:read"
+	// PermissionUsersWrite lets staff change any user.
+	PermissionUsersWrite = "users:write"
+)
+
+// HasPermission reports whether a token with permissions may do permission.
+func HasPermission(permissions []string, permission string) bool {
+	return slices.Contains(permissions, permission)
+}
@@ -0,0 +1,43 @@
+package auth
+
+import "time"
+
+// ThrottlePolicy decides how long failed logins hold up the next attempt.
+// The first FreeAttempts failures cost nothing, every failure after them
+// doubles the wait from Delay up to MaxDelay, and LockoutAfter failures
+// lock the key for Lockout. Failures older than Window are forgotten.
+type ThrottlePolicy struct {
+	FreeAttempts int
+	Delay        time.Duration
+	MaxDelay     time.Duration
+	LockoutAfter int
+	Lockout      time.Duration
+	Window       time.Duration
+}
+
+// Wait is how long the key has to wait before the next attempt.
+func (policy *ThrottlePolicy) Wait(failures int, lastFailure time.Time, lockedUntil time.Time, now time.Time) time.Duration {
+	if now.Before(lockedUntil) {
+		return lockedUntil.Sub(now)
+	}
+	if now.Sub(lastFailure) >= policy.Window {
+		return 0
+	}
+	return max(lastFailure.Add(policy.delay(failures)).Sub(now), 0)
+}
+
+// Locks reports whether this many failures lock the key.
+func (policy *ThrottlePolicy) Locks(failures int) bool {
+	return policy.LockoutAfter > 0 && failures >= policy.LockoutAfter
+}
+
+func (policy *ThrottlePolicy) delay(failures int) time.Duration {
+	if failures <= policy.FreeAttempts {
+		return 0
+	}
+	delay := policy.Delay
+	for i := policy.FreeAttempts + 1; i < failures && delay < policy.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, policy.MaxDelay)
+}
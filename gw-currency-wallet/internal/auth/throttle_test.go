@@ -0,0 +1,47 @@
+package auth_test
+
+import (
+	"testing"
+	"time"
+
+	"gw-wallet/internal/auth"
+)
+
+func TestThrottleWait(t *testing.T) {
+	policy := &auth.ThrottlePolicy{
+		FreeAttempts: 3,
+		Delay:        time.Second,
+		MaxDelay:     10 * time.Second,
+		LockoutAfter: 10,
+		Lockout:      15 * time.Minute,
+		Window:       15 * time.Minute,
+	}
+	now := time.Now()
+
+	tests := []struct {
+		name        string
+		failures    int
+		lastFailure time.Time
+		lockedUntil time.Time
+		wait        time.Duration
+	}{
+		{"free attempts", 3, now, time.Time{}, 0},
+		{"first delay", 4, now, time.Time{}, time.Second},
+		{"doubles", 6, now, time.Time{}, 4 * time.Second},
+		{"capped", 9, now, time.Time{}, 10 * time.Second},
+		{"partly waited", 5, now.Add(-time.Second), time.Time{}, time.Second},
+		{"forgotten", 9, now.Add(-time.Hour), time.Time{}, 0},
+		{"locked", 10, now, now.Add(time.Minute), time.Minute},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if wait := policy.Wait(test.failures, test.lastFailure, test.lockedUntil, now); wait != test.wait {
+				t.Fatalf("expected %v, got %v\n", test.wait, wait)
+			}
+		})
+	}
+
+	if policy.Locks(9) || !policy.Locks(10) {
+		t.Fatalf("expected the lock at %v failures\n", policy.LockoutAfter)
+	}
+}
@@ -0,0 +1,82 @@
+// Package auth holds the token and credential helpers of the wallet.
+package auth
+
+import (
+	"crypto/sha256"
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Purposes of the tokens sent by email.
+const (
+	PurposeVerifyEmail  = "verify_email"
+	PurposeMFAChallenge = "mfa_challenge"
+)
+
+var ErrInvalidToken = errors.New("invalid or expired token")
+
+// ActionClaims are carried by the tokens sent by email. The subject is the
+// user id.
+type ActionClaims struct {
+	Purpose string `json:"purpose"`
+	Email   string `json:"email,omitempty"`
+	// PasswordChangedAt, in unix microseconds, ties an MFA challenge to the
+	// password it was issued for.
+	PasswordChangedAt int64 `json:"password_changed_at,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// IssueActionToken signs a token for one purpose. Every purpose has its own
+// key derived from signingKey, so an emailed token can never pass as an
+// access token or as a token of another purpose.
+func IssueActionToken(signingKey string, purpose string, userId string, email string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims := &ActionClaims{
+		Purpose: purpose,
+		Email:   email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   userId,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(purposeKey(signingKey, purpose))
+}
+
+// IssueMFAChallenge signs the challenge handed out between the password and
+// the second factor. It has an id, so that it can be used up, and is tied to
+// the password it was issued for.
+func IssueMFAChallenge(signingKey string, userId string, passwordChangedAt time.Time, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims := &ActionClaims{
+		Purpose:           PurposeMFAChallenge,
+		PasswordChangedAt: passwordChangedAt.UnixMicro(),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
+			Subject:   userId,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(purposeKey(signingKey, PurposeMFAChallenge))
+}
+
+// ParseActionToken checks the signature, expiry and purpose of a token.
+func ParseActionToken(signingKey string, purpose string, token string) (*ActionClaims, error) {
+	claims := new(ActionClaims)
+	_, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (any, error) {
+		return purposeKey(signingKey, purpose), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil || claims.Purpose != purpose || claims.Subject == "" {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+func purposeKey(signingKey string, purpose string) []byte {
+	key := sha256.Sum256([]byte(signingKey + "\x00" + purpose))
+	return key[:]
+}
@@ -0,0 +1,75 @@
+package auth_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"gw-wallet/internal/auth"
+)
+
+func TestActionToken(t *testing.T) {
+	token, err := auth.IssueActionToken("key", auth.PurposeVerifyEmail, "user", "user@mail", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := auth.ParseActionToken("key", auth.PurposeVerifyEmail, token)
+	if err != nil {
+		t.Fatalf("expected %v, got %v\n", nil, err)
+	}
+	if claims.Subject != "user" || claims.Email != "user@mail" {
+		t.Fatalf("expected user and user@mail, got %v and %v\n", claims.Subject, claims.Email)
+	}
+
+	expired, err := auth.IssueActionToken("key", auth.PurposeVerifyEmail, "user", "user@mail", -time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]struct {
+		key     string
+		purpose string
+		token   string
+	}{
+		"wrong key":     {"other", auth.PurposeVerifyEmail, token},
+		"wrong purpose": {"key", "other", token},
+		"expired":       {"key", auth.PurposeVerifyEmail, expired},
+		"garbage":       {"key", auth.PurposeVerifyEmail, "garbage"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := auth.ParseActionToken(test.key, test.purpose, test.token)
+			if !errors.Is(err, auth.ErrInvalidToken) {
+				t.Fatalf("expected %v, got %v\n", auth.ErrInvalidToken, err)
+			}
+		})
+	}
+}
+
+func TestMFAChallenge(t *testing.T) {
+	changed := time.Date(2025, 3, 1, 12, 0, 0, 123456000, time.UTC)
+	first, err := auth.IssueMFAChallenge("key", "user", changed, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := auth.IssueMFAChallenge("key", "user", changed, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := auth.ParseActionToken("key", auth.PurposeMFAChallenge, first)
+	if err != nil {
+		t.Fatalf("expected %v, got %v\n", nil, err)
+	}
+	// the change time keeps its microseconds, so a change within the same
+	// second still tells the challenges apart
+	if claims.PasswordChangedAt != changed.UnixMicro() {
+		t.Fatalf("expected %v, got %v\n", changed.UnixMicro(), claims.PasswordChangedAt)
+	}
+	other, err := auth.ParseActionToken("key", auth.PurposeMFAChallenge, second)
+	if err != nil {
+		t.Fatalf("expected %v, got %v\n", nil, err)
+	}
+	if claims.ID == "" || claims.ID == other.ID {
+		t.Fatalf("expected distinct challenge ids, got %q and %q\n", claims.ID, other.ID)
+	}
+}
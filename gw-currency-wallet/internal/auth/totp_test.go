@@ -0,0 +1,88 @@
+package auth_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"gw-wallet/internal/auth"
+)
+
+// The SHA1 vectors from RFC 6238, appendix B, cut to 6 digits.
+func TestTOTPCode(t *testing.T) {
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ" // "12345678901234567890"
+	tests := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+	for unix, expected := range tests {
+		code, err := auth.TOTPCode(secret, auth.TOTPStep(time.Unix(unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != expected {
+			t.Fatalf("expected %v at %v, got %v\n", expected, unix, code)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret, err := auth.NewTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	previous, err := auth.TOTPCode(secret, auth.TOTPStep(now)-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if step, ok := auth.ValidateTOTP(secret, previous, now); !ok || step != auth.TOTPStep(now)-1 {
+		t.Fatalf("expected the previous step to be accepted, got %v %v\n", step, ok)
+	}
+	old, err := auth.TOTPCode(secret, auth.TOTPStep(now)-3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := auth.ValidateTOTP(secret, old, now); ok {
+		t.Fatalf("expected a code from 90 seconds ago to be refused\n")
+	}
+
+	uri := auth.TOTPURI("Wallet", "user", secret)
+	if !strings.HasPrefix(uri, "otpauth://totp/Wallet:user?") || !strings.Contains(uri, "secret="+secret) {
+		t.Fatalf("expected an otpauth uri, got %v\n", uri)
+	}
+}
+
+func TestSealSecret(t *testing.T) {
+	sealed, err := auth.SealSecret("key", "SECRET")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret, err := auth.OpenSecret("key", sealed); err != nil || secret != "SECRET" {
+		t.Fatalf("expected %v, got %v %v\n", "SECRET", secret, err)
+	}
+	if _, err := auth.OpenSecret("other", sealed); err == nil {
+		t.Fatalf("expected an error for the wrong key\n")
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := auth.NewRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 11 || code[5] != '-' || seen[code] {
+			t.Fatalf("expected unique codes like abcde-fghij, got %v\n", codes)
+		}
+		seen[code] = true
+		if normalized := auth.NormalizeRecoveryCode(strings.ToUpper(strings.ReplaceAll(code, "-", ""))); normalized != code {
+			t.Fatalf("expected %v, got %v\n", code, normalized)
+		}
+	}
+}
@@ -1,18 +1,31 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	DbConfig     dbConfig
-	RabbitConfig rabbitConfig
+	DbConfig       dbConfig
+	RabbitConfig   rabbitConfig
+	ExchangeConfig exchangeConfig
+	AuthConfig     authConfig
+	MailConfig     mailConfig
+	LoginConfig    loginConfig
+	PasswordConfig passwordConfig
+	SessionConfig  sessionConfig
 }
 
 type dbConfig struct {
 	Address string
+	// AutoMigrate applies pending migrations on start.
+	AutoMigrate bool
 }
 
 type rabbitConfig struct {
@@ -22,6 +35,92 @@ type rabbitConfig struct {
 	RabbitRouting  string
 }
 
+type exchangeConfig struct {
+	Address string
+	// TLSCA enables TLS and is used to verify the exchanger; TLSCert and
+	// TLSKey are presented to the exchanger when it requires mutual TLS.
+	TLSCA         string
+	TLSCert       string
+	TLSKey        string
+	TLSServerName string
+	Token         string
+	// RateMaxAge is how old an exchanger rate may be before exchanges at it
+	// are refused.
+	RateMaxAge time.Duration
+}
+
+type authConfig struct {
+	// SigningKey signs access tokens and, through keys derived from it, the
+	// tokens sent by email.
+	SigningKey string
+	// VerifyTTL is how long an email verification link stays valid.
+	VerifyTTL time.Duration
+	// ResetTTL is how long a password reset token stays valid.
+	ResetTTL time.Duration
+	// StepUpTTL is how long a token stays elevated after step-up.
+	StepUpTTL time.Duration
+	// StepUpWithdrawThresholds are the amounts, per currency, from which
+	// withdrawals need an elevated token.
+	StepUpWithdrawThresholds map[string]float64
+	// PublicURL is where users reach the service, used for links in emails.
+	PublicURL string
+}
+
+type mailConfig struct {
+	// Mailer is log or file.
+	Mailer string
+	Dir    string
+	From   string
+}
+
+// loginConfig throttles failed logins per username and per address; see
+// auth.ThrottlePolicy.
+type loginConfig struct {
+	FreeAttempts   int
+	IPFreeAttempts int
+	Delay          time.Duration
+	MaxDelay       time.Duration
+	LockoutAfter   int
+	IPLockoutAfter int
+	Lockout        time.Duration
+	Window         time.Duration
+	// TrustProxyHeaders takes the client address from X-Forwarded-For,
+	// which is only safe behind a proxy that sets it.
+	TrustProxyHeaders bool
+}
+
+// sessionConfig sets how long sessions are kept once they have ended.
+type sessionConfig struct {
+	// Retention is how long an expired or revoked session stays listed in
+	// the database before it is deleted.
+	Retention time.Duration
+	// PruneInterval is how often ended sessions are deleted.
+	PruneInterval time.Duration
+}
+
+// passwordConfig sets the Argon2id parameters of new password hashes and
+// the policy new passwords are checked against.
+type passwordConfig struct {
+	// Argon2Memory is in KiB.
+	Argon2Memory  int
+	Argon2Time    int
+	Argon2Threads int
+	MinLength     int
+	// HashMemory is how much memory, in MiB, the password hashes running at
+	// once may take together.
+	HashMemory int
+	// BreachedList is a file of breached passwords, one per line. Empty
+	// means the list built into the service.
+	BreachedList string
+	// CheckBreached is false when PASSWORD_BREACHED_LIST is none.
+	CheckBreached bool
+}
+
+// ConcurrentHashes is how many Argon2id hashes fit into HashMemory.
+func (password *passwordConfig) ConcurrentHashes() int {
+	return max(1, password.HashMemory*1024/password.Argon2Memory)
+}
+
 func NewConfig() (*Config, error) {
 
 	err := godotenv.Load("config.env")
@@ -30,9 +129,94 @@ func NewConfig() (*Config, error) {
 		return nil, err
 	}
 
+	rateMaxAge, err := getDuration("EXCHANGE_RATE_MAX_AGE", 24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	verifyTTL, err := getDuration("EMAIL_VERIFY_TTL", 24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	resetTTL, err := getDuration("PASSWORD_RESET_TTL", time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	stepUpTTL, err := getDuration("STEP_UP_TTL", 5*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	thresholds := os.Getenv("STEP_UP_WITHDRAW_THRESHOLD")
+	if thresholds == "" {
+		thresholds = "USD:10000,EUR:10000,RUB:1000000"
+	}
+	stepUpWithdrawThresholds, err := parseThresholds(thresholds)
+	if err != nil {
+		return nil, fmt.Errorf("STEP_UP_WITHDRAW_THRESHOLD: %w", err)
+	}
+
+	loginConfig, err := newLoginConfig()
+	if err != nil {
+		return nil, err
+	}
+	passwordConfig, err := newPasswordConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	sessionRetention, err := getDuration("SESSION_RETENTION", 30*24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	sessionPruneInterval, err := getDuration("SESSION_PRUNE_INTERVAL", time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	if sessionPruneInterval <= 0 {
+		return nil, errors.New("SESSION_PRUNE_INTERVAL must be positive")
+	}
+
+	signingKey := os.Getenv("SIGNING_KEY")
+	if signingKey == "" {
+		return nil, errors.New("SIGNING_KEY is not set")
+	}
+	publicURL := os.Getenv("PUBLIC_URL")
+	if publicURL == "" {
+		publicURL = "http://localhost:8000"
+	}
+
+	mailer := os.Getenv("MAILER")
+	if mailer == "" {
+		mailer = "log"
+	}
+	if mailer != "log" && mailer != "file" {
+		return nil, fmt.Errorf("MAILER must be log or file, got %q", mailer)
+	}
+	mailDir := os.Getenv("MAILER_DIR")
+	if mailDir == "" {
+		mailDir = "mail"
+	}
+	mailFrom := os.Getenv("MAIL_FROM")
+	if mailFrom == "" {
+		mailFrom = "wallet@localhost"
+	}
+
+	exchangerAddress := os.Getenv("EXCHANGER_ADDR")
+	if exchangerAddress == "" {
+		exchangerAddress = "localhost:8020"
+	}
+	if os.Getenv("EXCHANGER_TOKEN") != "" && os.Getenv("EXCHANGER_TLS_CA") == "" {
+		return nil, errors.New("EXCHANGER_TOKEN needs TLS, set EXCHANGER_TLS_CA")
+	}
+	if (os.Getenv("EXCHANGER_TLS_CERT") == "") != (os.Getenv("EXCHANGER_TLS_KEY") == "") {
+		return nil, errors.New("EXCHANGER_TLS_CERT and EXCHANGER_TLS_KEY must be set together")
+	}
+
 	storage := Config{
 		DbConfig: dbConfig{
-			Address: os.Getenv("DB_CONN"),
+			Address:     os.Getenv("DB_CONN"),
+			AutoMigrate: os.Getenv("DB_AUTO_MIGRATE") == "true",
 		},
 		RabbitConfig: rabbitConfig{
 			Address:        os.Getenv("RMQ_CONN"),
@@ -40,6 +224,148 @@ func NewConfig() (*Config, error) {
 			RabbitQueue:    os.Getenv("RMQ_QUEUE"),
 			RabbitRouting:  os.Getenv("RMQ_ROUTINGKEY"),
 		},
+		ExchangeConfig: exchangeConfig{
+			Address:       exchangerAddress,
+			TLSCA:         os.Getenv("EXCHANGER_TLS_CA"),
+			TLSCert:       os.Getenv("EXCHANGER_TLS_CERT"),
+			TLSKey:        os.Getenv("EXCHANGER_TLS_KEY"),
+			TLSServerName: os.Getenv("EXCHANGER_TLS_SERVER_NAME"),
+			Token:         os.Getenv("EXCHANGER_TOKEN"),
+			RateMaxAge:    rateMaxAge,
+		},
+		AuthConfig: authConfig{
+			SigningKey:               signingKey,
+			VerifyTTL:                verifyTTL,
+			ResetTTL:                 resetTTL,
+			PublicURL:                publicURL,
+			StepUpTTL:                stepUpTTL,
+			StepUpWithdrawThresholds: stepUpWithdrawThresholds,
+		},
+		MailConfig: mailConfig{
+			Mailer: mailer,
+			Dir:    mailDir,
+			From:   mailFrom,
+		},
+		LoginConfig:    *loginConfig,
+		PasswordConfig: *passwordConfig,
+		SessionConfig: sessionConfig{
+			Retention:     sessionRetention,
+			PruneInterval: sessionPruneInterval,
+		},
 	}
 	return &storage, nil
 }
+
+func newLoginConfig() (*loginConfig, error) {
+	login := &loginConfig{TrustProxyHeaders: os.Getenv("TRUST_PROXY_HEADERS") == "true"}
+	var err error
+	ints := []struct {
+		target   *int
+		name     string
+		fallback int
+	}{
+		{&login.FreeAttempts, "LOGIN_FREE_ATTEMPTS", 3},
+		{&login.IPFreeAttempts, "LOGIN_IP_FREE_ATTEMPTS", 20},
+		{&login.LockoutAfter, "LOGIN_LOCKOUT_AFTER", 10},
+		{&login.IPLockoutAfter, "LOGIN_IP_LOCKOUT_AFTER", 100},
+	}
+	for _, value := range ints {
+		if *value.target, err = getInt(value.name, value.fallback); err != nil {
+			return nil, err
+		}
+	}
+	durations := []struct {
+		target   *time.Duration
+		name     string
+		fallback time.Duration
+	}{
+		{&login.Delay, "LOGIN_DELAY", time.Second},
+		{&login.MaxDelay, "LOGIN_MAX_DELAY", 30 * time.Second},
+		{&login.Lockout, "LOGIN_LOCKOUT", 15 * time.Minute},
+		{&login.Window, "LOGIN_FAILURE_WINDOW", 15 * time.Minute},
+	}
+	for _, value := range durations {
+		if *value.target, err = getDuration(value.name, value.fallback); err != nil {
+			return nil, err
+		}
+	}
+	return login, nil
+}
+
+func newPasswordConfig() (*passwordConfig, error) {
+	password := &passwordConfig{BreachedList: os.Getenv("PASSWORD_BREACHED_LIST"), CheckBreached: true}
+	if password.BreachedList == "none" {
+		password.BreachedList, password.CheckBreached = "", false
+	}
+	var err error
+	ints := []struct {
+		target   *int
+		name     string
+		fallback int
+	}{
+		{&password.Argon2Memory, "PASSWORD_ARGON2_MEMORY", 64 * 1024},
+		{&password.Argon2Time, "PASSWORD_ARGON2_TIME", 3},
+		{&password.Argon2Threads, "PASSWORD_ARGON2_THREADS", 4},
+		{&password.MinLength, "PASSWORD_MIN_LENGTH", 12},
+		{&password.HashMemory, "PASSWORD_HASH_MEMORY", 1024},
+	}
+	for _, value := range ints {
+		if *value.target, err = getInt(value.name, value.fallback); err != nil {
+			return nil, err
+		}
+	}
+	if password.Argon2Time < 1 || password.Argon2Threads < 1 || password.Argon2Threads > 255 {
+		return nil, errors.New("PASSWORD_ARGON2_TIME must be at least 1 and PASSWORD_ARGON2_THREADS between 1 and 255")
+	}
+	if password.Argon2Memory < 8*password.Argon2Threads {
+		return nil, errors.New("PASSWORD_ARGON2_MEMORY must be at least 8 KiB per thread")
+	}
+	if password.HashMemory*1024 < password.Argon2Memory {
+		return nil, errors.New("PASSWORD_HASH_MEMORY must fit at least one PASSWORD_ARGON2_MEMORY")
+	}
+	if password.MinLength < 1 {
+		return nil, errors.New("PASSWORD_MIN_LENGTH must be at least 1")
+	}
+	return password, nil
+}
+
+func getInt(name string, fallback int) (int, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback, nil
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil || number < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative integer, got %q", name, value)
+	}
+	return number, nil
+}
+
+func getDuration(name string, fallback time.Duration) (time.Duration, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", name, err)
+	}
+	return duration, nil
+}
+
+// parseThresholds reads a "USD:10000,EUR:9000" list of amounts per currency.
+func parseThresholds(list string) (map[string]float64, error) {
+	thresholds := make(map[string]float64)
+	for _, entry := range strings.Split(list, ",") {
+		currency, value, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok || currency == "" {
+			return nil, fmt.Errorf("expected CURRENCY:amount, got %q", entry)
+		}
+		amount, err := strconv.ParseFloat(value, 64)
+		if err != nil || amount < 0 {
+			return nil, fmt.Errorf("%s must be a non-negative number, got %q", currency, value)
+		}
+		thresholds[currency] = amount
+	}
+	return thresholds, nil
+}
@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"errors"
+	"gw-wallet/internal/repository"
+	"gw-wallet/internal/service"
+	"log/slog"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+func (handler *Handler) GetUser(ctx echo.Context) error {
+	slog.Info("new request: received staff user request")
+	view, err := handler.service.GetUserView(ctx, ctx.Param("username"))
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return ctx.JSON(http.StatusNotFound, map[string]string{"error": "User not found"})
+	}
+	if err != nil {
+		return err
+	}
+	return ctx.JSON(http.StatusOK, view)
+}
+
+func (handler *Handler) SetRoles(ctx echo.Context) error {
+	slog.Info("new request: received set roles request")
+	request := new(repository.SetRolesRequest)
+	if err := ctx.Bind(request); err != nil || request.Roles == nil {
+		return echo.ErrBadRequest
+	}
+	err := handler.service.SetRoles(ctx, ctx.Param("username"), request.Roles)
+	switch {
+	case errors.Is(err, service.ErrStepUpRequired):
+		return stepUpRequired(ctx)
+	case errors.Is(err, repository.ErrUserNotFound):
+		return ctx.JSON(http.StatusNotFound, map[string]string{"error": "User not found"})
+	case errors.Is(err, repository.ErrUnknownRole):
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Unknown role"})
+	case err != nil:
+		return err
+	}
+	slog.Info("ok: roles set")
+	return ctx.JSON(http.StatusOK, echo.Map{
+		"message": "Roles updated, the user has to log in again",
+	})
+}
+
+func (handler *Handler) Unlock(ctx echo.Context) error {
+	slog.Info("new request: received unlock request")
+	if err := handler.service.Unlock(ctx, ctx.Param("username")); err != nil {
+		return err
+	}
+	return ctx.JSON(http.StatusOK, echo.Map{
+		"message": "Login unlocked",
+	})
+}
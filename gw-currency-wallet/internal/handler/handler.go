@@ -3,10 +3,14 @@ package handler
 import (
 	"errors"
 	"fmt"
+	"gw-wallet/internal/auth"
 	"gw-wallet/internal/repository"
 	"gw-wallet/internal/service"
 	"log/slog"
+	"math"
 	"net/http"
+	"net/mail"
+	"strconv"
 
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/labstack/echo/v4"
@@ -34,8 +38,19 @@ func (handler *Handler) Register(ctx echo.Context) error {
 		slog.Info("bad request: empty field in request: " + fmt.Sprint(registerRequest))
 		return echo.ErrBadRequest
 	}
+	if address, err := mail.ParseAddress(registerRequest.Email); err != nil || address.Address != registerRequest.Email {
+		slog.Info("bad request: invalid email: " + registerRequest.Email)
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid email"})
+	}
 
 	if err := handler.service.RegisterUser(ctx, registerRequest); err != nil {
+		if errors.Is(err, auth.ErrHasherBusy) {
+			return hasherBusy(ctx)
+		}
+		if errors.Is(err, auth.ErrWeakPassword) {
+			slog.Info("bad request: weak password")
+			return ctx.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
 		var pgErr *pgconn.PgError
 		if errors.As(err, &pgErr) {
 			fmt.Println(pgErr.Message)
@@ -52,7 +67,38 @@ func (handler *Handler) Register(ctx echo.Context) error {
 
 	slog.Info("ok: user registered successfully")
 	return ctx.JSON(http.StatusCreated, echo.Map{
-		"message": "User registered successfully",
+		"message": "User registered successfully, check your email to verify it",
+	})
+}
+
+func (handler *Handler) VerifyEmail(ctx echo.Context) error {
+	slog.Info("new request: received email verification request")
+	err := handler.service.VerifyEmail(ctx, ctx.QueryParam("token"))
+	if errors.Is(err, auth.ErrInvalidToken) {
+		slog.Info("bad request: invalid verification token")
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid or expired token"})
+	}
+	if err != nil {
+		return err
+	}
+	slog.Info("ok: email verified")
+	return ctx.JSON(http.StatusOK, echo.Map{
+		"message": "Email verified successfully",
+	})
+}
+
+func (handler *Handler) ResendVerification(ctx echo.Context) error {
+	slog.Info("new request: received resend verification request")
+	err := handler.service.ResendVerification(ctx)
+	if errors.Is(err, service.ErrEmailAlreadyVerified) {
+		return ctx.JSON(http.StatusConflict, map[string]string{"error": "Email is already verified"})
+	}
+	if err != nil {
+		return err
+	}
+	slog.Info("ok: verification email sent")
+	return ctx.JSON(http.StatusOK, echo.Map{
+		"message": "Verification email sent",
 	})
 }
 
@@ -64,7 +110,14 @@ func (handler *Handler) Login(ctx echo.Context) error {
 		return echo.ErrBadRequest
 	}
 
-	token, err := handler.service.LoginUser(ctx, loginRequest)
+	result, err := handler.service.LoginUser(ctx, loginRequest)
+	var throttled *service.ThrottledError
+	if errors.As(err, &throttled) {
+		return tooManyLogins(ctx, throttled)
+	}
+	if errors.Is(err, auth.ErrHasherBusy) {
+		return hasherBusy(ctx)
+	}
 	if err != nil {
 		if errors.Is(err, echo.ErrUnauthorized) {
 
@@ -75,9 +128,34 @@ func (handler *Handler) Login(ctx echo.Context) error {
 			return err
 		}
 	}
+	if result.MFAToken != "" {
+		slog.Info("ok: password accepted, second factor required")
+		return ctx.JSON(http.StatusOK, echo.Map{
+			"mfa_required": true,
+			"mfa_token":    result.MFAToken,
+		})
+	}
 	slog.Info("ok: user logged in successfully")
 	return ctx.JSON(http.StatusOK, echo.Map{
-		"token": token,
+		"token": result.Token,
+	})
+}
+
+func tooManyLogins(ctx echo.Context, throttled *service.ThrottledError) error {
+	slog.Info("too many requests: " + throttled.Error())
+	ctx.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+	return ctx.JSON(http.StatusTooManyRequests, echo.Map{
+		"error": "Too many failed logins, try again later",
+	})
+}
+
+// hasherBusy turns away a request that needs a password hashed while the
+// hasher is at its limit; it has not counted as a login attempt.
+func hasherBusy(ctx echo.Context) error {
+	slog.Warn("service unavailable: password hasher busy")
+	ctx.Response().Header().Set("Retry-After", "1")
+	return ctx.JSON(http.StatusServiceUnavailable, echo.Map{
+		"error": "Too many logins in progress, try again shortly",
 	})
 }
 
@@ -116,6 +194,16 @@ func (handler *Handler) Withdraw(ctx echo.Context) error {
 	}
 
 	response, err := handler.service.Withdraw(ctx, withdrawRequest)
+	if errors.Is(err, service.ErrEmailNotVerified) {
+		return ctx.JSON(http.StatusForbidden, map[string]string{"error": "Verify your email to withdraw"})
+	}
+	if errors.Is(err, service.ErrInvalidCurrency) {
+		slog.Info("bad request: invalid currency")
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid currency"})
+	}
+	if errors.Is(err, service.ErrStepUpRequired) {
+		return stepUpRequired(ctx)
+	}
 	if err != nil {
 		var pgErr *pgconn.PgError
 		if errors.As(err, &pgErr) {
@@ -149,6 +237,15 @@ func (handler *Handler) Exchange(ctx echo.Context) error {
 		return echo.ErrBadRequest
 	}
 	response, err := handler.service.Exchange(ctx, exchangeRequest)
+	if errors.Is(err, service.ErrEmailNotVerified) {
+		return ctx.JSON(http.StatusForbidden, map[string]string{"error": "Verify your email to exchange"})
+	}
+	if errors.Is(err, service.ErrTradingHalted) {
+		return ctx.JSON(http.StatusConflict, map[string]string{"error": "Trading is halted for this currency pair"})
+	}
+	if errors.Is(err, service.ErrStaleRate) {
+		return ctx.JSON(http.StatusServiceUnavailable, map[string]string{"error": "Exchange rates are temporarily unavailable"})
+	}
 	if err != nil {
 		return err
 	}
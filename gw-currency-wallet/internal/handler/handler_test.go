@@ -129,7 +129,7 @@ func TestStuff(t *testing.T) {
 	// register test
 	registerRequestBody := repository.RegisterRequest{
 		Username: "newuser",
-		Password: "1",
+		Password: "correct horse battery",
 		Email:    "newuser@mail",
 	}
 	jsonBody, err := json.Marshal(registerRequestBody)
@@ -184,11 +184,10 @@ func TestGetBalance(t *testing.T) {
 	e := echo.New()
 	req := httptest.NewRequest(http.MethodGet, "/api/v1/balance", nil)
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+token.Token)
 	rec := httptest.NewRecorder()
 	context := e.NewContext(req, rec)
 	context.Set("user", &jwt.Token{
-		Claims: &types.JwtClaims{Username: "user"},
+		Claims: seededClaims(t),
 		Valid:  true,
 	})
 	///////////////////////////////
@@ -234,11 +233,10 @@ func TestDeposit(t *testing.T) {
 	}
 	req := httptest.NewRequest(http.MethodPost, "/api/v1/wallet/deposit", bytes.NewReader(jsonBody))
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+token.Token)
 	rec := httptest.NewRecorder()
 	context := e.NewContext(req, rec)
 	context.Set("user", &jwt.Token{
-		Claims: &types.JwtClaims{Username: "user"},
+		Claims: seededClaims(t),
 		Valid:  true,
 	})
 	///////////////////////////////
@@ -282,11 +280,10 @@ func TestWithdraw(t *testing.T) {
 	}
 	req := httptest.NewRequest(http.MethodPost, "/api/v1/wallet/withdraw", bytes.NewReader(jsonBody))
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+token.Token)
 	rec := httptest.NewRecorder()
 	context := e.NewContext(req, rec)
 	context.Set("user", &jwt.Token{
-		Claims: &types.JwtClaims{Username: "user"},
+		Claims: seededClaims(t),
 		Valid:  true,
 	})
 	///////////////////////////////
@@ -310,3 +307,276 @@ func TestWithdraw(t *testing.T) {
 		t.Errorf("expected %v, got %v\n", expectedBalance, withdrawResponse.NewBalance)
 	}
 }
+
+// seededClaims name the user seeded by the migrations by its generated id,
+// so every test can run on its own.
+func seededClaims(t *testing.T) *types.JwtClaims {
+	claims := &types.JwtClaims{Username: "user"}
+	err := db.QueryRow(context.Background(), "select id from users where username = 'user'").Scan(&claims.Subject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return claims
+}
+
+func TestGetProfile(t *testing.T) {
+	testRepo, err := postgres.NewPostgresRepo(connStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testService := service.NewService(testRepo, cfg)
+	testHandler := handler.NewHandler(testService)
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/me", nil)
+	rec := httptest.NewRecorder()
+	context := e.NewContext(req, rec)
+	claims := seededClaims(t)
+	context.Set("user", &jwt.Token{
+		Claims: claims,
+		Valid:  true,
+	})
+
+	err = testHandler.GetProfile(context)
+	if err != nil {
+		t.Fatal(err)
+	}
+	profile := repository.Profile{}
+	err = json.Unmarshal(rec.Body.Bytes(), &profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile.Id != claims.Subject || profile.Username != "user" || profile.Email != "user@mail" || !profile.EmailVerified || profile.PreferredCurrency != "USD" {
+		t.Errorf("expected the seeded user, got %+v\n", profile)
+	}
+}
+
+func TestUpdateProfile(t *testing.T) {
+	testRepo, err := postgres.NewPostgresRepo(connStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testService := service.NewService(testRepo, cfg)
+	testHandler := handler.NewHandler(testService)
+
+	e := echo.New()
+	// a user of its own, so the seeded user keeps its verified email
+	userId, err := testRepo.RegisterUser(e.NewContext(nil, nil), &repository.RegisterRequest{Username: "profileuser", Email: "profile@mail"}, "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		body     string
+		elevated bool
+		status   int
+		email    string
+		verified bool
+		currency string
+	}{
+		{"currency", `{"preferred_currency": "EUR"}`, false, http.StatusOK, "profile@mail", false, "EUR"},
+		{"unknown currency", `{"preferred_currency": "GBP"}`, false, http.StatusBadRequest, "profile@mail", false, "EUR"},
+		{"email without step-up", `{"email": "new@mail"}`, false, http.StatusForbidden, "profile@mail", false, "EUR"},
+		{"same email without step-up", `{"email": "profile@mail", "preferred_currency": "RUB"}`, false, http.StatusOK, "profile@mail", false, "RUB"},
+		// the currency is not changed when the email cannot be
+		{"taken email", `{"email": "user@mail", "preferred_currency": "USD"}`, true, http.StatusConflict, "profile@mail", false, "RUB"},
+		{"email", `{"email": "new@mail", "preferred_currency": "USD"}`, true, http.StatusOK, "new@mail", false, "USD"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPatch, "/api/v1/me", bytes.NewReader([]byte(test.body)))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			context := e.NewContext(req, rec)
+			claims := &types.JwtClaims{Username: "profileuser"}
+			claims.Subject = userId
+			if test.elevated {
+				claims.ElevatedUntil = jwt.NewNumericDate(time.Now().Add(time.Minute))
+			}
+			context.Set("user", &jwt.Token{
+				Claims: claims,
+				Valid:  true,
+			})
+
+			err := testHandler.UpdateProfile(context)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rec.Code != test.status {
+				t.Fatalf("expected %v, got %v\n", test.status, rec.Code)
+			}
+
+			user, err := testRepo.GetUser(context, userId)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if user.Email != test.email || user.EmailVerified != test.verified || user.PreferredCurrency != test.currency {
+				t.Errorf("expected %v %v %v, got %v %v %v\n", test.email, test.verified, test.currency, user.Email, user.EmailVerified, user.PreferredCurrency)
+			}
+		})
+	}
+}
+
+func TestSessions(t *testing.T) {
+	testRepo, err := postgres.NewPostgresRepo(connStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testService := service.NewService(testRepo, cfg)
+	testHandler := handler.NewHandler(testService)
+	e := echo.New()
+
+	login := func(userAgent string) *types.JwtClaims {
+		jsonBody, err := json.Marshal(repository.LoginRequest{Username: "user", Password: "1"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/login", bytes.NewReader(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", userAgent)
+		rec := httptest.NewRecorder()
+		if err := testHandler.Login(e.NewContext(req, rec)); err != nil {
+			t.Fatal(err)
+		}
+		token := new(Token)
+		if err := json.Unmarshal(rec.Body.Bytes(), token); err != nil {
+			t.Fatal(err)
+		}
+		claims := new(types.JwtClaims)
+		_, err = jwt.ParseWithClaims(token.Token, claims, func(*jwt.Token) (any, error) {
+			return []byte(cfg.AuthConfig.SigningKey), nil
+		})
+		if err != nil {
+			t.Fatalf("expected a token, got %s\n", rec.Body.String())
+		}
+		return claims
+	}
+	newContext := func(method string, claims *types.JwtClaims) (echo.Context, *httptest.ResponseRecorder) {
+		rec := httptest.NewRecorder()
+		context := e.NewContext(httptest.NewRequest(method, "/api/v1/sessions", nil), rec)
+		context.Set("user", &jwt.Token{
+			Claims: claims,
+			Valid:  true,
+		})
+		return context, rec
+	}
+	// requireSession runs the middleware in front of a handler that
+	// answers 204
+	requireSession := func(claims *types.JwtClaims) int {
+		context, rec := newContext(http.MethodGet, claims)
+		err := testHandler.RequireSession(func(ctx echo.Context) error {
+			return ctx.NoContent(http.StatusNoContent)
+		})(context)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rec.Code
+	}
+
+	phone := login("phone")
+	laptop := login("laptop")
+
+	// both sessions are recorded with their device, and both devices are
+	// remembered under the fingerprint migration 13 computes
+	var userAgent string
+	err = db.QueryRow(context.Background(), "select user_agent from sessions where id = $1", phone.ID).Scan(&userAgent)
+	if err != nil || userAgent != "phone" {
+		t.Fatalf("expected %v, got %v, %v\n", "phone", userAgent, err)
+	}
+	var devices int
+	err = db.QueryRow(context.Background(), `select count(*) from known_devices where user_id = $1
+		and fingerprint in (encode(sha256('phone'), 'hex'), encode(sha256('laptop'), 'hex'))`, phone.Subject).Scan(&devices)
+	if err != nil || devices != 2 {
+		t.Fatalf("expected %v, got %v, %v\n", 2, devices, err)
+	}
+
+	context, rec := newContext(http.MethodGet, laptop)
+	if err := testHandler.ListSessions(context); err != nil {
+		t.Fatal(err)
+	}
+	var listed struct {
+		Sessions []repository.Session `json:"sessions"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &listed); err != nil {
+		t.Fatal(err)
+	}
+	current := map[string]bool{}
+	for _, session := range listed.Sessions {
+		current[session.Id] = session.Current
+	}
+	if isCurrent, ok := current[phone.ID]; !ok || isCurrent || !current[laptop.ID] {
+		t.Fatalf("expected the phone and the current laptop session, got %+v\n", listed.Sessions)
+	}
+
+	if code := requireSession(phone); code != http.StatusNoContent {
+		t.Fatalf("expected %v, got %v\n", http.StatusNoContent, code)
+	}
+
+	// the laptop logs the phone out; a second revoke finds nothing
+	for _, status := range []int{http.StatusOK, http.StatusNotFound} {
+		context, rec := newContext(http.MethodDelete, laptop)
+		context.SetParamNames("id")
+		context.SetParamValues(phone.ID)
+		if err := testHandler.RevokeSession(context); err != nil {
+			t.Fatal(err)
+		}
+		if rec.Code != status {
+			t.Fatalf("expected %v, got %v\n", status, rec.Code)
+		}
+	}
+
+	if code := requireSession(phone); code != http.StatusUnauthorized {
+		t.Fatalf("expected %v, got %v\n", http.StatusUnauthorized, code)
+	}
+	if code := requireSession(laptop); code != http.StatusNoContent {
+		t.Fatalf("expected %v, got %v\n", http.StatusNoContent, code)
+	}
+}
+
+// TestUsersMigration moves the schema back before migration 9 and up
+// through it again, checking that the balances survive both ways.
+func TestUsersMigration(t *testing.T) {
+	migration, err := migrate.New("file://../migrations/", connStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := migration.Up(); err != nil && err != migrate.ErrNoChange {
+			t.Fatal(err)
+		}
+	}()
+
+	var before repository.Balance
+	err = db.QueryRow(context.Background(), `select w.balance_usd, w.balance_rub, w.balance_eur
+		from users u join wallets w on w.user_id = u.id where u.username = 'user'`).Scan(&before.USD, &before.RUB, &before.EUR)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := migration.Migrate(8); err != nil {
+		t.Fatal(err)
+	}
+	var down repository.Balance
+	err = db.QueryRow(context.Background(), "select balance_usd, balance_rub, balance_eur from wallets where username = 'user'").Scan(&down.USD, &down.RUB, &down.EUR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if down != before {
+		t.Fatalf("expected %v, got %v\n", before, down)
+	}
+
+	if err := migration.Migrate(9); err != nil {
+		t.Fatal(err)
+	}
+	var up repository.Balance
+	var currency string
+	err = db.QueryRow(context.Background(), `select w.balance_usd, w.balance_rub, w.balance_eur, u.preferred_currency
+		from users u join wallets w on w.user_id = u.id where u.username = 'user'`).Scan(&up.USD, &up.RUB, &up.EUR, &currency)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if up != before || currency != "USD" {
+		t.Fatalf("expected %v USD, got %v %v\n", before, up, currency)
+	}
+}
@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"errors"
+	"gw-wallet/internal/repository"
+	"gw-wallet/internal/service"
+	"log/slog"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+func (handler *Handler) EnrollTOTP(ctx echo.Context) error {
+	slog.Info("new request: received totp enroll request")
+	enrollment, err := handler.service.EnrollTOTP(ctx)
+	if errors.Is(err, service.ErrTOTPEnabled) {
+		return ctx.JSON(http.StatusConflict, map[string]string{"error": "Two-factor authentication is already enabled"})
+	}
+	if errors.Is(err, service.ErrStepUpRequired) {
+		return stepUpRequired(ctx)
+	}
+	if err != nil {
+		return err
+	}
+	slog.Info("ok: totp secret issued")
+	return ctx.JSON(http.StatusOK, enrollment)
+}
+
+func (handler *Handler) ConfirmTOTP(ctx echo.Context) error {
+	slog.Info("new request: received totp confirm request")
+	request := new(repository.TOTPCodeRequest)
+	if err := ctx.Bind(request); err != nil || request.Code == "" {
+		return echo.ErrBadRequest
+	}
+	codes, err := handler.service.ConfirmTOTP(ctx, request.Code)
+	switch {
+	case errors.Is(err, service.ErrTOTPEnabled):
+		return ctx.JSON(http.StatusConflict, map[string]string{"error": "Two-factor authentication is already enabled"})
+	case errors.Is(err, service.ErrTOTPNotEnrolled):
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Enroll first"})
+	case errors.Is(err, service.ErrInvalidMFACode):
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid code"})
+	case err != nil:
+		return err
+	}
+	slog.Info("ok: totp enabled")
+	return ctx.JSON(http.StatusOK, echo.Map{
+		"message":        "Two-factor authentication enabled, keep the recovery codes safe",
+		"recovery_codes": codes,
+	})
+}
+
+func (handler *Handler) LoginMFA(ctx echo.Context) error {
+	slog.Info("new request: received mfa login request")
+	request := new(repository.MFALoginRequest)
+	if err := ctx.Bind(request); err != nil || request.MFAToken == "" || (request.Code == "" && request.RecoveryCode == "") {
+		return echo.ErrBadRequest
+	}
+	token, err := handler.service.LoginMFA(ctx, request)
+	var throttled *service.ThrottledError
+	switch {
+	case errors.As(err, &throttled):
+		return tooManyLogins(ctx, throttled)
+	case errors.Is(err, service.ErrInvalidChallenge):
+		return ctx.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid or expired mfa token, log in again"})
+	case errors.Is(err, service.ErrInvalidMFACode):
+		return ctx.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid code"})
+	case err != nil:
+		return err
+	}
+	slog.Info("ok: user logged in successfully")
+	return ctx.JSON(http.StatusOK, echo.Map{
+		"token": token,
+	})
+}
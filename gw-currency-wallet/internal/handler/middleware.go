@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"errors"
+	"gw-wallet/internal/auth"
+	"gw-wallet/internal/service"
+	"gw-wallet/internal/types"
+	"log/slog"
+	"net/http"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+)
+
+// RequireSession goes after the JWT middleware and refuses tokens that were
+// revoked since they were issued.
+func (handler *Handler) RequireSession(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		err := handler.service.CheckSession(ctx)
+		if errors.Is(err, service.ErrSessionRevoked) {
+			slog.Info("unauthorized: revoked session")
+			return ctx.JSON(http.StatusUnauthorized, map[string]string{"error": "Session has ended, log in again"})
+		}
+		if err != nil {
+			return err
+		}
+		return next(ctx)
+	}
+}
+
+// RequirePermission goes after RequireSession and lets through only tokens
+// that carry the permission.
+func RequirePermission(permission string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			claims := ctx.Get("user").(*jwt.Token).Claims.(*types.JwtClaims)
+			if !auth.HasPermission(claims.Permissions, permission) {
+				slog.Info("forbidden: missing permission", "user", claims.Subject, "permission", permission)
+				return ctx.JSON(http.StatusForbidden, map[string]string{"error": "Not allowed"})
+			}
+			return next(ctx)
+		}
+	}
+}
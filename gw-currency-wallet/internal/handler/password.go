@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"errors"
+	"gw-wallet/internal/auth"
+	"gw-wallet/internal/repository"
+	"gw-wallet/internal/service"
+	"log/slog"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+func (handler *Handler) ForgotPassword(ctx echo.Context) error {
+	slog.Info("new request: received forgot password request")
+	request := new(repository.ForgotPasswordRequest)
+	if err := ctx.Bind(request); err != nil || request.Email == "" {
+		return echo.ErrBadRequest
+	}
+	if err := handler.service.ForgotPassword(ctx, request); err != nil {
+		return err
+	}
+	return ctx.JSON(http.StatusOK, echo.Map{
+		"message": "If the email is registered, a reset token has been sent to it",
+	})
+}
+
+func (handler *Handler) ResetPassword(ctx echo.Context) error {
+	slog.Info("new request: received reset password request")
+	request := new(repository.ResetPasswordRequest)
+	if err := ctx.Bind(request); err != nil || request.Token == "" || request.NewPassword == "" {
+		return echo.ErrBadRequest
+	}
+	err := handler.service.ResetPassword(ctx, request)
+	if errors.Is(err, auth.ErrInvalidToken) {
+		slog.Info("bad request: invalid reset token")
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid or expired token"})
+	}
+	if errors.Is(err, auth.ErrHasherBusy) {
+		return hasherBusy(ctx)
+	}
+	if errors.Is(err, auth.ErrWeakPassword) {
+		slog.Info("bad request: weak password")
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		return err
+	}
+	slog.Info("ok: password reset")
+	return ctx.JSON(http.StatusOK, echo.Map{
+		"message": "Password reset successfully",
+	})
+}
+
+func (handler *Handler) ChangePassword(ctx echo.Context) error {
+	slog.Info("new request: received change password request")
+	request := new(repository.ChangePasswordRequest)
+	if err := ctx.Bind(request); err != nil || request.OldPassword == "" || request.NewPassword == "" {
+		return echo.ErrBadRequest
+	}
+	token, err := handler.service.ChangePassword(ctx, request)
+	if errors.Is(err, service.ErrInvalidPassword) {
+		return ctx.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid password"})
+	}
+	if errors.Is(err, auth.ErrHasherBusy) {
+		return hasherBusy(ctx)
+	}
+	if errors.Is(err, auth.ErrWeakPassword) {
+		slog.Info("bad request: weak password")
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if errors.Is(err, service.ErrStepUpRequired) {
+		return stepUpRequired(ctx)
+	}
+	if err != nil {
+		return err
+	}
+	slog.Info("ok: password changed")
+	return ctx.JSON(http.StatusOK, echo.Map{
+		"message": "Password changed successfully",
+		"token":   token,
+	})
+}
@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"errors"
+	"gw-wallet/internal/repository"
+	"gw-wallet/internal/service"
+	"log/slog"
+	"net/http"
+	"net/mail"
+
+	"github.com/labstack/echo/v4"
+)
+
+func (handler *Handler) GetProfile(ctx echo.Context) error {
+	slog.Info("new request: received profile request")
+	profile, err := handler.service.GetProfile(ctx)
+	if err != nil {
+		return err
+	}
+	return ctx.JSON(http.StatusOK, profile)
+}
+
+func (handler *Handler) UpdateProfile(ctx echo.Context) error {
+	slog.Info("new request: received profile update request")
+	request := new(repository.UpdateProfileRequest)
+	if err := ctx.Bind(request); err != nil {
+		return echo.ErrBadRequest
+	}
+	if request.Email != nil {
+		if address, err := mail.ParseAddress(*request.Email); err != nil || address.Address != *request.Email {
+			slog.Info("bad request: invalid email: " + *request.Email)
+			return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid email"})
+		}
+	}
+	profile, err := handler.service.UpdateProfile(ctx, request)
+	switch {
+	case errors.Is(err, service.ErrStepUpRequired):
+		return stepUpRequired(ctx)
+	case errors.Is(err, service.ErrInvalidCurrency):
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid currency"})
+	case errors.Is(err, repository.ErrEmailTaken):
+		return ctx.JSON(http.StatusConflict, map[string]string{"error": "Email already in use"})
+	case err != nil:
+		return err
+	}
+	slog.Info("ok: profile updated")
+	return ctx.JSON(http.StatusOK, profile)
+}
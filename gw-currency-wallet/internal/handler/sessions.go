@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"errors"
+	"gw-wallet/internal/service"
+	"log/slog"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+func (handler *Handler) ListSessions(ctx echo.Context) error {
+	slog.Info("new request: received sessions request")
+	sessions, err := handler.service.ListSessions(ctx)
+	if err != nil {
+		return err
+	}
+	return ctx.JSON(http.StatusOK, echo.Map{
+		"sessions": sessions,
+	})
+}
+
+func (handler *Handler) RevokeSession(ctx echo.Context) error {
+	slog.Info("new request: received session revoke request")
+	err := handler.service.RevokeSession(ctx, ctx.Param("id"))
+	if errors.Is(err, service.ErrNoSession) {
+		return ctx.JSON(http.StatusNotFound, map[string]string{"error": "Session not found"})
+	}
+	if err != nil {
+		return err
+	}
+	slog.Info("ok: session revoked")
+	return ctx.JSON(http.StatusOK, echo.Map{
+		"message": "Session revoked",
+	})
+}
@@ -0,0 +1,46 @@
+package handler
+
+import (
+	"errors"
+	"gw-wallet/internal/auth"
+	"gw-wallet/internal/repository"
+	"gw-wallet/internal/service"
+	"log/slog"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+func (handler *Handler) StepUp(ctx echo.Context) error {
+	slog.Info("new request: received step-up request")
+	request := new(repository.StepUpRequest)
+	if err := ctx.Bind(request); err != nil || (request.Password == "" && request.Code == "" && request.RecoveryCode == "") {
+		return echo.ErrBadRequest
+	}
+	token, err := handler.service.StepUp(ctx, request)
+	var throttled *service.ThrottledError
+	switch {
+	case errors.As(err, &throttled):
+		return tooManyLogins(ctx, throttled)
+	case errors.Is(err, auth.ErrHasherBusy):
+		return hasherBusy(ctx)
+	case errors.Is(err, service.ErrInvalidMFACode):
+		return ctx.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid password or code"})
+	case err != nil:
+		return err
+	}
+	slog.Info("ok: token elevated")
+	return ctx.JSON(http.StatusOK, echo.Map{
+		"token": token,
+	})
+}
+
+// stepUpRequired tells the client to go through /api/v1/auth/step-up and
+// repeat the request with the token it gets.
+func stepUpRequired(ctx echo.Context) error {
+	slog.Info("forbidden: step-up required")
+	return ctx.JSON(http.StatusForbidden, echo.Map{
+		"error":            "Confirm your identity to continue",
+		"step_up_required": true,
+	})
+}
@@ -0,0 +1,70 @@
+// Package mailer sends the emails of the wallet. Only development mailers
+// exist for now: one writes to the log, the other to files.
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"gw-wallet/internal/config"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	Send(ctx context.Context, message *Message) error
+}
+
+// New picks the mailer set by MAILER.
+func New(cfg *config.Config) Mailer {
+	if cfg.MailConfig.Mailer == "file" {
+		return &FileMailer{Dir: cfg.MailConfig.Dir, From: cfg.MailConfig.From}
+	}
+	return &LogMailer{}
+}
+
+// LogMailer writes the whole message, links included, to the log.
+type LogMailer struct{}
+
+func (mailer *LogMailer) Send(ctx context.Context, message *Message) error {
+	slog.Info("mailer: email", "to", message.To, "subject", message.Subject, "body", message.Body)
+	return nil
+}
+
+// FileMailer writes every message to its own .eml file in Dir.
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+func (mailer *FileMailer) Send(ctx context.Context, message *Message) error {
+	if err := os.MkdirAll(mailer.Dir, 0o700); err != nil {
+		return err
+	}
+	now := time.Now()
+	name := fmt.Sprintf("%d-%s.eml", now.UnixNano(), strings.Map(fileSafe, message.To))
+
+	var text strings.Builder
+	fmt.Fprintf(&text, "From: %s\r\n", mailer.From)
+	fmt.Fprintf(&text, "To: %s\r\n", message.To)
+	fmt.Fprintf(&text, "Subject: %s\r\n", message.Subject)
+	fmt.Fprintf(&text, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	text.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	text.WriteString(strings.ReplaceAll(message.Body, "\n", "\r\n"))
+	return os.WriteFile(filepath.Join(mailer.Dir, name), []byte(text.String()), 0o600)
+}
+
+func fileSafe(r rune) rune {
+	if r == '/' || r == '\\' || r < ' ' {
+		return '_'
+	}
+	return r
+}
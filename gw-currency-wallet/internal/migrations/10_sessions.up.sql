@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS public.sessions
+(
+    id uuid NOT NULL DEFAULT gen_random_uuid(),
+    user_id uuid NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    user_agent text NOT NULL,
+    ip text NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    last_seen_at timestamptz NOT NULL DEFAULT now(),
+    expires_at timestamptz NOT NULL,
+    revoked_at timestamptz,
+    CONSTRAINT sessions_primary PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS sessions_user_id ON sessions (user_id);
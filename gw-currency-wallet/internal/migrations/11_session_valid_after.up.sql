@@ -0,0 +1,5 @@
+-- sessions from before this were revoked on every later change, so their
+-- start is close enough
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS valid_after timestamptz;
+UPDATE sessions SET valid_after = created_at WHERE valid_after IS NULL;
+ALTER TABLE sessions ALTER COLUMN valid_after SET NOT NULL;
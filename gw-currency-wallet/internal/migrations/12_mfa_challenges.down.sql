@@ -0,0 +1 @@
+DROP TABLE IF EXISTS public.used_mfa_challenges;
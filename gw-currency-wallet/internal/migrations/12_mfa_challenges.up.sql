@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS public.used_mfa_challenges
+(
+    id text NOT NULL,
+    expires_at timestamptz NOT NULL,
+    CONSTRAINT used_mfa_challenges_primary PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS used_mfa_challenges_expires_at ON used_mfa_challenges (expires_at);
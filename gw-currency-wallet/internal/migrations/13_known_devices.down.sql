@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS sessions_revoked_at;
+DROP INDEX IF EXISTS sessions_expires_at;
+DROP TABLE IF EXISTS public.known_devices;
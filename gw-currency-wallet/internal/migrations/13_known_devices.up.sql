@@ -0,0 +1,19 @@
+-- devices are remembered apart from sessions, by a hash of the user agent,
+-- so expired sessions can be deleted without old devices looking new
+CREATE TABLE IF NOT EXISTS public.known_devices
+(
+    user_id uuid NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    fingerprint text NOT NULL,
+    last_seen_at timestamptz NOT NULL DEFAULT now(),
+    CONSTRAINT known_devices_primary PRIMARY KEY (user_id, fingerprint)
+);
+INSERT INTO known_devices (user_id, fingerprint, last_seen_at)
+SELECT user_id, fingerprint, last_seen_at FROM (
+    SELECT user_id, encode(sha256(convert_to(user_agent, 'UTF8')), 'hex') AS fingerprint, max(created_at) AS last_seen_at,
+        row_number() OVER (PARTITION BY user_id ORDER BY max(created_at) DESC) AS newest
+    FROM sessions GROUP BY user_id, user_agent
+) devices WHERE newest <= 20
+ON CONFLICT DO NOTHING;
+
+CREATE INDEX IF NOT EXISTS sessions_expires_at ON sessions (expires_at);
+CREATE INDEX IF NOT EXISTS sessions_revoked_at ON sessions (revoked_at);
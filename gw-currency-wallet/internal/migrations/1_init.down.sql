@@ -1 +1 @@
-DROP TABLE IF EXISTS public.wallets
\ No newline at end of file
+DROP TABLE IF EXISTS public.wallets;
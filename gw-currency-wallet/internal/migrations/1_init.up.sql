@@ -9,4 +9,4 @@ CREATE TABLE IF NOT EXISTS public.wallets
     CONSTRAINT key_primary PRIMARY KEY (username),
     CONSTRAINT unique_credentials UNIQUE (username, email),
     CONSTRAINT negative_balance CHECK (balance_usd >= 0::numeric AND balance_rub >= 0::numeric AND balance_eur >= 0::numeric) NOT VALID
-)
\ No newline at end of file
+);
@@ -1 +1 @@
-DELETE * FROM wallets
\ No newline at end of file
+DELETE FROM wallets WHERE username = 'user';
@@ -0,0 +1,3 @@
+ALTER TABLE wallets ADD COLUMN IF NOT EXISTS email_verified boolean NOT NULL DEFAULT false;
+-- accounts from before verification existed keep working
+UPDATE wallets SET email_verified = true;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS public.password_resets;
+ALTER TABLE wallets DROP COLUMN IF EXISTS password_changed_at;
@@ -0,0 +1,12 @@
+ALTER TABLE wallets ADD COLUMN IF NOT EXISTS password_changed_at timestamptz NOT NULL DEFAULT now();
+
+CREATE TABLE IF NOT EXISTS public.password_resets
+(
+    token_hash text NOT NULL,
+    username text NOT NULL REFERENCES wallets (username) ON DELETE CASCADE,
+    expires_at timestamptz NOT NULL,
+    used_at timestamptz,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    CONSTRAINT password_resets_primary PRIMARY KEY (token_hash)
+);
+CREATE INDEX IF NOT EXISTS password_resets_username ON password_resets (username);
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS public.login_failures
+(
+    key text NOT NULL,
+    failures integer NOT NULL,
+    last_failure_at timestamptz NOT NULL,
+    locked_until timestamptz,
+    CONSTRAINT login_failures_primary PRIMARY KEY (key)
+);
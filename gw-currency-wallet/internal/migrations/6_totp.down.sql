@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS public.recovery_codes;
+ALTER TABLE wallets DROP COLUMN IF EXISTS totp_last_step;
+ALTER TABLE wallets DROP COLUMN IF EXISTS totp_enabled;
+ALTER TABLE wallets DROP COLUMN IF EXISTS totp_secret;
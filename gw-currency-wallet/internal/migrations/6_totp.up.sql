@@ -0,0 +1,11 @@
+ALTER TABLE wallets ADD COLUMN IF NOT EXISTS totp_secret text;
+ALTER TABLE wallets ADD COLUMN IF NOT EXISTS totp_enabled boolean NOT NULL DEFAULT false;
+ALTER TABLE wallets ADD COLUMN IF NOT EXISTS totp_last_step bigint NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS public.recovery_codes
+(
+    username text NOT NULL REFERENCES wallets (username) ON DELETE CASCADE,
+    code_hash text NOT NULL,
+    used_at timestamptz,
+    CONSTRAINT recovery_codes_primary PRIMARY KEY (username, code_hash)
+);
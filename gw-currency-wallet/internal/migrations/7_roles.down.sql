@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS public.user_roles;
+DROP TABLE IF EXISTS public.role_permissions;
+DROP TABLE IF EXISTS public.roles;
+ALTER TABLE wallets DROP COLUMN IF EXISTS roles_changed_at;
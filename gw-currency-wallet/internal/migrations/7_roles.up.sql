@@ -0,0 +1,31 @@
+ALTER TABLE wallets ADD COLUMN IF NOT EXISTS roles_changed_at timestamptz NOT NULL DEFAULT now();
+
+CREATE TABLE IF NOT EXISTS public.roles
+(
+    name text NOT NULL,
+    CONSTRAINT roles_primary PRIMARY KEY (name)
+);
+
+CREATE TABLE IF NOT EXISTS public.role_permissions
+(
+    role text NOT NULL REFERENCES roles (name) ON DELETE CASCADE,
+    permission text NOT NULL,
+    CONSTRAINT role_permissions_primary PRIMARY KEY (role, permission)
+);
+
+CREATE TABLE IF NOT EXISTS public.user_roles
+(
+    username text NOT NULL REFERENCES wallets (username) ON DELETE CASCADE,
+    role text NOT NULL REFERENCES roles (name) ON DELETE CASCADE,
+    CONSTRAINT user_roles_primary PRIMARY KEY (username, role)
+);
+
+INSERT INTO roles (name) VALUES ('customer'), ('support'), ('admin') ON CONFLICT DO NOTHING;
+INSERT INTO role_permissions (role, permission) VALUES
+    ('customer', 'wallet:use'),
+    ('support', 'users:read'),
+    ('admin', 'users:read'),
+    ('admin', 'users:write')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO user_roles (username, role) SELECT username, 'customer' FROM wallets ON CONFLICT DO NOTHING;
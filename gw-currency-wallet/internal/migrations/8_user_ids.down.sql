@@ -0,0 +1,28 @@
+ALTER TABLE password_resets ADD COLUMN username text;
+UPDATE password_resets SET username = wallets.username FROM wallets WHERE wallets.id = password_resets.user_id;
+ALTER TABLE password_resets DROP COLUMN user_id;
+ALTER TABLE password_resets ALTER COLUMN username SET NOT NULL;
+
+ALTER TABLE recovery_codes ADD COLUMN username text;
+UPDATE recovery_codes SET username = wallets.username FROM wallets WHERE wallets.id = recovery_codes.user_id;
+ALTER TABLE recovery_codes DROP COLUMN user_id;
+ALTER TABLE recovery_codes ALTER COLUMN username SET NOT NULL;
+
+ALTER TABLE user_roles ADD COLUMN username text;
+UPDATE user_roles SET username = wallets.username FROM wallets WHERE wallets.id = user_roles.user_id;
+ALTER TABLE user_roles DROP COLUMN user_id;
+ALTER TABLE user_roles ALTER COLUMN username SET NOT NULL;
+
+ALTER TABLE wallets DROP CONSTRAINT key_primary;
+ALTER TABLE wallets DROP CONSTRAINT unique_username;
+ALTER TABLE wallets DROP CONSTRAINT unique_email;
+ALTER TABLE wallets DROP COLUMN id;
+ALTER TABLE wallets ADD CONSTRAINT key_primary PRIMARY KEY (username);
+ALTER TABLE wallets ADD CONSTRAINT unique_credentials UNIQUE (username, email);
+
+ALTER TABLE password_resets ADD FOREIGN KEY (username) REFERENCES wallets (username) ON DELETE CASCADE;
+CREATE INDEX IF NOT EXISTS password_resets_username ON password_resets (username);
+ALTER TABLE recovery_codes ADD FOREIGN KEY (username) REFERENCES wallets (username) ON DELETE CASCADE;
+ALTER TABLE recovery_codes ADD CONSTRAINT recovery_codes_primary PRIMARY KEY (username, code_hash);
+ALTER TABLE user_roles ADD FOREIGN KEY (username) REFERENCES wallets (username) ON DELETE CASCADE;
+ALTER TABLE user_roles ADD CONSTRAINT user_roles_primary PRIMARY KEY (username, role);
@@ -0,0 +1,47 @@
+-- users are identified by a generated id, username and email can change
+
+-- emails become unique below; accounts sharing one are not merged or
+-- changed here, so stop before touching anything and name them
+DO $$
+DECLARE
+    shared text;
+BEGIN
+    SELECT string_agg(format('%L (%s)', email, usernames), ', ') INTO shared
+    FROM (SELECT email, string_agg(username, ', ' ORDER BY username) AS usernames
+          FROM wallets GROUP BY email HAVING count(*) > 1) AS duplicates;
+    IF shared IS NOT NULL THEN
+        RAISE EXCEPTION 'emails shared by several accounts: %', shared
+            USING HINT = 'give each of these accounts its own email, then migrate again';
+    END IF;
+END $$;
+
+ALTER TABLE wallets ADD COLUMN IF NOT EXISTS id uuid NOT NULL DEFAULT gen_random_uuid();
+
+ALTER TABLE password_resets ADD COLUMN user_id uuid;
+UPDATE password_resets SET user_id = wallets.id FROM wallets WHERE wallets.username = password_resets.username;
+ALTER TABLE password_resets DROP COLUMN username;
+ALTER TABLE password_resets ALTER COLUMN user_id SET NOT NULL;
+
+ALTER TABLE recovery_codes ADD COLUMN user_id uuid;
+UPDATE recovery_codes SET user_id = wallets.id FROM wallets WHERE wallets.username = recovery_codes.username;
+ALTER TABLE recovery_codes DROP COLUMN username;
+ALTER TABLE recovery_codes ALTER COLUMN user_id SET NOT NULL;
+
+ALTER TABLE user_roles ADD COLUMN user_id uuid;
+UPDATE user_roles SET user_id = wallets.id FROM wallets WHERE wallets.username = user_roles.username;
+ALTER TABLE user_roles DROP COLUMN username;
+ALTER TABLE user_roles ALTER COLUMN user_id SET NOT NULL;
+
+-- the foreign keys on username went with the columns above
+ALTER TABLE wallets DROP CONSTRAINT key_primary;
+ALTER TABLE wallets DROP CONSTRAINT unique_credentials;
+ALTER TABLE wallets ADD CONSTRAINT key_primary PRIMARY KEY (id);
+ALTER TABLE wallets ADD CONSTRAINT unique_username UNIQUE (username);
+ALTER TABLE wallets ADD CONSTRAINT unique_email UNIQUE (email);
+
+ALTER TABLE password_resets ADD FOREIGN KEY (user_id) REFERENCES wallets (id) ON DELETE CASCADE;
+CREATE INDEX IF NOT EXISTS password_resets_user_id ON password_resets (user_id);
+ALTER TABLE recovery_codes ADD FOREIGN KEY (user_id) REFERENCES wallets (id) ON DELETE CASCADE;
+ALTER TABLE recovery_codes ADD CONSTRAINT recovery_codes_primary PRIMARY KEY (user_id, code_hash);
+ALTER TABLE user_roles ADD FOREIGN KEY (user_id) REFERENCES wallets (id) ON DELETE CASCADE;
+ALTER TABLE user_roles ADD CONSTRAINT user_roles_primary PRIMARY KEY (user_id, role);
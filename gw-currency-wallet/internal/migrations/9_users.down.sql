@@ -0,0 +1,12 @@
+ALTER TABLE users ADD COLUMN balance_usd numeric NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN balance_rub numeric NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN balance_eur numeric NOT NULL DEFAULT 0;
+UPDATE users SET balance_usd = wallets.balance_usd, balance_rub = wallets.balance_rub, balance_eur = wallets.balance_eur FROM wallets WHERE wallets.user_id = users.id;
+ALTER TABLE users ADD CONSTRAINT negative_balance CHECK (balance_usd >= 0::numeric AND balance_rub >= 0::numeric AND balance_eur >= 0::numeric) NOT VALID;
+DROP TABLE IF EXISTS public.wallets;
+
+ALTER TABLE users DROP CONSTRAINT preferred_currency;
+ALTER TABLE users DROP COLUMN IF EXISTS preferred_currency;
+ALTER TABLE users DROP COLUMN IF EXISTS created_at;
+ALTER TABLE users RENAME CONSTRAINT users_primary TO key_primary;
+ALTER TABLE users RENAME TO wallets;
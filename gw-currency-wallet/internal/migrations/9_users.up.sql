@@ -0,0 +1,22 @@
+-- identity moves to users, wallets keep only the balances
+ALTER TABLE wallets RENAME TO users;
+ALTER TABLE users RENAME CONSTRAINT key_primary TO users_primary;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS created_at timestamptz NOT NULL DEFAULT now();
+ALTER TABLE users ADD COLUMN IF NOT EXISTS preferred_currency text NOT NULL DEFAULT 'USD';
+ALTER TABLE users ADD CONSTRAINT preferred_currency CHECK (preferred_currency IN ('USD', 'RUB', 'EUR'));
+
+CREATE TABLE IF NOT EXISTS public.wallets
+(
+    user_id uuid NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    balance_usd numeric NOT NULL DEFAULT 0,
+    balance_rub numeric NOT NULL DEFAULT 0,
+    balance_eur numeric NOT NULL DEFAULT 0,
+    CONSTRAINT key_primary PRIMARY KEY (user_id)
+);
+INSERT INTO wallets (user_id, balance_usd, balance_rub, balance_eur) SELECT id, balance_usd, balance_rub, balance_eur FROM users;
+ALTER TABLE wallets ADD CONSTRAINT negative_balance CHECK (balance_usd >= 0::numeric AND balance_rub >= 0::numeric AND balance_eur >= 0::numeric) NOT VALID;
+
+ALTER TABLE users DROP CONSTRAINT negative_balance;
+ALTER TABLE users DROP COLUMN balance_usd;
+ALTER TABLE users DROP COLUMN balance_rub;
+ALTER TABLE users DROP COLUMN balance_eur;
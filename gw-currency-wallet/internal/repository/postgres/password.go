@@ -0,0 +1,82 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"gw-wallet/internal/repository"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/labstack/echo/v4"
+)
+
+// UpdatePassword stamps the change with the clock of the service rather than
+// the database, as it is compared with the issue times of access tokens.
+func (repo *PostgresRepo) UpdatePassword(ctx echo.Context, userId string, passwordHash string) error {
+	tx, err := repo.db.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(context.Background())
+
+	tag, err := tx.Exec(context.Background(), "update users set password_hash = $1, password_changed_at = $2 where id = $3", passwordHash, time.Now(), userId)
+	if err != nil {
+		slog.Error("internal server error: cannot update password: " + err.Error())
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return repository.ErrUserNotFound
+	}
+	if err := revokeSessions(tx, userId); err != nil {
+		return err
+	}
+	return tx.Commit(context.Background())
+}
+
+func (repo *PostgresRepo) RehashPassword(ctx echo.Context, userId string, oldHash string, newHash string) error {
+	_, err := repo.db.Exec(context.Background(), "update users set password_hash = $1 where id = $2 and password_hash = $3", newHash, userId, oldHash)
+	if err != nil {
+		slog.Error("internal server error: cannot rehash password: " + err.Error())
+	}
+	return err
+}
+
+func (repo *PostgresRepo) CreatePasswordReset(ctx echo.Context, userId string, tokenHash string, expiresAt time.Time) error {
+	_, err := repo.db.Exec(context.Background(), "insert into password_resets (token_hash, user_id, expires_at) values ($1, $2, $3)", tokenHash, userId, expiresAt)
+	if err != nil {
+		slog.Error("internal server error: cannot insert password reset: " + err.Error())
+	}
+	return err
+}
+
+// ResetPassword uses up every outstanding reset token of the user, not just
+// the one presented, so an older link cannot undo the reset.
+func (repo *PostgresRepo) ResetPassword(ctx echo.Context, tokenHash string, passwordHash string) (string, error) {
+	tx, err := repo.db.Begin(context.Background())
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback(context.Background())
+
+	var userId string
+	err = tx.QueryRow(context.Background(), "update password_resets set used_at = now() where token_hash = $1 and used_at is null and expires_at > now() returning user_id", tokenHash).Scan(&userId)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", repository.ErrTokenNotFound
+	}
+	if err != nil {
+		slog.Error("internal server error: cannot use password reset: " + err.Error())
+		return "", err
+	}
+	if _, err := tx.Exec(context.Background(), "update password_resets set used_at = now() where user_id = $1 and used_at is null", userId); err != nil {
+		return "", err
+	}
+	if _, err := tx.Exec(context.Background(), "update users set password_hash = $1, password_changed_at = $2 where id = $3", passwordHash, time.Now(), userId); err != nil {
+		slog.Error("internal server error: cannot update password: " + err.Error())
+		return "", err
+	}
+	if err := revokeSessions(tx, userId); err != nil {
+		return "", err
+	}
+	return userId, tx.Commit(context.Background())
+}
@@ -2,16 +2,20 @@ package postgres
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"gw-wallet/internal/auth"
 	"gw-wallet/internal/repository"
 	"gw-wallet/internal/types"
+	"io"
 	"log/slog"
-	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/labstack/echo/v4"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/lynxbites/wallet-services/gw-shared/events"
 )
 
 type PostgresRepo struct {
@@ -26,50 +30,84 @@ func NewPostgresRepo(connStr string) (*PostgresRepo, error) {
 	return &PostgresRepo{db: pool}, nil
 }
 
-func (repo *PostgresRepo) RegisterUser(ctx echo.Context, request *repository.RegisterRequest) error {
+func (repo *PostgresRepo) RegisterUser(ctx echo.Context, request *repository.RegisterRequest, passwordHash string) (string, error) {
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(request.Password), 12)
+	tx, err := repo.db.Begin(context.Background())
 	if err != nil {
-		slog.Error("internal error: cannot hash password: " + err.Error())
-		return echo.ErrInternalServerError
+		return "", err
 	}
+	defer tx.Rollback(context.Background())
 
-	_, err = repo.db.Exec(context.Background(), "insert into wallets (username, password_hash, email) values ($1, $2, $3)", request.Username, string(hashedPassword[:]), request.Email)
+	var userId string
+	err = tx.QueryRow(context.Background(), "insert into users (username, password_hash, email) values ($1, $2, $3) returning id", request.Username, passwordHash, request.Email).Scan(&userId)
 	if err != nil {
 		slog.Error("internal error: cannot insert in db: " + err.Error())
-		return err
+		return "", err
+	}
+	_, err = tx.Exec(context.Background(), "insert into wallets (user_id) values ($1)", userId)
+	if err != nil {
+		slog.Error("internal error: cannot create wallet: " + err.Error())
+		return "", err
+	}
+	_, err = tx.Exec(context.Background(), "insert into user_roles (user_id, role) values ($1, $2)", userId, auth.RoleCustomer)
+	if err != nil {
+		slog.Error("internal error: cannot grant customer role: " + err.Error())
+		return "", err
 	}
 
-	return nil
+	return userId, tx.Commit(context.Background())
 }
 
-func (repo *PostgresRepo) LoginUser(ctx echo.Context, request *repository.LoginRequest) (string, error) { //select exists (select username from wallets where (username = 'floppa' and password_hash = ''))
-	var hashedPassword string
+// userColumns are read by scanUser.
+const userColumns = "id, username, password_hash, email, email_verified, created_at, preferred_currency, password_changed_at, roles_changed_at, coalesce(totp_secret, ''), totp_enabled, totp_last_step"
 
-	repo.db.QueryRow(context.Background(), "select password_hash from wallets where username = $1", request.Username).Scan(&hashedPassword)
-	// fmt.Printf("%v\n", hashedPassword)
+func scanUser(row pgx.Row) (*repository.User, error) {
+	user := new(repository.User)
+	err := row.Scan(&user.Id, &user.Username, &user.PasswordHash, &user.Email, &user.EmailVerified, &user.CreatedAt, &user.PreferredCurrency, &user.PasswordChangedAt, &user.RolesChangedAt, &user.TOTPSecret, &user.TOTPEnabled, &user.TOTPLastStep)
+	return user, err
+}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(request.Password)); err != nil {
-		slog.Info("unauthorized: invalid password")
-		return "", echo.ErrUnauthorized
+func (repo *PostgresRepo) GetUser(ctx echo.Context, userId string) (*repository.User, error) {
+	// tokens from before user ids carry no id, or a username
+	if uuid.Validate(userId) != nil {
+		return nil, repository.ErrUserNotFound
 	}
+	return repo.selectUser("id", userId)
+}
 
-	newClaims := &types.JwtClaims{
-		Username: request.Username,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour * 1)),
-		},
-	}
+func (repo *PostgresRepo) GetUserByName(ctx echo.Context, username string) (*repository.User, error) {
+	return repo.selectUser("username", username)
+}
+
+func (repo *PostgresRepo) GetUserByEmail(ctx echo.Context, email string) (*repository.User, error) {
+	return repo.selectUser("email", email)
+}
 
-	unsignedToken := jwt.NewWithClaims(jwt.SigningMethodHS256, newClaims)
-	secret := "secret_key0000000000000000000000"
-	token, err := unsignedToken.SignedString([]byte(secret))
+func (repo *PostgresRepo) selectUser(column string, value string) (*repository.User, error) {
+	user, err := scanUser(repo.db.QueryRow(context.Background(), "select "+userColumns+" from users where "+column+" = $1", value))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, repository.ErrUserNotFound
+	}
 	if err != nil {
-		slog.Error("internal server error: cannot sign string")
-		return "", echo.ErrInternalServerError
+		slog.Error("internal server error: cannot select user: " + err.Error())
+		return nil, err
 	}
+	return user, nil
+}
 
-	return token, nil
+func (repo *PostgresRepo) VerifyEmail(ctx echo.Context, userId string, email string) error {
+	if uuid.Validate(userId) != nil {
+		return repository.ErrUserNotFound
+	}
+	tag, err := repo.db.Exec(context.Background(), "update users set email_verified = true where id = $1 and email = $2", userId, email)
+	if err != nil {
+		slog.Error("internal server error: cannot verify email: " + err.Error())
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return repository.ErrUserNotFound
+	}
+	return nil
 }
 
 func (repo *PostgresRepo) GetBalance(ctx echo.Context) (*repository.BalanceResponse, error) {
@@ -81,9 +119,15 @@ func (repo *PostgresRepo) GetBalance(ctx echo.Context) (*repository.BalanceRespo
 	}
 
 	claims := user.Claims.(*types.JwtClaims)
+	return repo.GetUserBalance(ctx, claims.Subject)
+}
 
+func (repo *PostgresRepo) GetUserBalance(ctx echo.Context, userId string) (*repository.BalanceResponse, error) {
 	balanceResponse := new(repository.BalanceResponse)
-	err := repo.db.QueryRow(context.Background(), "select balance_usd, balance_rub, balance_eur from wallets where username = $1", claims.Username).Scan(&balanceResponse.Balance.USD, &balanceResponse.Balance.RUB, &balanceResponse.Balance.EUR)
+	err := repo.db.QueryRow(context.Background(), "select balance_usd, balance_rub, balance_eur from wallets where user_id = $1", userId).Scan(&balanceResponse.Balance.USD, &balanceResponse.Balance.RUB, &balanceResponse.Balance.EUR)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, repository.ErrUserNotFound
+	}
 	if err != nil {
 		slog.Error("internal server error: cannot scan into repository.BalanceResponse.Balance")
 		return nil, err
@@ -107,19 +151,19 @@ func (repo *PostgresRepo) Deposit(ctx echo.Context, request *repository.DepositR
 
 	switch request.Currency {
 	case "USD":
-		_, err := repo.db.Exec(context.Background(), "update wallets set balance_usd = balance_usd + $1 where username = $2", request.Amount, claims.Username)
+		_, err := repo.db.Exec(context.Background(), "update wallets set balance_usd = balance_usd + $1 where user_id = $2", request.Amount, claims.Subject)
 		if err != nil {
 			slog.Error("internal server error: cannot update postgres db")
 			return nil, err
 		}
 	case "RUB":
-		_, err := repo.db.Exec(context.Background(), "update wallets set balance_rub = balance_rub + $1 where username = $2", request.Amount, claims.Username)
+		_, err := repo.db.Exec(context.Background(), "update wallets set balance_rub = balance_rub + $1 where user_id = $2", request.Amount, claims.Subject)
 		if err != nil {
 			slog.Error("internal server error: cannot update postgres db")
 			return nil, err
 		}
 	case "EUR":
-		_, err := repo.db.Exec(context.Background(), "update wallets set balance_eur = balance_eur + $1 where username = $2", request.Amount, claims.Username)
+		_, err := repo.db.Exec(context.Background(), "update wallets set balance_eur = balance_eur + $1 where user_id = $2", request.Amount, claims.Subject)
 		if err != nil {
 			slog.Error("internal server error: cannot update postgres db")
 			return nil, err
@@ -130,7 +174,7 @@ func (repo *PostgresRepo) Deposit(ctx echo.Context, request *repository.DepositR
 	}
 
 	depositResponse := new(repository.DepositResponse)
-	err := repo.db.QueryRow(context.Background(), "select balance_usd, balance_rub, balance_eur from wallets where username = $1", claims.Username).Scan(&depositResponse.NewBalance.USD, &depositResponse.NewBalance.RUB, &depositResponse.NewBalance.EUR)
+	err := repo.db.QueryRow(context.Background(), "select balance_usd, balance_rub, balance_eur from wallets where user_id = $1", claims.Subject).Scan(&depositResponse.NewBalance.USD, &depositResponse.NewBalance.RUB, &depositResponse.NewBalance.EUR)
 	if err != nil {
 		slog.Error("internal server error: cannot scan into repository.DepositResponse.Newbalance")
 		return nil, err
@@ -157,19 +201,19 @@ func (repo *PostgresRepo) Withdraw(ctx echo.Context, request *repository.Withdra
 
 	switch request.Currency {
 	case "USD":
-		_, err := repo.db.Exec(context.Background(), "update wallets set balance_usd = balance_usd - $1 where username = $2", request.Amount, claims.Username)
+		_, err := repo.db.Exec(context.Background(), "update wallets set balance_usd = balance_usd - $1 where user_id = $2", request.Amount, claims.Subject)
 		if err != nil {
 			slog.Error("internal server error: cannot update postgres db")
 			return nil, err
 		}
 	case "RUB":
-		_, err := repo.db.Exec(context.Background(), "update wallets set balance_rub = balance_rub - $1 where username = $2", request.Amount, claims.Username)
+		_, err := repo.db.Exec(context.Background(), "update wallets set balance_rub = balance_rub - $1 where user_id = $2", request.Amount, claims.Subject)
 		if err != nil {
 			slog.Error("internal server error: cannot update postgres db")
 			return nil, err
 		}
 	case "EUR":
-		_, err := repo.db.Exec(context.Background(), "update wallets set balance_eur = balance_eur - $1 where username = $2", request.Amount, claims.Username)
+		_, err := repo.db.Exec(context.Background(), "update wallets set balance_eur = balance_eur - $1 where user_id = $2", request.Amount, claims.Subject)
 		if err != nil {
 			slog.Error("internal server error: cannot update postgres db")
 			return nil, err
@@ -180,7 +224,7 @@ func (repo *PostgresRepo) Withdraw(ctx echo.Context, request *repository.Withdra
 	}
 
 	withdrawResponse := new(repository.WithdrawResponse)
-	err := repo.db.QueryRow(context.Background(), "select balance_usd, balance_rub, balance_eur from wallets where username = $1", claims.Username).Scan(&withdrawResponse.NewBalance.USD, &withdrawResponse.NewBalance.RUB, &withdrawResponse.NewBalance.EUR)
+	err := repo.db.QueryRow(context.Background(), "select balance_usd, balance_rub, balance_eur from wallets where user_id = $1", claims.Subject).Scan(&withdrawResponse.NewBalance.USD, &withdrawResponse.NewBalance.RUB, &withdrawResponse.NewBalance.EUR)
 	if err != nil {
 		slog.Error("internal server error: cannot scan into withdrawResponse.NewBalance")
 		return nil, err
@@ -210,7 +254,7 @@ func (repo *PostgresRepo) Exchange(ctx echo.Context, request *repository.Exchang
 	claims := user.Claims.(*types.JwtClaims)
 
 	oldBalance := new(repository.Balance)
-	err := repo.db.QueryRow(context.Background(), "select (balance_usd,balance_rub,balance_eur) from wallets where username = $1", claims.Username).Scan(oldBalance)
+	err := repo.db.QueryRow(context.Background(), "select (balance_usd,balance_rub,balance_eur) from wallets where user_id = $1", claims.Subject).Scan(oldBalance)
 	if err != nil {
 		slog.Error("internal server error: cannot scan into oldBalance - repository.Balance")
 		return nil, echo.ErrInternalServerError
@@ -231,7 +275,7 @@ func (repo *PostgresRepo) Exchange(ctx echo.Context, request *repository.Exchang
 	newBalanceMap[request.FromCurrency] = newBalanceMap[request.FromCurrency] - request.Amount
 	newBalanceMap[request.ToCurrency] = newBalanceMap[request.ToCurrency] + request.Amount*request.Rate
 	fmt.Printf("New Balance: %v\n", newBalanceMap)
-	_, err = repo.db.Exec(context.Background(), "update wallets set balance_usd = $1, balance_rub = $2, balance_eur = $3 where username = $4", newBalanceMap["USD"], newBalanceMap["RUB"], newBalanceMap["EUR"], claims.Username)
+	_, err = repo.db.Exec(context.Background(), "update wallets set balance_usd = $1, balance_rub = $2, balance_eur = $3 where user_id = $4", newBalanceMap["USD"], newBalanceMap["RUB"], newBalanceMap["EUR"], claims.Subject)
 	if err != nil {
 		slog.Error("internal server error: cannot scan into newBalanceMap")
 		return nil, echo.ErrInternalServerError
@@ -246,3 +290,24 @@ func (repo *PostgresRepo) Exchange(ctx echo.Context, request *repository.Exchang
 		},
 	}, nil
 }
+
+// ExportUserIds writes the id and username of every user, for the broker to
+// move data it stored under usernames to ids.
+func (repo *PostgresRepo) ExportUserIds(w io.Writer) error {
+	rows, err := repo.db.Query(context.Background(), "select id, username from users order by username")
+	if err != nil {
+		slog.Error("internal server error: cannot select users: " + err.Error())
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var mapping events.UserIdMapping
+		if err := rows.Scan(&mapping.Id, &mapping.Username); err != nil {
+			return err
+		}
+		if err := events.WriteUserIdMapping(w, &mapping); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
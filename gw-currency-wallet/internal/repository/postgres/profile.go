@@ -0,0 +1,31 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"gw-wallet/internal/repository"
+	"log/slog"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/labstack/echo/v4"
+)
+
+// UpdateProfile changes both fields in one statement, so a taken email
+// leaves the currency as it was too.
+func (repo *PostgresRepo) UpdateProfile(ctx echo.Context, userId string, email *string, currency *string) error {
+	tag, err := repo.db.Exec(context.Background(), `update users set email = coalesce($1, email),
+		email_verified = email_verified and $1::text is null, preferred_currency = coalesce($2, preferred_currency)
+		where id = $3`, email, currency, userId)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return repository.ErrEmailTaken
+	}
+	if err != nil {
+		slog.Error("internal server error: cannot update profile: " + err.Error())
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return repository.ErrUserNotFound
+	}
+	return nil
+}
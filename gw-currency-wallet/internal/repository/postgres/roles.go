@@ -0,0 +1,63 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"gw-wallet/internal/repository"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/labstack/echo/v4"
+)
+
+func (repo *PostgresRepo) GetPermissions(ctx echo.Context, userId string) ([]string, []string, error) {
+	var roles, permissions []string
+	err := repo.db.QueryRow(context.Background(), `
+		select
+			coalesce(array_agg(distinct user_roles.role), '{}'),
+			coalesce(array_agg(distinct role_permissions.permission) filter (where role_permissions.permission is not null), '{}')
+		from user_roles
+		left join role_permissions on role_permissions.role = user_roles.role
+		where user_roles.user_id = $1`, userId).Scan(&roles, &permissions)
+	if err != nil {
+		slog.Error("internal server error: cannot select permissions: " + err.Error())
+		return nil, nil, err
+	}
+	return roles, permissions, nil
+}
+
+func (repo *PostgresRepo) SetRoles(ctx echo.Context, userId string, roles []string) error {
+	tx, err := repo.db.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(context.Background())
+
+	tag, err := tx.Exec(context.Background(), "update users set roles_changed_at = $1 where id = $2", time.Now(), userId)
+	if err != nil {
+		slog.Error("internal server error: cannot update roles_changed_at: " + err.Error())
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return repository.ErrUserNotFound
+	}
+	if err := revokeSessions(tx, userId); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(context.Background(), "delete from user_roles where user_id = $1", userId); err != nil {
+		return err
+	}
+	for _, role := range roles {
+		_, err := tx.Exec(context.Background(), "insert into user_roles (user_id, role) values ($1, $2) on conflict do nothing", userId, role)
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+			return repository.ErrUnknownRole
+		}
+		if err != nil {
+			slog.Error("internal server error: cannot insert user role: " + err.Error())
+			return err
+		}
+	}
+	return tx.Commit(context.Background())
+}
@@ -0,0 +1,152 @@
+package postgres
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"gw-wallet/internal/repository"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/labstack/echo/v4"
+)
+
+// sessionColumns are read by scanSession.
+const sessionColumns = "id, user_id, user_agent, ip, created_at, last_seen_at, expires_at, revoked_at, valid_after"
+
+func scanSession(row pgx.Row) (*repository.Session, error) {
+	session := new(repository.Session)
+	err := row.Scan(&session.Id, &session.UserId, &session.UserAgent, &session.IP, &session.CreatedAt, &session.LastSeenAt, &session.ExpiresAt, &session.RevokedAt, &session.ValidAfter)
+	return session, err
+}
+
+// maxKnownDevices bounds the devices remembered per user; the ones not
+// seen for the longest are forgotten first.
+const maxKnownDevices = 20
+
+// deviceFingerprint matches the one migration 13 computed for the devices
+// of earlier sessions.
+func deviceFingerprint(userAgent string) string {
+	sum := sha256.Sum256([]byte(userAgent))
+	return hex.EncodeToString(sum[:])
+}
+
+func (repo *PostgresRepo) CreateSession(ctx echo.Context, session *repository.Session) (bool, error) {
+	tx, err := repo.db.Begin(context.Background())
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(context.Background())
+
+	fingerprint := deviceFingerprint(session.UserAgent)
+	var known, seen bool
+	err = tx.QueryRow(context.Background(), `
+		select
+			exists (select 1 from known_devices where user_id = $1),
+			exists (select 1 from known_devices where user_id = $1 and fingerprint = $2)`, session.UserId, fingerprint).Scan(&known, &seen)
+	if err != nil {
+		slog.Error("internal server error: cannot look up devices: " + err.Error())
+		return false, err
+	}
+	err = tx.QueryRow(context.Background(), "insert into sessions (user_id, user_agent, ip, expires_at, valid_after) values ($1, $2, $3, $4, $5) returning id, created_at, last_seen_at",
+		session.UserId, session.UserAgent, session.IP, session.ExpiresAt, session.ValidAfter).Scan(&session.Id, &session.CreatedAt, &session.LastSeenAt)
+	if err != nil {
+		slog.Error("internal server error: cannot insert session: " + err.Error())
+		return false, err
+	}
+	_, err = tx.Exec(context.Background(), `insert into known_devices (user_id, fingerprint) values ($1, $2)
+		on conflict (user_id, fingerprint) do update set last_seen_at = now()`, session.UserId, fingerprint)
+	if err != nil {
+		slog.Error("internal server error: cannot remember device: " + err.Error())
+		return false, err
+	}
+	_, err = tx.Exec(context.Background(), `delete from known_devices where user_id = $1 and fingerprint not in
+		(select fingerprint from known_devices where user_id = $1 order by last_seen_at desc limit $2)`, session.UserId, maxKnownDevices)
+	if err != nil {
+		slog.Error("internal server error: cannot forget old devices: " + err.Error())
+		return false, err
+	}
+	return known && !seen, tx.Commit(context.Background())
+}
+
+func (repo *PostgresRepo) GetSession(ctx echo.Context, sessionId string) (*repository.Session, error) {
+	if uuid.Validate(sessionId) != nil {
+		return nil, repository.ErrNoSession
+	}
+	session, err := scanSession(repo.db.QueryRow(context.Background(), "select "+sessionColumns+" from sessions where id = $1", sessionId))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, repository.ErrNoSession
+	}
+	if err != nil {
+		slog.Error("internal server error: cannot select session: " + err.Error())
+		return nil, err
+	}
+	return session, nil
+}
+
+func (repo *PostgresRepo) TouchSession(ctx echo.Context, sessionId string) error {
+	_, err := repo.db.Exec(context.Background(), "update sessions set last_seen_at = now() where id = $1", sessionId)
+	if err != nil {
+		slog.Error("internal server error: cannot touch session: " + err.Error())
+	}
+	return err
+}
+
+func (repo *PostgresRepo) ListSessions(ctx echo.Context, userId string) ([]repository.Session, error) {
+	rows, err := repo.db.Query(context.Background(), "select "+sessionColumns+" from sessions where user_id = $1 and revoked_at is null and expires_at > now() order by created_at desc", userId)
+	if err != nil {
+		slog.Error("internal server error: cannot select sessions: " + err.Error())
+		return nil, err
+	}
+	sessions, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (repository.Session, error) {
+		session, err := scanSession(row)
+		if err != nil {
+			return repository.Session{}, err
+		}
+		return *session, nil
+	})
+	if err != nil {
+		slog.Error("internal server error: cannot scan sessions: " + err.Error())
+		return nil, err
+	}
+	return sessions, nil
+}
+
+func (repo *PostgresRepo) RevokeSession(ctx echo.Context, userId string, sessionId string) error {
+	if uuid.Validate(sessionId) != nil {
+		return repository.ErrNoSession
+	}
+	tag, err := repo.db.Exec(context.Background(), "update sessions set revoked_at = now() where id = $1 and user_id = $2 and revoked_at is null", sessionId, userId)
+	if err != nil {
+		slog.Error("internal server error: cannot revoke session: " + err.Error())
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return repository.ErrNoSession
+	}
+	return nil
+}
+
+// revokeSessions ends every session of the user, as part of a password or
+// role change.
+func revokeSessions(tx pgx.Tx, userId string) error {
+	_, err := tx.Exec(context.Background(), "update sessions set revoked_at = now() where user_id = $1 and revoked_at is null", userId)
+	if err != nil {
+		slog.Error("internal server error: cannot revoke sessions: " + err.Error())
+	}
+	return err
+}
+
+// PruneSessions deletes the sessions that expired or were revoked before
+// the time and returns how many there were.
+func (repo *PostgresRepo) PruneSessions(before time.Time) (int64, error) {
+	tag, err := repo.db.Exec(context.Background(), "delete from sessions where expires_at < $1 or revoked_at < $1", before)
+	if err != nil {
+		slog.Error("internal server error: cannot delete old sessions: " + err.Error())
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
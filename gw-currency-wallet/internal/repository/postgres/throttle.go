@@ -0,0 +1,109 @@
+package postgres
+
+import (
+	"context"
+	"gw-wallet/internal/repository"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/labstack/echo/v4"
+)
+
+// ReserveLoginAttempt locks the keys in a fixed order, so two attempts for
+// the same user and address cannot deadlock.
+func (repo *PostgresRepo) ReserveLoginAttempt(ctx echo.Context, attempts []repository.LoginAttempt, now time.Time, allow func([]repository.LoginFailures) error) ([]repository.LoginFailures, error) {
+	attempts = slices.Clone(attempts)
+	slices.SortFunc(attempts, func(a, b repository.LoginAttempt) int { return strings.Compare(a.Key, b.Key) })
+	keys := make([]string, len(attempts))
+	for i, attempt := range attempts {
+		keys[i] = attempt.Key
+	}
+
+	tx, err := repo.db.Begin(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(context.Background())
+
+	if _, err := tx.Exec(context.Background(), "insert into login_failures (key, failures, last_failure_at) select unnest($1::text[]), 0, 'epoch' order by 1 on conflict (key) do nothing", keys); err != nil {
+		slog.Error("internal server error: cannot insert login failures: " + err.Error())
+		return nil, err
+	}
+	rows, err := tx.Query(context.Background(), "select key, failures, last_failure_at, coalesce(locked_until, 'epoch') from login_failures where key = any($1) order by key for update", keys)
+	if err != nil {
+		slog.Error("internal server error: cannot select login failures: " + err.Error())
+		return nil, err
+	}
+	stored, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (repository.LoginFailures, error) {
+		return scanLoginFailures(row)
+	})
+	if err != nil {
+		slog.Error("internal server error: cannot scan login failures: " + err.Error())
+		return nil, err
+	}
+	if err := allow(stored); err != nil {
+		return nil, err
+	}
+	previous := make(map[string]time.Time, len(stored))
+	for _, failures := range stored {
+		previous[failures.Key] = failures.LastFailureAt
+	}
+
+	reserved := make([]repository.LoginFailures, 0, len(attempts))
+	for _, attempt := range attempts {
+		failures, err := scanLoginFailures(tx.QueryRow(context.Background(), `
+			update login_failures set
+				failures = case when last_failure_at < $3 then 1 else failures + 1 end,
+				last_failure_at = $2
+			where key = $1
+			returning key, failures, last_failure_at, coalesce(locked_until, 'epoch')`,
+			attempt.Key, now, now.Add(-attempt.Window)))
+		if err != nil {
+			slog.Error("internal server error: cannot reserve login attempt: " + err.Error())
+			return nil, err
+		}
+		failures.PreviousFailureAt = previous[attempt.Key]
+		reserved = append(reserved, failures)
+	}
+	return reserved, tx.Commit(context.Background())
+}
+
+func scanLoginFailures(row pgx.Row) (repository.LoginFailures, error) {
+	var failures repository.LoginFailures
+	err := row.Scan(&failures.Key, &failures.Failures, &failures.LastFailureAt, &failures.LockedUntil)
+	return failures, err
+}
+
+// ReleaseLoginAttempt compares last_failure_at with the stamp read back when
+// the attempt was reserved, so both have the database's precision.
+func (repo *PostgresRepo) ReleaseLoginAttempt(ctx echo.Context, reserved repository.LoginFailures) error {
+	_, err := repo.db.Exec(context.Background(), `
+		update login_failures set
+			failures = greatest(failures - 1, 0),
+			last_failure_at = case when last_failure_at = $2 then $3 else last_failure_at end
+		where key = $1`,
+		reserved.Key, reserved.LastFailureAt, reserved.PreviousFailureAt)
+	if err != nil {
+		slog.Error("internal server error: cannot release login attempt: " + err.Error())
+	}
+	return err
+}
+
+func (repo *PostgresRepo) LockLogin(ctx echo.Context, key string, until time.Time) error {
+	_, err := repo.db.Exec(context.Background(), "update login_failures set locked_until = $1 where key = $2", until, key)
+	if err != nil {
+		slog.Error("internal server error: cannot lock login: " + err.Error())
+	}
+	return err
+}
+
+func (repo *PostgresRepo) ClearLoginFailures(ctx echo.Context, key string) error {
+	_, err := repo.db.Exec(context.Background(), "delete from login_failures where key = $1", key)
+	if err != nil {
+		slog.Error("internal server error: cannot clear login failures: " + err.Error())
+	}
+	return err
+}
@@ -0,0 +1,91 @@
+package postgres
+
+import (
+	"context"
+	"gw-wallet/internal/repository"
+	"log/slog"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+func (repo *PostgresRepo) SetTOTPSecret(ctx echo.Context, userId string, sealedSecret string) error {
+	tag, err := repo.db.Exec(context.Background(), "update users set totp_secret = $1 where id = $2 and not totp_enabled", sealedSecret, userId)
+	if err != nil {
+		slog.Error("internal server error: cannot set totp secret: " + err.Error())
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return repository.ErrTOTPEnabled
+	}
+	return nil
+}
+
+func (repo *PostgresRepo) EnableTOTP(ctx echo.Context, userId string, step int64, codeHashes []string) error {
+	tx, err := repo.db.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(context.Background())
+
+	tag, err := tx.Exec(context.Background(), "update users set totp_enabled = true, totp_last_step = $1 where id = $2 and not totp_enabled and totp_secret is not null", step, userId)
+	if err != nil {
+		slog.Error("internal server error: cannot enable totp: " + err.Error())
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return repository.ErrTOTPEnabled
+	}
+	if _, err := tx.Exec(context.Background(), "delete from recovery_codes where user_id = $1", userId); err != nil {
+		return err
+	}
+	for _, hash := range codeHashes {
+		if _, err := tx.Exec(context.Background(), "insert into recovery_codes (user_id, code_hash) values ($1, $2)", userId, hash); err != nil {
+			slog.Error("internal server error: cannot insert recovery code: " + err.Error())
+			return err
+		}
+	}
+	return tx.Commit(context.Background())
+}
+
+func (repo *PostgresRepo) UseTOTPStep(ctx echo.Context, userId string, step int64) error {
+	tag, err := repo.db.Exec(context.Background(), "update users set totp_last_step = $1 where id = $2 and totp_last_step < $1", step, userId)
+	if err != nil {
+		slog.Error("internal server error: cannot use totp step: " + err.Error())
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return repository.ErrTokenNotFound
+	}
+	return nil
+}
+
+func (repo *PostgresRepo) UseRecoveryCode(ctx echo.Context, userId string, codeHash string) error {
+	tag, err := repo.db.Exec(context.Background(), "update recovery_codes set used_at = now() where user_id = $1 and code_hash = $2 and used_at is null", userId, codeHash)
+	if err != nil {
+		slog.Error("internal server error: cannot use recovery code: " + err.Error())
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return repository.ErrTokenNotFound
+	}
+	return nil
+}
+
+// UseMFAChallenge also drops the ids of expired challenges, which can no
+// longer be presented anyway.
+func (repo *PostgresRepo) UseMFAChallenge(ctx echo.Context, challengeId string, expiresAt time.Time) error {
+	if _, err := repo.db.Exec(context.Background(), "delete from used_mfa_challenges where expires_at < now()"); err != nil {
+		slog.Error("internal server error: cannot delete used mfa challenges: " + err.Error())
+		return err
+	}
+	tag, err := repo.db.Exec(context.Background(), "insert into used_mfa_challenges (id, expires_at) values ($1, $2) on conflict (id) do nothing", challengeId, expiresAt)
+	if err != nil {
+		slog.Error("internal server error: cannot use mfa challenge: " + err.Error())
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return repository.ErrTokenNotFound
+	}
+	return nil
+}
@@ -1,11 +1,90 @@
 package repository
 
-import "github.com/labstack/echo/v4"
+import (
+	"errors"
+	"time"
 
+	"github.com/labstack/echo/v4"
+)
+
+var (
+	ErrUserNotFound  = errors.New("user not found")
+	ErrTokenNotFound = errors.New("token not found")
+	ErrTOTPEnabled   = errors.New("totp is already enabled")
+	ErrUnknownRole   = errors.New("unknown role")
+	ErrEmailTaken    = errors.New("email is already taken")
+	ErrNoSession     = errors.New("session not found")
+)
+
+// WalletRepo finds users by their id, except where a user gives their
+// username.
 type WalletRepo interface {
-	RegisterUser(ctx echo.Context, request *RegisterRequest) error
-	LoginUser(ctx echo.Context, request *LoginRequest) (string, error)
+	// RegisterUser returns the id of the new user.
+	RegisterUser(ctx echo.Context, request *RegisterRequest, passwordHash string) (string, error)
+	GetUser(ctx echo.Context, userId string) (*User, error)
+	GetUserByName(ctx echo.Context, username string) (*User, error)
+	// VerifyEmail marks the email verified if it is still the user's email.
+	VerifyEmail(ctx echo.Context, userId string, email string) error
+	// UpdateProfile sets the fields that are not nil, all or none of them.
+	// A new email is unverified. It fails with ErrEmailTaken when another
+	// user has the email.
+	UpdateProfile(ctx echo.Context, userId string, email *string, currency *string) error
+	// GetUserByEmail finds the user by their email, which is unique.
+	GetUserByEmail(ctx echo.Context, email string) (*User, error)
+	// UpdatePassword also moves password_changed_at and revokes the user's
+	// sessions.
+	UpdatePassword(ctx echo.Context, userId string, passwordHash string) error
+	// RehashPassword replaces a hash of the same password and leaves the
+	// sessions alone. It does nothing if the password changed meanwhile.
+	RehashPassword(ctx echo.Context, userId string, oldHash string, newHash string) error
+	CreatePasswordReset(ctx echo.Context, userId string, tokenHash string, expiresAt time.Time) error
+	// ResetPassword uses up the reset token, sets the password and revokes
+	// the sessions, returning the id of the user it belongs to. Expired and used tokens are not found.
+	ResetPassword(ctx echo.Context, tokenHash string, passwordHash string) (string, error)
+	// ReserveLoginAttempt counts an attempt as failed for every key before
+	// the credentials are checked, so concurrent attempts cannot all pass
+	// the same check. It locks the keys' failures and passes them to allow;
+	// only if allow returns nil is the attempt counted, starting over for a
+	// key whose last failure is older than its window. It returns the new
+	// counts.
+	ReserveLoginAttempt(ctx echo.Context, attempts []LoginAttempt, now time.Time, allow func([]LoginFailures) error) ([]LoginFailures, error)
+	// ReleaseLoginAttempt takes back an attempt as ReserveLoginAttempt
+	// returned it. The last failure goes back to the one before, unless
+	// another attempt was reserved since.
+	ReleaseLoginAttempt(ctx echo.Context, reserved LoginFailures) error
+	LockLogin(ctx echo.Context, key string, until time.Time) error
+	ClearLoginFailures(ctx echo.Context, key string) error
+	// SetTOTPSecret stores a secret waiting to be confirmed. It fails with
+	// ErrTOTPEnabled once TOTP is on.
+	SetTOTPSecret(ctx echo.Context, userId string, sealedSecret string) error
+	// EnableTOTP turns TOTP on and replaces the recovery codes.
+	EnableTOTP(ctx echo.Context, userId string, step int64, codeHashes []string) error
+	// UseTOTPStep records the step of an accepted code. It fails with
+	// ErrTokenNotFound for a step that was already used.
+	UseTOTPStep(ctx echo.Context, userId string, step int64) error
+	UseRecoveryCode(ctx echo.Context, userId string, codeHash string) error
+	// UseMFAChallenge records the id of a challenge that logged in. It fails
+	// with ErrTokenNotFound for one that was used before; ids are kept until
+	// expiresAt.
+	UseMFAChallenge(ctx echo.Context, challengeId string, expiresAt time.Time) error
+	// GetPermissions returns the user's roles and everything they grant.
+	GetPermissions(ctx echo.Context, userId string) ([]string, []string, error)
+	// SetRoles replaces the user's roles, moves roles_changed_at and revokes
+	// the sessions issued with the old ones.
+	SetRoles(ctx echo.Context, userId string, roles []string) error
+	// CreateSession fills in the id of the session and reports whether the
+	// user agent is new for the user. The first session of a user is not.
+	// Only the devices seen most recently are remembered.
+	CreateSession(ctx echo.Context, session *Session) (bool, error)
+	GetSession(ctx echo.Context, sessionId string) (*Session, error)
+	TouchSession(ctx echo.Context, sessionId string) error
+	// ListSessions returns the sessions that are neither revoked nor
+	// expired, newest first.
+	ListSessions(ctx echo.Context, userId string) ([]Session, error)
+	// RevokeSession fails with ErrNoSession unless the user has the session.
+	RevokeSession(ctx echo.Context, userId string, sessionId string) error
 	GetBalance(ctx echo.Context) (*BalanceResponse, error)
+	GetUserBalance(ctx echo.Context, userId string) (*BalanceResponse, error)
 	Deposit(ctx echo.Context, request *DepositRequest) (*DepositResponse, error)
 	Withdraw(ctx echo.Context, request *WithdrawRequest) (*WithdrawResponse, error)
 	Exchange(ctx echo.Context, request *ExchangeRequest) (*ExchangeResponse, error)
@@ -17,6 +96,128 @@ type RegisterRequest struct {
 	Email    string `json:"email"`
 }
 
+// User is identified by Id; Username and Email are unique but may change.
+type User struct {
+	Id            string
+	Username      string
+	PasswordHash  string
+	Email         string
+	EmailVerified bool
+	CreatedAt     time.Time
+	// PreferredCurrency is the one the user wants amounts shown in.
+	PreferredCurrency string
+	// PasswordChangedAt and RolesChangedAt end the sessions started before
+	// them.
+	PasswordChangedAt time.Time
+	RolesChangedAt    time.Time
+	// TOTPSecret is sealed with auth.SealSecret. It is set before TOTP is
+	// enabled, while the user confirms it.
+	TOTPSecret   string
+	TOTPEnabled  bool
+	TOTPLastStep int64
+}
+
+// Session is a login. Its id goes into the access token, which stops
+// working once the session is revoked.
+type Session struct {
+	Id         string     `json:"id"`
+	UserId     string     `json:"-"`
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"-"`
+	// ValidAfter is the later of the user's password and role changes as
+	// seen when the login was checked. A session from before the latest
+	// change is refused.
+	ValidAfter time.Time `json:"-"`
+	// Current marks the session of the request.
+	Current bool `json:"current"`
+}
+
+// LoginFailures are counted per key, which is "user:<username>" or
+// "ip:<address>".
+type LoginFailures struct {
+	Key           string
+	Failures      int
+	LastFailureAt time.Time
+	LockedUntil   time.Time
+	// PreviousFailureAt is LastFailureAt from before an attempt was
+	// reserved, set on what ReserveLoginAttempt returns.
+	PreviousFailureAt time.Time
+}
+
+// LoginAttempt names a key to count an attempt for and how long its
+// failures are remembered.
+type LoginAttempt struct {
+	Key    string
+	Window time.Duration
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+type ChangePasswordRequest struct {
+	OldPassword string `json:"old_password"`
+	NewPassword string `json:"new_password"`
+}
+
+type TOTPCodeRequest struct {
+	Code string `json:"code"`
+}
+
+type MFALoginRequest struct {
+	MFAToken     string `json:"mfa_token"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// StepUpRequest carries a password, or a TOTP or recovery code for users
+// with TOTP.
+type StepUpRequest struct {
+	Password     string `json:"password"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// Profile is what users see of their own account.
+type Profile struct {
+	Id                string    `json:"id"`
+	Username          string    `json:"username"`
+	Email             string    `json:"email"`
+	EmailVerified     bool      `json:"email_verified"`
+	CreatedAt         time.Time `json:"created_at"`
+	PreferredCurrency string    `json:"preferred_currency"`
+}
+
+// UpdateProfileRequest changes only the fields that are present.
+type UpdateProfileRequest struct {
+	Email             *string `json:"email"`
+	PreferredCurrency *string `json:"preferred_currency"`
+}
+
+type SetRolesRequest struct {
+	Roles []string `json:"roles"`
+}
+
+// UserView is what staff see of a user.
+type UserView struct {
+	Id            string   `json:"id"`
+	Username      string   `json:"username"`
+	Email         string   `json:"email"`
+	EmailVerified bool     `json:"email_verified"`
+	TOTPEnabled   bool     `json:"totp_enabled"`
+	Roles         []string `json:"roles"`
+	Balance       Balance  `json:"balance"`
+}
+
 type LoginRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
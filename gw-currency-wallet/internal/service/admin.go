@@ -0,0 +1,60 @@
+package service
+
+import (
+	"gw-wallet/internal/repository"
+	"log/slog"
+
+	"github.com/labstack/echo/v4"
+)
+
+// GetUserView is the support view of any user.
+func (service *Service) GetUserView(ctx echo.Context, username string) (*repository.UserView, error) {
+	user, err := service.repo.GetUserByName(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	roles, _, err := service.repo.GetPermissions(ctx, user.Id)
+	if err != nil {
+		return nil, err
+	}
+	balance, err := service.repo.GetUserBalance(ctx, user.Id)
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("staff: user viewed", "staff", claimsOf(ctx).Subject, "user", user.Id)
+	return &repository.UserView{
+		Id:            user.Id,
+		Username:      user.Username,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		TOTPEnabled:   user.TOTPEnabled,
+		Roles:         roles,
+		Balance:       repository.Balance(balance.Balance),
+	}, nil
+}
+
+// SetRoles replaces a user's roles. It needs an elevated token.
+func (service *Service) SetRoles(ctx echo.Context, username string, roles []string) error {
+	if err := service.requireElevated(ctx); err != nil {
+		return err
+	}
+	user, err := service.repo.GetUserByName(ctx, username)
+	if err != nil {
+		return err
+	}
+	if err := service.repo.SetRoles(ctx, user.Id, roles); err != nil {
+		return err
+	}
+	slog.Warn("staff: roles changed", "staff", claimsOf(ctx).Subject, "user", user.Id, "roles", roles)
+	return nil
+}
+
+// Unlock clears the failed logins of a username, lifting a lockout. Logins
+// are throttled by the name that was tried, so the user need not exist.
+func (service *Service) Unlock(ctx echo.Context, username string) error {
+	if err := service.repo.ClearLoginFailures(ctx, "user:"+username); err != nil {
+		return err
+	}
+	slog.Warn("staff: login unlocked", "staff", claimsOf(ctx).Subject, "username", username)
+	return nil
+}
@@ -0,0 +1,233 @@
+package service
+
+import (
+	"errors"
+	"gw-wallet/internal/auth"
+	"gw-wallet/internal/mailer"
+	"gw-wallet/internal/repository"
+	"gw-wallet/internal/types"
+	"log/slog"
+	"net/url"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+)
+
+const accessTokenTTL = time.Hour
+
+type authSettings struct {
+	signingKey string
+	verifyTTL  time.Duration
+	resetTTL   time.Duration
+	publicURL  string
+
+	userThrottle auth.ThrottlePolicy
+	ipThrottle   auth.ThrottlePolicy
+
+	stepUpTTL time.Duration
+	// stepUpWithdrawThresholds are kept per currency, as amounts in
+	// different currencies are not comparable
+	stepUpWithdrawThresholds map[string]float64
+
+	passwords *auth.PasswordHasher
+	policy    *auth.PasswordPolicy
+}
+
+// RegisterUser creates an unverified account and mails the verification
+// link. A failed mail does not fail the registration, the user can ask for
+// another link.
+func (service *Service) RegisterUser(ctx echo.Context, request *repository.RegisterRequest) error {
+	if err := service.auth.policy.Check(request.Password); err != nil {
+		return err
+	}
+	hash, err := service.auth.passwords.Hash(request.Password)
+	if err != nil {
+		return err
+	}
+	userId, err := service.repo.RegisterUser(ctx, request, hash)
+	if err != nil {
+		return err
+	}
+	if err := service.sendVerification(ctx, userId, request.Username, request.Email); err != nil {
+		slog.Error("mailer: cannot send verification email: " + err.Error())
+	}
+	return nil
+}
+
+// LoginResult holds either the access token or, for users with a second
+// factor, the challenge to pass to LoginMFA.
+type LoginResult struct {
+	Token    string
+	MFAToken string
+}
+
+// LoginUser checks the password unless failed logins for the username or
+// the address hold it up. Unknown users fail the same way, and as slowly,
+// as a wrong password. A password hashed by an older scheme or with older
+// parameters is hashed again. While the hasher is busy it fails with
+// auth.ErrHasherBusy without counting the attempt.
+func (service *Service) LoginUser(ctx echo.Context, request *repository.LoginRequest) (*LoginResult, error) {
+	keys := service.loginKeys(ctx, request.Username)
+	reserved, err := service.reserveAttempt(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := service.repo.GetUserByName(ctx, request.Username)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		// a busy hasher is no answer about the password, so the attempt
+		// is taken back
+		if err := service.auth.passwords.VerifyDummy(request.Password); err != nil {
+			service.releaseAttempt(ctx, reserved)
+			return nil, err
+		}
+		service.loginFailed(ctx, keys, reserved)
+		slog.Info("unauthorized: unknown user")
+		return nil, echo.ErrUnauthorized
+	}
+	if err != nil {
+		service.releaseAttempt(ctx, reserved)
+		return nil, err
+	}
+	ok, rehash, err := service.auth.passwords.Verify(user.PasswordHash, request.Password)
+	if err != nil {
+		service.releaseAttempt(ctx, reserved)
+		return nil, err
+	}
+	if !ok {
+		service.loginFailed(ctx, keys, reserved)
+		slog.Info("unauthorized: invalid password")
+		return nil, echo.ErrUnauthorized
+	}
+	if rehash {
+		service.rehashPassword(ctx, user, request.Password)
+	}
+
+	if user.TOTPEnabled {
+		// failures are cleared once the second factor is passed too, which
+		// reserves its own attempt
+		service.releaseAttempt(ctx, reserved)
+		challenge, err := auth.IssueMFAChallenge(service.auth.signingKey, user.Id, user.PasswordChangedAt, mfaChallengeTTL)
+		if err != nil {
+			return nil, err
+		}
+		return &LoginResult{MFAToken: challenge}, nil
+	}
+	if err := service.loginSucceeded(ctx, keys, reserved); err != nil {
+		return nil, err
+	}
+	token, err := service.issueAccessToken(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	return &LoginResult{Token: token}, nil
+}
+
+// issueAccessToken starts a session for the request and names the user by
+// id in the subject and the session in the token id; the username is only
+// there for display.
+func (service *Service) issueAccessToken(ctx echo.Context, user *repository.User) (string, error) {
+	roles, permissions, err := service.repo.GetPermissions(ctx, user.Id)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	session, err := service.startSession(ctx, user, now.Add(accessTokenTTL))
+	if err != nil {
+		return "", err
+	}
+	return service.signAccessToken(&types.JwtClaims{
+		Username:    user.Username,
+		Roles:       roles,
+		Permissions: permissions,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        session.Id,
+			Subject:   user.Id,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(accessTokenTTL)),
+		},
+	})
+}
+
+func (service *Service) signAccessToken(claims *types.JwtClaims) (string, error) {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(service.auth.signingKey))
+	if err != nil {
+		slog.Error("internal server error: cannot sign string")
+		return "", echo.ErrInternalServerError
+	}
+	return token, nil
+}
+
+// CheckSession refuses access tokens whose session was revoked or started
+// against an older password or roles than the user has now, and tokens from
+// before user ids and sessions. The session keeps the exact change time it
+// was checked against, so unlike the whole seconds of the token's iat it
+// also catches a login that races a reset.
+func (service *Service) CheckSession(ctx echo.Context) error {
+	claims := claimsOf(ctx)
+	user, err := service.repo.GetUser(ctx, claims.Subject)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return ErrSessionRevoked
+	}
+	if err != nil {
+		return err
+	}
+	return service.checkSession(ctx, user, claims.ID)
+}
+
+// VerifyEmail marks the email from the token verified. The token is refused
+// once the user has changed their email.
+func (service *Service) VerifyEmail(ctx echo.Context, token string) error {
+	claims, err := auth.ParseActionToken(service.auth.signingKey, auth.PurposeVerifyEmail, token)
+	if err != nil {
+		return err
+	}
+	err = service.repo.VerifyEmail(ctx, claims.Subject, claims.Email)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return auth.ErrInvalidToken
+	}
+	return err
+}
+
+// ResendVerification mails a new verification link to the logged in user.
+func (service *Service) ResendVerification(ctx echo.Context) error {
+	user, err := service.repo.GetUser(ctx, claimsOf(ctx).Subject)
+	if err != nil {
+		return err
+	}
+	if user.EmailVerified {
+		return ErrEmailAlreadyVerified
+	}
+	return service.sendVerification(ctx, user.Id, user.Username, user.Email)
+}
+
+func (service *Service) sendVerification(ctx echo.Context, userId string, username string, email string) error {
+	token, err := auth.IssueActionToken(service.auth.signingKey, auth.PurposeVerifyEmail, userId, email, service.auth.verifyTTL)
+	if err != nil {
+		return err
+	}
+	link := service.auth.publicURL + "/api/v1/verify?token=" + url.QueryEscape(token)
+	return service.mailer.Send(ctx.Request().Context(), &mailer.Message{
+		To:      email,
+		Subject: "Confirm your email",
+		Body:    "Hello, " + username + "!\n\nOpen the link below to confirm your email:\n\n" + link + "\n\nThe link is valid for " + service.auth.verifyTTL.String() + ".\n",
+	})
+}
+
+// requireVerified refuses operations that move money out of the wallet
+// until the user's email is verified.
+func (service *Service) requireVerified(ctx echo.Context) error {
+	user, err := service.repo.GetUser(ctx, claimsOf(ctx).Subject)
+	if err != nil {
+		return err
+	}
+	if !user.EmailVerified {
+		return ErrEmailNotVerified
+	}
+	return nil
+}
+
+func claimsOf(ctx echo.Context) *types.JwtClaims {
+	return ctx.Get("user").(*jwt.Token).Claims.(*types.JwtClaims)
+}
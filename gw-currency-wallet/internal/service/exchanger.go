@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"gw-wallet/internal/config"
+	"log/slog"
+	"os"
+
+	proto "github.com/lynxbites/proto-grpc/proto"
+	grpc "google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// tokenCredentials sends the service token with every call.
+type tokenCredentials struct {
+	token  string
+	secure bool
+}
+
+func (creds tokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + creds.token}, nil
+}
+
+func (creds tokenCredentials) RequireTransportSecurity() bool {
+	return creds.secure
+}
+
+func newExchangerClient(cfg *config.Config) (proto.ExchangeServiceClient, error) {
+	exchange := cfg.ExchangeConfig
+
+	transport := insecure.NewCredentials()
+	secure := exchange.TLSCA != ""
+	if secure {
+		tlsConfig, err := clientTLS(exchange.TLSCA, exchange.TLSCert, exchange.TLSKey, exchange.TLSServerName)
+		if err != nil {
+			return nil, err
+		}
+		transport = credentials.NewTLS(tlsConfig)
+	} else {
+		slog.Warn("exchanger: EXCHANGER_TLS_CA is empty, connecting without TLS")
+	}
+
+	options := []grpc.DialOption{grpc.WithTransportCredentials(transport)}
+	if exchange.Token != "" {
+		options = append(options, grpc.WithPerRPCCredentials(tokenCredentials{token: exchange.Token, secure: secure}))
+	}
+	conn, err := grpc.NewClient(exchange.Address, options...)
+	if err != nil {
+		return nil, err
+	}
+	return proto.NewExchangeServiceClient(conn), nil
+}
+
+func clientTLS(caFile string, certFile string, keyFile string, serverName string) (*tls.Config, error) {
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.New("no certificates found in " + caFile)
+	}
+	tlsConfig := &tls.Config{
+		RootCAs:    pool,
+		ServerName: serverName,
+		MinVersion: tls.VersionTLS12,
+	}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
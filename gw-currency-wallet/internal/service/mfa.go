@@ -0,0 +1,187 @@
+package service
+
+import (
+	"errors"
+	"gw-wallet/internal/auth"
+	"gw-wallet/internal/repository"
+	"log/slog"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	totpIssuer      = "gw-wallet"
+	mfaChallengeTTL = 5 * time.Minute
+)
+
+var (
+	ErrTOTPEnabled      = errors.New("totp is already enabled")
+	ErrTOTPNotEnrolled  = errors.New("totp is not enrolled")
+	ErrInvalidMFACode   = errors.New("invalid mfa code")
+	ErrInvalidChallenge = errors.New("invalid or expired mfa challenge")
+)
+
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+// EnrollTOTP makes a new secret for the logged in user. It takes effect
+// once ConfirmTOTP gets a code for it; enrolling again before that replaces
+// the secret. It needs an elevated token.
+func (service *Service) EnrollTOTP(ctx echo.Context) (*TOTPEnrollment, error) {
+	if err := service.requireElevated(ctx); err != nil {
+		return nil, err
+	}
+	user, err := service.repo.GetUser(ctx, claimsOf(ctx).Subject)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := auth.NewTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := auth.SealSecret(service.auth.signingKey, secret)
+	if err != nil {
+		return nil, err
+	}
+	err = service.repo.SetTOTPSecret(ctx, user.Id, sealed)
+	if errors.Is(err, repository.ErrTOTPEnabled) {
+		return nil, ErrTOTPEnabled
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &TOTPEnrollment{Secret: secret, URI: auth.TOTPURI(totpIssuer, user.Username, secret)}, nil
+}
+
+// ConfirmTOTP enables TOTP when the code matches the enrolled secret and
+// returns the recovery codes, which are shown only this once.
+func (service *Service) ConfirmTOTP(ctx echo.Context, code string) ([]string, error) {
+	user, err := service.repo.GetUser(ctx, claimsOf(ctx).Subject)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabled {
+		return nil, ErrTOTPEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, ErrTOTPNotEnrolled
+	}
+	secret, err := auth.OpenSecret(service.auth.signingKey, user.TOTPSecret)
+	if err != nil {
+		return nil, err
+	}
+	step, ok := auth.ValidateTOTP(secret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	codes, err := auth.NewRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = auth.HashOpaqueToken(code)
+	}
+	err = service.repo.EnableTOTP(ctx, user.Id, step, hashes)
+	if errors.Is(err, repository.ErrTOTPEnabled) {
+		return nil, ErrTOTPEnabled
+	}
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("totp enabled", "user", user.Id)
+	return codes, nil
+}
+
+// LoginMFA trades the challenge from LoginUser and a TOTP or recovery code
+// for the access token. Wrong codes count as failed logins. A challenge
+// logs in once, and not at all after the password changed.
+func (service *Service) LoginMFA(ctx echo.Context, request *repository.MFALoginRequest) (string, error) {
+	claims, err := auth.ParseActionToken(service.auth.signingKey, auth.PurposeMFAChallenge, request.MFAToken)
+	if err != nil || claims.ID == "" {
+		return "", ErrInvalidChallenge
+	}
+	user, err := service.repo.GetUser(ctx, claims.Subject)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return "", ErrInvalidChallenge
+	}
+	if err != nil {
+		return "", err
+	}
+	if claims.PasswordChangedAt != user.PasswordChangedAt.UnixMicro() {
+		return "", ErrInvalidChallenge
+	}
+	keys := service.loginKeys(ctx, user.Username)
+	reserved, err := service.reserveAttempt(ctx, keys)
+	if err != nil {
+		return "", err
+	}
+
+	err = service.checkSecondFactor(ctx, user, request.Code, request.RecoveryCode)
+	if errors.Is(err, ErrInvalidMFACode) {
+		service.loginFailed(ctx, keys, reserved)
+		slog.Info("unauthorized: invalid mfa code")
+		return "", err
+	}
+	if errors.Is(err, ErrTOTPNotEnrolled) {
+		// TOTP was turned off since the challenge was issued
+		service.releaseAttempt(ctx, reserved)
+		return "", ErrInvalidChallenge
+	}
+	if err != nil {
+		service.releaseAttempt(ctx, reserved)
+		return "", err
+	}
+	err = service.repo.UseMFAChallenge(ctx, claims.ID, claims.ExpiresAt.Time)
+	if errors.Is(err, repository.ErrTokenNotFound) {
+		service.releaseAttempt(ctx, reserved)
+		return "", ErrInvalidChallenge
+	}
+	if err != nil {
+		service.releaseAttempt(ctx, reserved)
+		return "", err
+	}
+	if err := service.loginSucceeded(ctx, keys, reserved); err != nil {
+		return "", err
+	}
+	return service.issueAccessToken(ctx, user)
+}
+
+// checkSecondFactor accepts a TOTP code or, failing that, a recovery code,
+// and uses it up.
+func (service *Service) checkSecondFactor(ctx echo.Context, user *repository.User, code string, recoveryCode string) error {
+	if !user.TOTPEnabled {
+		return ErrTOTPNotEnrolled
+	}
+	if code != "" {
+		secret, err := auth.OpenSecret(service.auth.signingKey, user.TOTPSecret)
+		if err != nil {
+			return err
+		}
+		step, ok := auth.ValidateTOTP(secret, code, time.Now())
+		if !ok {
+			return ErrInvalidMFACode
+		}
+		err = service.repo.UseTOTPStep(ctx, user.Id, step)
+		if errors.Is(err, repository.ErrTokenNotFound) {
+			slog.Info("unauthorized: totp code replayed", "user", user.Id)
+			return ErrInvalidMFACode
+		}
+		return err
+	}
+	if recoveryCode != "" {
+		err := service.repo.UseRecoveryCode(ctx, user.Id, auth.HashOpaqueToken(auth.NormalizeRecoveryCode(recoveryCode)))
+		if errors.Is(err, repository.ErrTokenNotFound) {
+			return ErrInvalidMFACode
+		}
+		if err == nil {
+			slog.Warn("recovery code used", "user", user.Id)
+		}
+		return err
+	}
+	return ErrInvalidMFACode
+}
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"errors"
+	"gw-wallet/internal/auth"
+	"gw-wallet/internal/mailer"
+	"gw-wallet/internal/repository"
+	"log/slog"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ForgotPassword mails a reset token to the account with the email. It
+// does not tell whether there is one, so nobody can probe for accounts.
+func (service *Service) ForgotPassword(ctx echo.Context, request *repository.ForgotPasswordRequest) error {
+	user, err := service.repo.GetUserByEmail(ctx, request.Email)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	token, hash, err := auth.NewOpaqueToken()
+	if err != nil {
+		return err
+	}
+	if err := service.repo.CreatePasswordReset(ctx, user.Id, hash, time.Now().Add(service.auth.resetTTL)); err != nil {
+		return err
+	}
+	err = service.mailer.Send(ctx.Request().Context(), &mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: "Hello, " + user.Username + "!\n\nSomeone asked to reset the password of your wallet. If it was you, send this token to POST " +
+			service.auth.publicURL + "/api/v1/password/reset along with your new password:\n\n" + token +
+			"\n\nThe token can be used once within " + service.auth.resetTTL.String() + ". If it wasn't you, ignore this email.\n",
+	})
+	if err != nil {
+		slog.Error("mailer: cannot send password reset email: " + err.Error())
+	}
+	return nil
+}
+
+func (service *Service) ResetPassword(ctx echo.Context, request *repository.ResetPasswordRequest) error {
+	if err := service.auth.policy.Check(request.NewPassword); err != nil {
+		return err
+	}
+	hash, err := service.auth.passwords.Hash(request.NewPassword)
+	if err != nil {
+		return err
+	}
+	userId, err := service.repo.ResetPassword(ctx, auth.HashOpaqueToken(request.Token), hash)
+	if errors.Is(err, repository.ErrTokenNotFound) {
+		return auth.ErrInvalidToken
+	}
+	if err != nil {
+		return err
+	}
+	user, err := service.repo.GetUser(ctx, userId)
+	if err != nil {
+		return err
+	}
+	slog.Info("password reset", "user", user.Id)
+	// whoever reset the password owns the email, let them log in at once
+	return service.repo.ClearLoginFailures(ctx, "user:"+user.Username)
+}
+
+// ChangePassword sets a new password for the logged in user and returns a
+// new access token, as the one used for the request is revoked with the
+// rest. It needs an elevated token.
+func (service *Service) ChangePassword(ctx echo.Context, request *repository.ChangePasswordRequest) (string, error) {
+	if err := service.requireElevated(ctx); err != nil {
+		return "", err
+	}
+	user, err := service.repo.GetUser(ctx, claimsOf(ctx).Subject)
+	if err != nil {
+		return "", err
+	}
+	ok, _, err := service.auth.passwords.Verify(user.PasswordHash, request.OldPassword)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", ErrInvalidPassword
+	}
+	if err := service.auth.policy.Check(request.NewPassword); err != nil {
+		return "", err
+	}
+	hash, err := service.auth.passwords.Hash(request.NewPassword)
+	if err != nil {
+		return "", err
+	}
+	if err := service.repo.UpdatePassword(ctx, user.Id, hash); err != nil {
+		return "", err
+	}
+	slog.Info("password changed", "user", user.Id)
+	// the new session has to start after the change it survives
+	if user, err = service.repo.GetUser(ctx, user.Id); err != nil {
+		return "", err
+	}
+	return service.issueAccessToken(ctx, user)
+}
+
+// rehashPassword replaces the hash of a password that was just checked. A
+// failure is only logged, the old hash keeps working.
+func (service *Service) rehashPassword(ctx echo.Context, user *repository.User, password string) {
+	hash, err := service.auth.passwords.Hash(password)
+	if err != nil {
+		slog.Error("internal error: cannot rehash password: " + err.Error())
+		return
+	}
+	if err := service.repo.RehashPassword(ctx, user.Id, user.PasswordHash, hash); err != nil {
+		return
+	}
+	slog.Info("password rehashed", "user", user.Id)
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"errors"
+	"gw-wallet/internal/mailer"
+	"gw-wallet/internal/repository"
+	"log/slog"
+
+	"github.com/labstack/echo/v4"
+)
+
+var ErrInvalidCurrency = errors.New("unknown currency")
+
+// isCurrency reports whether the wallet holds the currency.
+func isCurrency(currency string) bool {
+	switch currency {
+	case "USD", "RUB", "EUR":
+		return true
+	}
+	return false
+}
+
+// GetProfile returns the account of the logged in user.
+func (service *Service) GetProfile(ctx echo.Context) (*repository.Profile, error) {
+	user, err := service.repo.GetUser(ctx, claimsOf(ctx).Subject)
+	if err != nil {
+		return nil, err
+	}
+	return &repository.Profile{
+		Id:                user.Id,
+		Username:          user.Username,
+		Email:             user.Email,
+		EmailVerified:     user.EmailVerified,
+		CreatedAt:         user.CreatedAt,
+		PreferredCurrency: user.PreferredCurrency,
+	}, nil
+}
+
+// UpdateProfile changes the preferences and the email of the logged in
+// user. A new email needs an elevated token and has to be verified again,
+// so money cannot leave the wallet until it is; the old address is told of
+// the change.
+func (service *Service) UpdateProfile(ctx echo.Context, request *repository.UpdateProfileRequest) (*repository.Profile, error) {
+	user, err := service.repo.GetUser(ctx, claimsOf(ctx).Subject)
+	if err != nil {
+		return nil, err
+	}
+	newEmail := request.Email != nil && *request.Email != user.Email
+	if newEmail {
+		if err := service.requireElevated(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	if request.PreferredCurrency != nil && !isCurrency(*request.PreferredCurrency) {
+		return nil, ErrInvalidCurrency
+	}
+	email := request.Email
+	if !newEmail {
+		email = nil
+	}
+	if err := service.repo.UpdateProfile(ctx, user.Id, email, request.PreferredCurrency); err != nil {
+		return nil, err
+	}
+
+	if newEmail {
+		slog.Info("email changed", "user", user.Id)
+		if err := service.sendVerification(ctx, user.Id, user.Username, *request.Email); err != nil {
+			slog.Error("mailer: cannot send verification email: " + err.Error())
+		}
+		err = service.mailer.Send(ctx.Request().Context(), &mailer.Message{
+			To:      user.Email,
+			Subject: "Your email was changed",
+			Body:    "Hello, " + user.Username + "!\n\nThe email of your wallet was changed to " + *request.Email + ". If it wasn't you, contact support.\n",
+		})
+		if err != nil {
+			slog.Error("mailer: cannot send email change notice: " + err.Error())
+		}
+	}
+	return service.GetProfile(ctx)
+}
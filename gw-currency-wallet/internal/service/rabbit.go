@@ -2,76 +2,85 @@ package service
 
 import (
 	"context"
-	"encoding/json"
 	"gw-wallet/internal/config"
 	"log/slog"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
+	"github.com/lynxbites/wallet-services/gw-shared/events"
+	"github.com/lynxbites/wallet-services/gw-shared/rabbit"
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
-type InsertStruct struct {
-	Id            string  `bson:"_id"`
-	User          string  `bson:"user"`
-	OperationType string  `bson:"operation_type"`
-	Amount        float64 `bson:"amount"`
-	Timestamp     string  `bson:"timestamp"`
+type RabbitConn struct {
+	client   *rabbit.Client
+	exchange string
 }
 
-type RabbitConn struct {
-	conn *amqp.Connection
+// NewRabbitConn connects in the background and keeps reconnecting, declaring
+// the exchange on every new connection.
+func NewRabbitConn(cfg *config.Config) *RabbitConn {
+	exchange := cfg.RabbitConfig.RabbitExchange
+	client := rabbit.NewClient(cfg.RabbitConfig.Address, func(ch *amqp.Channel) error {
+		return ch.ExchangeDeclare(
+			exchange, // name
+			"topic",  // type
+			true,     // durable
+			false,    // auto-deleted
+			false,    // internal
+			false,    // no-wait
+			nil,      // arguments
+		)
+	}, slog.Default())
+	return &RabbitConn{client: client, exchange: exchange}
 }
 
-func (rabbit *RabbitConn) SendData(ctx echo.Context, userName string, operationType string, amount float64) error {
-	cfg, err := config.NewConfig()
-	if err != nil {
-		panic(err)
+// NewEvent builds a current version event for an operation that just
+// happened.
+func NewEvent(userId string, eventType events.Type, amount float64, currency string) *events.Event {
+	return &events.Event{
+		SchemaVersion: events.CurrentVersion,
+		Id:            uuid.New().String(),
+		Type:          eventType,
+		UserId:        userId,
+		Amount:        amount,
+		Currency:      currency,
+		OccurredAt:    time.Now().UTC(),
 	}
-	channel, err := rabbit.conn.Channel()
+}
+
+// SendData publishes the event. It fails at once, without waiting for a
+// reconnect, while RabbitMQ is unreachable.
+func (rabbit *RabbitConn) SendData(ctx echo.Context, event *events.Event) error {
+	jsonByte, err := events.Encode(event)
 	if err != nil {
-		slog.Error("rabbitmq send: failed to create channel")
 		return err
 	}
-	defer channel.Close()
+	return rabbit.publish(event.RoutingKey(), event.Id, jsonByte)
+}
 
-	err = channel.ExchangeDeclare(
-		cfg.RabbitConfig.RabbitExchange, // name
-		"topic",                         // type
-		true,                            // durable
-		false,                           // auto-deleted
-		false,                           // internal
-		false,                           // no-wait
-		nil,                             // arguments
-	)
+// SendSecurityEvent publishes a security event under security.<type>.
+func (rabbit *RabbitConn) SendSecurityEvent(event *events.SecurityEvent) error {
+	jsonByte, err := events.EncodeSecurity(event)
 	if err != nil {
-		slog.Error("rabbitmq send: failed to declare exchange")
 		return err
 	}
+	return rabbit.publish(event.RoutingKey(), event.Id, jsonByte)
+}
 
+func (rabbit *RabbitConn) publish(routingKey string, id string, jsonByte []byte) error {
 	rabbitctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	jsonByte, err := json.Marshal(InsertStruct{
-		Id:            uuid.New().String(),
-		User:          userName,
-		OperationType: operationType,
-		Amount:        amount,
-		Timestamp:     time.Now().UTC().String(),
-	})
-	if err != nil {
-		return err
-	}
-
-	err = channel.PublishWithContext(rabbitctx,
-		cfg.RabbitConfig.RabbitExchange, // exchange
-		"wallet.event."+operationType,   // routing key
-		false,                           // mandatory
-		false,                           // immediate
+	err := rabbit.client.Publish(rabbitctx,
+		rabbit.exchange, // exchange
+		routingKey,      // routing key
 		amqp.Publishing{
-			ContentType: "application/json",
-			Body:        jsonByte,
+			ContentType:  "application/json",
+			DeliveryMode: amqp.Persistent,
+			MessageId:    id,
+			Body:         jsonByte,
 		})
 	if err != nil {
 		slog.Error("rabbitmq send: failed to publish")
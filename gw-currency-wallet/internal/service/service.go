@@ -2,22 +2,45 @@ package service
 
 import (
 	"context"
+	"errors"
+	"gw-wallet/internal/auth"
 	"gw-wallet/internal/config"
+	"gw-wallet/internal/mailer"
 	"gw-wallet/internal/repository"
 	"gw-wallet/internal/types"
 	"log/slog"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/labstack/echo/v4"
 	proto "github.com/lynxbites/proto-grpc/proto"
-	amqp "github.com/rabbitmq/amqp091-go"
-	grpc "google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
+	"github.com/lynxbites/wallet-services/gw-shared/events"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
+var (
+	ErrExchangerUnavailable = errors.New("exchanger client is not configured")
+	ErrTradingHalted        = errors.New("trading is halted for this currency pair")
+	ErrStaleRate            = errors.New("exchange rate is stale")
+	ErrEmailNotVerified     = errors.New("email is not verified")
+	ErrEmailAlreadyVerified = errors.New("email is already verified")
+	ErrSessionRevoked       = errors.New("session is revoked")
+	ErrInvalidPassword      = errors.New("invalid password")
+)
+
+// largeOperation is the amount from which operations are reported to the
+// broker.
+const largeOperation = 30000
+
 type Service struct {
-	repo   repository.WalletRepo
-	rabbit *RabbitConn
+	repo       repository.WalletRepo
+	rabbit     *RabbitConn
+	exchanger  proto.ExchangeServiceClient
+	rateMaxAge time.Duration
+	mailer     mailer.Mailer
+	auth       authSettings
 }
 
 type GetRatesResponse struct {
@@ -40,19 +63,59 @@ type GetExchangeRateResponse struct {
 }
 
 func NewService(repo repository.WalletRepo, cfg *config.Config) *Service {
-	conn, err := amqp.Dial(cfg.RabbitConfig.Address)
+	exchanger, err := newExchangerClient(cfg)
 	if err != nil {
-		slog.Error("rabbitmq connection: could not connect to rabbitmq")
+		slog.Error("exchanger connection: could not set up grpc client: " + err.Error())
+	}
+	return &Service{
+		repo:       repo,
+		rabbit:     NewRabbitConn(cfg),
+		exchanger:  exchanger,
+		rateMaxAge: cfg.ExchangeConfig.RateMaxAge,
+		mailer:     mailer.New(cfg),
+		auth: authSettings{
+			signingKey: cfg.AuthConfig.SigningKey,
+			verifyTTL:  cfg.AuthConfig.VerifyTTL,
+			resetTTL:   cfg.AuthConfig.ResetTTL,
+			publicURL:  cfg.AuthConfig.PublicURL,
+			userThrottle: auth.ThrottlePolicy{
+				FreeAttempts: cfg.LoginConfig.FreeAttempts,
+				Delay:        cfg.LoginConfig.Delay,
+				MaxDelay:     cfg.LoginConfig.MaxDelay,
+				LockoutAfter: cfg.LoginConfig.LockoutAfter,
+				Lockout:      cfg.LoginConfig.Lockout,
+				Window:       cfg.LoginConfig.Window,
+			},
+			ipThrottle: auth.ThrottlePolicy{
+				FreeAttempts: cfg.LoginConfig.IPFreeAttempts,
+				Delay:        cfg.LoginConfig.Delay,
+				MaxDelay:     cfg.LoginConfig.MaxDelay,
+				LockoutAfter: cfg.LoginConfig.IPLockoutAfter,
+				Lockout:      cfg.LoginConfig.Lockout,
+				Window:       cfg.LoginConfig.Window,
+			},
+			stepUpTTL:                cfg.AuthConfig.StepUpTTL,
+			stepUpWithdrawThresholds: cfg.AuthConfig.StepUpWithdrawThresholds,
+			// hashes from before Argon2id are bcrypt with cost 12
+			passwords: auth.NewPasswordHasher(&auth.Argon2id{
+				Memory:     uint32(cfg.PasswordConfig.Argon2Memory),
+				Time:       uint32(cfg.PasswordConfig.Argon2Time),
+				Threads:    uint8(cfg.PasswordConfig.Argon2Threads),
+				SaltLength: 16,
+				KeyLength:  32,
+			}, &auth.Bcrypt{Cost: 12}).Limit(cfg.PasswordConfig.ConcurrentHashes()),
+			policy: &auth.PasswordPolicy{MinLength: cfg.PasswordConfig.MinLength},
+		},
 	}
-	return &Service{repo: repo, rabbit: &RabbitConn{conn: conn}}
-}
-
-func (service *Service) RegisterUser(ctx echo.Context, request *repository.RegisterRequest) error {
-	return service.repo.RegisterUser(ctx, request)
 }
 
-func (service *Service) LoginUser(ctx echo.Context, request *repository.LoginRequest) (string, error) {
-	return service.repo.LoginUser(ctx, request)
+// LoadBreachedPasswords makes the password policy refuse the passwords in
+// the file, or in the built-in list of common passwords if path is empty.
+func (service *Service) LoadBreachedPasswords(path string) error {
+	if path == "" {
+		return service.auth.policy.LoadDefaultBreached()
+	}
+	return service.auth.policy.LoadBreached(path)
 }
 
 func (service *Service) GetBalance(ctx echo.Context) (*repository.BalanceResponse, error) {
@@ -65,14 +128,14 @@ func (service *Service) Deposit(ctx echo.Context, request *repository.DepositReq
 		slog.Info("rabbitmq send: transaction failed, skipping")
 		return response, err
 	}
-	if request.Amount < 30000 {
+	if request.Amount < largeOperation {
 		return response, err
 	}
 
 	user := ctx.Get("user").(*jwt.Token)
 	claims := user.Claims.(*types.JwtClaims)
 
-	rabbitErr := service.rabbit.SendData(ctx, claims.Username, "deposit", request.Amount)
+	rabbitErr := service.rabbit.SendData(ctx, NewEvent(claims.Subject, events.TypeDeposit, request.Amount, request.Currency))
 	if rabbitErr != nil {
 		slog.Error("send data to rabbit: error: " + rabbitErr.Error())
 
@@ -81,19 +144,32 @@ func (service *Service) Deposit(ctx echo.Context, request *repository.DepositReq
 }
 
 func (service *Service) Withdraw(ctx echo.Context, request *repository.WithdrawRequest) (*repository.WithdrawResponse, error) {
+	if err := service.requireVerified(ctx); err != nil {
+		return nil, err
+	}
+	// an unknown currency is refused before it could ask for step-up
+	if !isCurrency(request.Currency) {
+		return nil, ErrInvalidCurrency
+	}
+	// a currency without a threshold always needs step-up
+	if threshold, ok := service.auth.stepUpWithdrawThresholds[request.Currency]; !ok || request.Amount >= threshold {
+		if err := service.requireElevated(ctx); err != nil {
+			return nil, err
+		}
+	}
 	response, err := service.repo.Withdraw(ctx, request)
 	if err != nil {
 		slog.Info("rabbitmq send: transaction failed, skipping")
 		return response, err
 	}
-	if request.Amount < 30000 {
+	if request.Amount < largeOperation {
 		return response, err
 	}
 
 	user := ctx.Get("user").(*jwt.Token)
 	claims := user.Claims.(*types.JwtClaims)
 
-	rabbitErr := service.rabbit.SendData(ctx, claims.Username, "withdraw", request.Amount)
+	rabbitErr := service.rabbit.SendData(ctx, NewEvent(claims.Subject, events.TypeWithdraw, request.Amount, request.Currency))
 	if rabbitErr != nil {
 		slog.Error("send data to rabbit: error: " + rabbitErr.Error())
 
@@ -102,13 +178,10 @@ func (service *Service) Withdraw(ctx echo.Context, request *repository.WithdrawR
 }
 
 func (service *Service) GetExchangeRates(ctx echo.Context) (*proto.ExchangeRatesResponse, error) {
-	conn, err := grpc.NewClient("localhost:8020", grpc.WithTransportCredentials(insecure.NewCredentials()))
-	if err != nil {
-		slog.Error("Could not establish gRPC connection.")
-		return nil, err
+	if service.exchanger == nil {
+		return nil, ErrExchangerUnavailable
 	}
-	client := proto.NewExchangeServiceClient(conn)
-	response, err := client.GetExchangeRates(context.Background(), &proto.Empty{})
+	response, err := service.exchanger.GetExchangeRates(context.Background(), &proto.Empty{})
 	if err != nil {
 		return nil, err
 	}
@@ -124,15 +197,28 @@ func (service *Service) Exchange(ctx echo.Context, request *repository.ExchangeR
 		return nil, echo.ErrBadRequest
 	}
 
-	conn, err := grpc.NewClient("localhost:8020", grpc.WithTransportCredentials(insecure.NewCredentials()))
-	if err != nil {
+	if err := service.requireVerified(ctx); err != nil {
 		return nil, err
 	}
-	client := proto.NewExchangeServiceClient(conn)
-	grpcResponse, err := client.GetExchangeRateForCurrency(context.Background(), &proto.CurrencyRequest{FromCurrency: request.FromCurrency, ToCurrency: request.ToCurrency})
+	if service.exchanger == nil {
+		return nil, ErrExchangerUnavailable
+	}
+	grpcResponse, err := service.exchanger.GetExchangeRateForCurrency(context.Background(), &proto.CurrencyRequest{FromCurrency: request.FromCurrency, ToCurrency: request.ToCurrency})
+	if status.Code(err) == codes.FailedPrecondition {
+		slog.Info("exchange rejected: " + err.Error())
+		return nil, ErrTradingHalted
+	}
+	if isStaleRateError(err) {
+		slog.Warn("exchange rejected: " + err.Error())
+		return nil, ErrStaleRate
+	}
 	if err != nil {
 		return nil, err
 	}
+	if service.rateMaxAge > 0 && time.Since(time.Unix(grpcResponse.AsOf, 0)) > service.rateMaxAge {
+		slog.Warn("exchange rejected: rate is stale", "as_of", grpcResponse.AsOf)
+		return nil, ErrStaleRate
+	}
 
 	repoRequest := &repository.ExchangeRequest{
 		FromCurrency: request.FromCurrency,
@@ -141,5 +227,33 @@ func (service *Service) Exchange(ctx echo.Context, request *repository.ExchangeR
 		Rate:         grpcResponse.Rate,
 	}
 
-	return service.repo.Exchange(ctx, repoRequest)
+	response, err := service.repo.Exchange(ctx, repoRequest)
+	if err != nil {
+		slog.Info("rabbitmq send: transaction failed, skipping")
+		return response, err
+	}
+	if request.Amount < largeOperation {
+		return response, err
+	}
+
+	user := ctx.Get("user").(*jwt.Token)
+	claims := user.Claims.(*types.JwtClaims)
+
+	event := NewEvent(claims.Subject, events.TypeExchange, request.Amount, request.FromCurrency)
+	event.TargetCurrency = request.ToCurrency
+	rabbitErr := service.rabbit.SendData(ctx, event)
+	if rabbitErr != nil {
+		slog.Error("send data to rabbit: error: " + rabbitErr.Error())
+
+	}
+	return response, err
+}
+
+func isStaleRateError(err error) bool {
+	for _, detail := range status.Convert(err).Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok && info.Domain == proto.ErrorDomain && info.Reason == proto.ReasonRateStale {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,378 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"gw-wallet/internal/auth"
+	"gw-wallet/internal/repository"
+	"gw-wallet/internal/types"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+)
+
+// fakeRepo keeps one user and their login failures in memory. Methods the
+// tests do not expect panic through the nil WalletRepo.
+type fakeRepo struct {
+	repository.WalletRepo
+	user      *repository.User
+	failures  map[string]*repository.LoginFailures
+	withdrawn []*repository.WithdrawRequest
+	sessions  map[string]*repository.Session
+}
+
+func newFakeRepo(user *repository.User) *fakeRepo {
+	return &fakeRepo{user: user, failures: map[string]*repository.LoginFailures{}, sessions: map[string]*repository.Session{}}
+}
+
+func (repo *fakeRepo) GetUser(ctx echo.Context, userId string) (*repository.User, error) {
+	if repo.user == nil || repo.user.Id != userId {
+		return nil, repository.ErrUserNotFound
+	}
+	copied := *repo.user
+	return &copied, nil
+}
+
+func (repo *fakeRepo) GetUserByName(ctx echo.Context, username string) (*repository.User, error) {
+	if repo.user == nil || repo.user.Username != username {
+		return nil, repository.ErrUserNotFound
+	}
+	copied := *repo.user
+	return &copied, nil
+}
+
+func (repo *fakeRepo) ReserveLoginAttempt(ctx echo.Context, attempts []repository.LoginAttempt, now time.Time, allow func([]repository.LoginFailures) error) ([]repository.LoginFailures, error) {
+	var stored []repository.LoginFailures
+	for _, attempt := range attempts {
+		if failures, ok := repo.failures[attempt.Key]; ok {
+			stored = append(stored, *failures)
+		}
+	}
+	if err := allow(stored); err != nil {
+		return nil, err
+	}
+	var reserved []repository.LoginFailures
+	for _, attempt := range attempts {
+		failures, ok := repo.failures[attempt.Key]
+		if !ok {
+			failures = &repository.LoginFailures{Key: attempt.Key}
+			repo.failures[attempt.Key] = failures
+		}
+		previous := failures.LastFailureAt
+		failures.Failures++
+		failures.LastFailureAt = now
+		reserved = append(reserved, *failures)
+		reserved[len(reserved)-1].PreviousFailureAt = previous
+	}
+	return reserved, nil
+}
+
+func (repo *fakeRepo) ReleaseLoginAttempt(ctx echo.Context, reserved repository.LoginFailures) error {
+	failures, ok := repo.failures[reserved.Key]
+	if !ok {
+		return nil
+	}
+	if failures.Failures > 0 {
+		failures.Failures--
+	}
+	if failures.LastFailureAt.Equal(reserved.LastFailureAt) {
+		failures.LastFailureAt = reserved.PreviousFailureAt
+	}
+	return nil
+}
+
+func (repo *fakeRepo) LockLogin(ctx echo.Context, key string, until time.Time) error {
+	repo.failures[key].LockedUntil = until
+	return nil
+}
+
+func (repo *fakeRepo) ClearLoginFailures(ctx echo.Context, key string) error {
+	delete(repo.failures, key)
+	return nil
+}
+
+func (repo *fakeRepo) UpdatePassword(ctx echo.Context, userId string, passwordHash string) error {
+	now := time.Now()
+	repo.user.PasswordHash = passwordHash
+	repo.user.PasswordChangedAt = now
+	for _, session := range repo.sessions {
+		if session.UserId == userId && session.RevokedAt == nil {
+			session.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+func (repo *fakeRepo) GetPermissions(ctx echo.Context, userId string) ([]string, []string, error) {
+	return []string{"user"}, nil, nil
+}
+
+// CreateSession never reports a new device, which would need rabbit.
+func (repo *fakeRepo) CreateSession(ctx echo.Context, session *repository.Session) (bool, error) {
+	session.Id = fmt.Sprintf("session-%d", len(repo.sessions)+1)
+	session.CreatedAt = time.Now()
+	session.LastSeenAt = session.CreatedAt
+	stored := *session
+	repo.sessions[session.Id] = &stored
+	return false, nil
+}
+
+func (repo *fakeRepo) GetSession(ctx echo.Context, sessionId string) (*repository.Session, error) {
+	session, ok := repo.sessions[sessionId]
+	if !ok {
+		return nil, repository.ErrNoSession
+	}
+	copied := *session
+	return &copied, nil
+}
+
+func (repo *fakeRepo) Withdraw(ctx echo.Context, request *repository.WithdrawRequest) (*repository.WithdrawResponse, error) {
+	repo.withdrawn = append(repo.withdrawn, request)
+	return &repository.WithdrawResponse{}, nil
+}
+
+// testPasswords hashes with small Argon2id parameters to keep tests fast.
+var testPasswords = auth.NewPasswordHasher(&auth.Argon2id{Memory: 1024, Time: 1, Threads: 1, SaltLength: 16, KeyLength: 32})
+
+func newTestService(t *testing.T, password string) (*Service, *fakeRepo) {
+	hash, err := testPasswords.Hash(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := newFakeRepo(&repository.User{Id: "0b7c6e0e-0000-4000-8000-000000000001", Username: "user", PasswordHash: hash, EmailVerified: true})
+	return &Service{
+		repo: repo,
+		auth: authSettings{
+			signingKey:               "key",
+			userThrottle:             auth.ThrottlePolicy{FreeAttempts: 3, Delay: time.Second, MaxDelay: time.Second, Window: time.Hour},
+			ipThrottle:               auth.ThrottlePolicy{FreeAttempts: 20, Delay: time.Second, MaxDelay: time.Second, Window: time.Hour},
+			stepUpTTL:                5 * time.Minute,
+			stepUpWithdrawThresholds: map[string]float64{"USD": 1000, "RUB": 100000},
+			passwords:                testPasswords,
+			policy:                   &auth.PasswordPolicy{MinLength: 8},
+		},
+	}, repo
+}
+
+// newTestContext carries the claims the way echojwt leaves them.
+func newTestContext(claims *types.JwtClaims) echo.Context {
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	ctx := echo.New().NewContext(req, httptest.NewRecorder())
+	ctx.Set("user", &jwt.Token{Claims: claims})
+	return ctx
+}
+
+func userClaims(user *repository.User, elevatedUntil time.Time) *types.JwtClaims {
+	claims := &types.JwtClaims{
+		Username: user.Username,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        "session",
+			Subject:   user.Id,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	}
+	if !elevatedUntil.IsZero() {
+		claims.ElevatedUntil = jwt.NewNumericDate(elevatedUntil)
+	}
+	return claims
+}
+
+func TestStepUp(t *testing.T) {
+	service, repo := newTestService(t, "correct horse")
+
+	ctx := newTestContext(userClaims(repo.user, time.Time{}))
+	if _, err := service.StepUp(ctx, &repository.StepUpRequest{Password: "wrong horse"}); !errors.Is(err, ErrInvalidMFACode) {
+		t.Fatalf("expected %v, got %v\n", ErrInvalidMFACode, err)
+	}
+	if failures := repo.failures["user:user"].Failures; failures != 1 {
+		t.Fatalf("expected %v, got %v\n", 1, failures)
+	}
+	failedAt := repo.failures["user:user"].LastFailureAt
+
+	token, err := service.StepUp(ctx, &repository.StepUpRequest{Password: "correct horse"})
+	if err != nil {
+		t.Fatalf("expected %v, got %v\n", nil, err)
+	}
+	// the earlier failure stays, the step-up's own attempt is taken back
+	// and does not count as the latest failure
+	if failures := repo.failures["user:user"]; failures.Failures != 1 || !failures.LastFailureAt.Equal(failedAt) {
+		t.Fatalf("expected %v failure at %v, got %+v\n", 1, failedAt, failures)
+	}
+
+	claims := new(types.JwtClaims)
+	if _, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (any, error) { return []byte("key"), nil }); err != nil {
+		t.Fatal(err)
+	}
+	if claims.ID != "session" || claims.ElevatedUntil == nil || time.Until(claims.ElevatedUntil.Time) <= 0 {
+		t.Fatalf("expected an elevated token of the same session, got %+v\n", claims)
+	}
+	// elevation never outlives the token
+	if claims.ElevatedUntil.After(claims.ExpiresAt.Time) {
+		t.Fatalf("expected elevation to end by %v, got %v\n", claims.ExpiresAt.Time, claims.ElevatedUntil.Time)
+	}
+}
+
+func TestStepUpThrottled(t *testing.T) {
+	service, repo := newTestService(t, "correct horse")
+	repo.failures["user:user"] = &repository.LoginFailures{Key: "user:user", Failures: 5, LastFailureAt: time.Now()}
+
+	ctx := newTestContext(userClaims(repo.user, time.Time{}))
+	_, err := service.StepUp(ctx, &repository.StepUpRequest{Password: "correct horse"})
+	var throttled *ThrottledError
+	if !errors.As(err, &throttled) {
+		t.Fatalf("expected a throttled step-up, got %v\n", err)
+	}
+}
+
+func TestRequireElevated(t *testing.T) {
+	service, repo := newTestService(t, "correct horse")
+
+	tests := []struct {
+		name          string
+		elevatedUntil time.Time
+		err           error
+	}{
+		{"not elevated", time.Time{}, ErrStepUpRequired},
+		{"elevation over", time.Now().Add(-time.Second), ErrStepUpRequired},
+		{"elevated", time.Now().Add(time.Minute), nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := newTestContext(userClaims(repo.user, test.elevatedUntil))
+			if err := service.requireElevated(ctx); !errors.Is(err, test.err) {
+				t.Fatalf("expected %v, got %v\n", test.err, err)
+			}
+		})
+	}
+}
+
+func TestWithdrawStepUpThreshold(t *testing.T) {
+	service, repo := newTestService(t, "correct horse")
+
+	tests := []struct {
+		name     string
+		amount   float64
+		currency string
+		elevated bool
+		err      error
+	}{
+		{"below threshold", 999, "USD", false, nil},
+		{"at threshold", 1000, "USD", false, ErrStepUpRequired},
+		{"at threshold elevated", 1000, "USD", true, nil},
+		// the same number in rubles is a small amount
+		{"below ruble threshold", 5000, "RUB", false, nil},
+		{"above ruble threshold", 100000, "RUB", false, ErrStepUpRequired},
+		{"currency without threshold", 1, "EUR", false, ErrStepUpRequired},
+		// an unknown currency is a bad request, not a reason for step-up
+		{"unknown currency", 1, "XYZ", false, ErrInvalidCurrency},
+		{"unknown currency elevated", 1, "XYZ", true, ErrInvalidCurrency},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var elevatedUntil time.Time
+			if test.elevated {
+				elevatedUntil = time.Now().Add(time.Minute)
+			}
+			ctx := newTestContext(userClaims(repo.user, elevatedUntil))
+			withdrawn := len(repo.withdrawn)
+			_, err := service.Withdraw(ctx, &repository.WithdrawRequest{Amount: test.amount, Currency: test.currency})
+			if !errors.Is(err, test.err) {
+				t.Fatalf("expected %v, got %v\n", test.err, err)
+			}
+			if done := len(repo.withdrawn) > withdrawn; done != (test.err == nil) {
+				t.Fatalf("expected withdrawn %v, got %v\n", test.err == nil, done)
+			}
+		})
+	}
+}
+
+func TestLoginTooLongPassword(t *testing.T) {
+	service, repo := newTestService(t, "correct horse")
+
+	ctx := newTestContext(userClaims(repo.user, time.Time{}))
+	long := &repository.LoginRequest{Username: "user", Password: strings.Repeat("a", 257)}
+	if _, err := service.LoginUser(ctx, long); !errors.Is(err, echo.ErrUnauthorized) {
+		t.Fatalf("expected %v, got %v\n", echo.ErrUnauthorized, err)
+	}
+	if failures := repo.failures["user:user"].Failures; failures != 1 {
+		t.Fatalf("expected %v, got %v\n", 1, failures)
+	}
+}
+
+func TestLoginHasherBusy(t *testing.T) {
+	service, repo := newTestService(t, "correct horse")
+	scheme := &blockingScheme{Argon2id: &auth.Argon2id{Memory: 1024, Time: 1, Threads: 1, SaltLength: 16, KeyLength: 32}, started: make(chan struct{}), done: make(chan struct{})}
+	service.auth.passwords = auth.NewPasswordHasher(scheme).Limit(1)
+
+	// a step-up in progress keeps the only slot
+	ctx := newTestContext(userClaims(repo.user, time.Time{}))
+	finished := make(chan struct{})
+	go func() {
+		service.StepUp(ctx, &repository.StepUpRequest{Password: "wrong horse"})
+		close(finished)
+	}()
+	<-scheme.started
+
+	tests := []struct {
+		name    string
+		request *repository.LoginRequest
+	}{
+		{"known user", &repository.LoginRequest{Username: "user", Password: "correct horse"}},
+		{"unknown user", &repository.LoginRequest{Username: "nobody", Password: "correct horse"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := service.LoginUser(ctx, test.request); !errors.Is(err, auth.ErrHasherBusy) {
+				t.Fatalf("expected %v, got %v\n", auth.ErrHasherBusy, err)
+			}
+		})
+	}
+	// only the step-up's attempt is counted
+	if failures := repo.failures["user:user"].Failures; failures != 1 {
+		t.Fatalf("expected %v, got %v\n", 1, failures)
+	}
+	if failures := repo.failures["user:nobody"]; failures != nil && failures.Failures != 0 {
+		t.Fatalf("expected %v, got %v\n", 0, failures.Failures)
+	}
+	close(scheme.done)
+	<-finished
+}
+
+// blockingScheme holds its first check until done is closed.
+type blockingScheme struct {
+	*auth.Argon2id
+	started chan struct{}
+	done    chan struct{}
+}
+
+func (scheme *blockingScheme) Verify(encoded string, password string) bool {
+	close(scheme.started)
+	<-scheme.done
+	return scheme.Argon2id.Verify(encoded, password)
+}
+
+func TestChangePasswordToken(t *testing.T) {
+	service, repo := newTestService(t, "correct horse")
+	repo.user.PasswordChangedAt = time.Now().Add(-time.Hour)
+
+	ctx := newTestContext(userClaims(repo.user, time.Now().Add(time.Minute)))
+	token, err := service.ChangePassword(ctx, &repository.ChangePasswordRequest{OldPassword: "correct horse", NewPassword: "battery staple"})
+	if err != nil {
+		t.Fatalf("expected %v, got %v\n", nil, err)
+	}
+
+	// the returned token keeps working after the change it was issued for
+	claims := new(types.JwtClaims)
+	if _, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (any, error) { return []byte("key"), nil }); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.CheckSession(newTestContext(claims)); err != nil {
+		t.Fatalf("expected %v, got %v\n", nil, err)
+	}
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"errors"
+	"gw-wallet/internal/repository"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/lynxbites/wallet-services/gw-shared/events"
+)
+
+// sessionTouchInterval keeps last_seen_at from being written on every
+// request.
+const sessionTouchInterval = time.Minute
+
+var ErrNoSession = errors.New("session not found")
+
+// startSession records the login and reports a new device to the user's
+// security events. user is the one the login was checked against, so a
+// password or role change that lands while the login is under way still
+// ends the session.
+func (service *Service) startSession(ctx echo.Context, user *repository.User, expiresAt time.Time) (*repository.Session, error) {
+	session := &repository.Session{
+		UserId:     user.Id,
+		UserAgent:  ctx.Request().UserAgent(),
+		IP:         ctx.RealIP(),
+		ExpiresAt:  expiresAt,
+		ValidAfter: credentialsChangedAt(user),
+	}
+	newDevice, err := service.repo.CreateSession(ctx, session)
+	if err != nil {
+		return nil, err
+	}
+	if newDevice {
+		service.newDevice(session)
+	}
+	return session, nil
+}
+
+func (service *Service) checkSession(ctx echo.Context, user *repository.User, sessionId string) error {
+	session, err := service.repo.GetSession(ctx, sessionId)
+	if errors.Is(err, repository.ErrNoSession) {
+		return ErrSessionRevoked
+	}
+	if err != nil {
+		return err
+	}
+	if session.UserId != user.Id || session.RevokedAt != nil || session.ValidAfter.Before(credentialsChangedAt(user)) {
+		return ErrSessionRevoked
+	}
+	if time.Since(session.LastSeenAt) > sessionTouchInterval {
+		// a missed update only makes last_seen_at older
+		service.repo.TouchSession(ctx, session.Id)
+	}
+	return nil
+}
+
+// credentialsChangedAt is the later of the user's password and role changes.
+func credentialsChangedAt(user *repository.User) time.Time {
+	if user.RolesChangedAt.After(user.PasswordChangedAt) {
+		return user.RolesChangedAt
+	}
+	return user.PasswordChangedAt
+}
+
+// ListSessions returns the active sessions of the logged in user.
+func (service *Service) ListSessions(ctx echo.Context) ([]repository.Session, error) {
+	claims := claimsOf(ctx)
+	sessions, err := service.repo.ListSessions(ctx, claims.Subject)
+	if err != nil {
+		return nil, err
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].Id == claims.ID
+	}
+	return sessions, nil
+}
+
+// RevokeSession logs the user out of one of their sessions, which may be
+// the current one.
+func (service *Service) RevokeSession(ctx echo.Context, sessionId string) error {
+	claims := claimsOf(ctx)
+	err := service.repo.RevokeSession(ctx, claims.Subject, sessionId)
+	if errors.Is(err, repository.ErrNoSession) {
+		return ErrNoSession
+	}
+	if err != nil {
+		return err
+	}
+	slog.Info("session revoked", "user", claims.Subject, "session", sessionId)
+	return nil
+}
+
+func (service *Service) newDevice(session *repository.Session) {
+	event := &events.SecurityEvent{
+		SchemaVersion: events.CurrentVersion,
+		Id:            uuid.New().String(),
+		Type:          events.SecurityNewDevice,
+		UserId:        session.UserId,
+		IP:            session.IP,
+		Details: map[string]string{
+			"session_id": session.Id,
+			"user_agent": session.UserAgent,
+		},
+		OccurredAt: session.CreatedAt.UTC(),
+	}
+	slog.Warn("security: login from a new device", "user", session.UserId, "ip", session.IP, "user_agent", session.UserAgent)
+	if err := service.rabbit.SendSecurityEvent(event); err != nil {
+		slog.Error("send security event to rabbit: error: " + err.Error())
+	}
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"errors"
+	"gw-wallet/internal/repository"
+	"log/slog"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+)
+
+var ErrStepUpRequired = errors.New("step-up authentication required")
+
+// StepUp checks fresh proof of identity and returns the same session with
+// an elevated claim for STEP_UP_TTL. Users with TOTP have to give a TOTP or
+// recovery code, others their password. Failures count as failed logins.
+func (service *Service) StepUp(ctx echo.Context, request *repository.StepUpRequest) (string, error) {
+	claims := claimsOf(ctx)
+	user, err := service.repo.GetUser(ctx, claims.Subject)
+	if err != nil {
+		return "", err
+	}
+	keys := service.loginKeys(ctx, user.Username)
+	reserved, err := service.reserveAttempt(ctx, keys)
+	if err != nil {
+		return "", err
+	}
+
+	if user.TOTPEnabled {
+		err = service.checkSecondFactor(ctx, user, request.Code, request.RecoveryCode)
+	} else {
+		var ok bool
+		if ok, _, err = service.auth.passwords.Verify(user.PasswordHash, request.Password); err == nil && !ok {
+			err = ErrInvalidMFACode
+		}
+	}
+	if errors.Is(err, ErrInvalidMFACode) {
+		service.loginFailed(ctx, keys, reserved)
+		slog.Info("unauthorized: step-up failed", "user", user.Id)
+		return "", err
+	}
+	// a step-up leaves earlier failures alone, only its own attempt is taken
+	// back
+	service.releaseAttempt(ctx, reserved)
+	if err != nil {
+		return "", err
+	}
+
+	// the session keeps its expiry, only the elevation is new
+	now := time.Now()
+	elevated := *claims
+	elevated.IssuedAt = jwt.NewNumericDate(now)
+	elevated.ElevatedUntil = jwt.NewNumericDate(now.Add(service.auth.stepUpTTL))
+	if elevated.ExpiresAt != nil && elevated.ExpiresAt.Before(elevated.ElevatedUntil.Time) {
+		elevated.ElevatedUntil = elevated.ExpiresAt
+	}
+	slog.Info("step-up: token elevated", "user", user.Id, "until", elevated.ElevatedUntil.Time)
+	return service.signAccessToken(&elevated)
+}
+
+// requireElevated refuses the request unless the token went through step-up
+// within STEP_UP_TTL.
+func (service *Service) requireElevated(ctx echo.Context) error {
+	claims := claimsOf(ctx)
+	if claims.ElevatedUntil == nil || time.Now().After(claims.ElevatedUntil.Time) {
+		return ErrStepUpRequired
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"fmt"
+	"gw-wallet/internal/auth"
+	"gw-wallet/internal/repository"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/lynxbites/wallet-services/gw-shared/events"
+)
+
+// ThrottledError refuses a login attempt that came too soon after failed
+// ones, or while the username or the address is locked.
+type ThrottledError struct {
+	RetryAfter time.Duration
+	Locked     bool
+}
+
+func (err *ThrottledError) Error() string {
+	if err.Locked {
+		return fmt.Sprintf("login is locked, retry in %v", err.RetryAfter)
+	}
+	return fmt.Sprintf("too many failed logins, retry in %v", err.RetryAfter)
+}
+
+type loginKey struct {
+	key    string
+	policy *auth.ThrottlePolicy
+}
+
+func (service *Service) loginKeys(ctx echo.Context, username string) []loginKey {
+	return []loginKey{
+		{"user:" + username, &service.auth.userThrottle},
+		{"ip:" + ctx.RealIP(), &service.auth.ipThrottle},
+	}
+}
+
+// reserveAttempt is done before the password is looked at, so a locked
+// account tells nothing about the password. Unless a key is held up, the
+// attempt is counted as failed right away, under a lock, and the outcome is
+// settled with loginFailed, loginSucceeded or releaseAttempt.
+func (service *Service) reserveAttempt(ctx echo.Context, keys []loginKey) ([]repository.LoginFailures, error) {
+	attempts := make([]repository.LoginAttempt, len(keys))
+	for i, key := range keys {
+		attempts[i] = repository.LoginAttempt{Key: key.key, Window: key.policy.Window}
+	}
+
+	now := time.Now()
+	return service.repo.ReserveLoginAttempt(ctx, attempts, now, func(stored []repository.LoginFailures) error {
+		var throttled *ThrottledError
+		for _, failures := range stored {
+			for _, key := range keys {
+				if key.key != failures.Key {
+					continue
+				}
+				wait := key.policy.Wait(failures.Failures, failures.LastFailureAt, failures.LockedUntil, now)
+				if wait > 0 && (throttled == nil || wait > throttled.RetryAfter) {
+					throttled = &ThrottledError{RetryAfter: wait, Locked: now.Before(failures.LockedUntil)}
+				}
+			}
+		}
+		if throttled != nil {
+			return throttled
+		}
+		return nil
+	})
+}
+
+// loginFailed locks the keys whose reserved attempt ran out of attempts.
+// Errors are logged, the login fails either way.
+func (service *Service) loginFailed(ctx echo.Context, keys []loginKey, reserved []repository.LoginFailures) {
+	now := time.Now()
+	for _, failures := range reserved {
+		for _, key := range keys {
+			if key.key != failures.Key || !key.policy.Locks(failures.Failures) {
+				continue
+			}
+			until := now.Add(key.policy.Lockout)
+			if err := service.repo.LockLogin(ctx, key.key, until); err != nil {
+				slog.Error("internal error: cannot lock login: "+err.Error(), "key", key.key)
+				continue
+			}
+			service.lockedOut(ctx, key.key, failures.Failures, until)
+		}
+	}
+}
+
+// loginSucceeded forgets the user's failures and takes back the attempt
+// reserved for the address, which other users may share.
+func (service *Service) loginSucceeded(ctx echo.Context, keys []loginKey, reserved []repository.LoginFailures) error {
+	if err := service.repo.ClearLoginFailures(ctx, keys[0].key); err != nil {
+		return err
+	}
+	var others []repository.LoginFailures
+	for _, failures := range reserved {
+		if failures.Key != keys[0].key {
+			others = append(others, failures)
+		}
+	}
+	service.releaseAttempt(ctx, others)
+	return nil
+}
+
+// releaseAttempt takes back the reserved attempt when it neither failed nor
+// finished a login, along with its mark as the latest failure. Errors are
+// logged only; the attempt then counts as failed.
+func (service *Service) releaseAttempt(ctx echo.Context, reserved []repository.LoginFailures) {
+	for _, failures := range reserved {
+		if err := service.repo.ReleaseLoginAttempt(ctx, failures); err != nil {
+			slog.Error("internal error: cannot release login attempt: "+err.Error(), "key", failures.Key)
+		}
+	}
+}
+
+func (service *Service) lockedOut(ctx echo.Context, key string, failures int, until time.Time) {
+	event := &events.SecurityEvent{
+		SchemaVersion: events.CurrentVersion,
+		Id:            uuid.New().String(),
+		Type:          events.SecurityLoginLocked,
+		IP:            ctx.RealIP(),
+		Details: map[string]string{
+			"scope":        "ip",
+			"failures":     fmt.Sprint(failures),
+			"locked_until": until.UTC().Format(time.RFC3339),
+		},
+		OccurredAt: time.Now().UTC(),
+	}
+	// the event names users by id; a username nobody has stays out of it
+	if username, ok := strings.CutPrefix(key, "user:"); ok {
+		event.Details["scope"] = "user"
+		if user, err := service.repo.GetUserByName(ctx, username); err == nil {
+			event.UserId = user.Id
+		}
+	}
+	slog.Warn("security: login locked", "key", key, "ip", event.IP, "failures", failures, "until", until)
+	if err := service.rabbit.SendSecurityEvent(event); err != nil {
+		slog.Error("send security event to rabbit: error: " + err.Error())
+	}
+}
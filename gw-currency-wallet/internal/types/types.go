@@ -2,7 +2,16 @@ package types
 
 import "github.com/golang-jwt/jwt/v5"
 
+// JwtClaims name the user by id in the registered subject. Username is what
+// the user was called at login and only meant for display.
 type JwtClaims struct {
 	Username string `json:"username"`
+	// Roles and Permissions are read when the token is issued; changing a
+	// user's roles ends their sessions.
+	Roles       []string `json:"roles,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+	// ElevatedUntil is set by step-up authentication; until then the token
+	// may be used for operations that need fresh proof of identity.
+	ElevatedUntil *jwt.NumericDate `json:"elevated_until,omitempty"`
 	jwt.RegisteredClaims
 }
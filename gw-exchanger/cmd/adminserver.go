@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"gw-exchanger/internal/auth"
+	"gw-exchanger/internal/repository"
+	"log/slog"
+	"time"
+
+	proto "github.com/lynxbites/proto-grpc/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type adminServer struct {
+	proto.UnimplementedAdminServiceServer
+	repository.AdminRepo
+}
+
+func (server *adminServer) SetRate(ctx context.Context, request *proto.SetRateRequest) (*proto.RateChange, error) {
+	slog.Info("new request: received SetRate request", "actor", auth.Actor(ctx), "from", request.FromCurrency, "to", request.ToCurrency)
+	if err := validatePair(request.FromCurrency, request.ToCurrency); err != nil {
+		return nil, err
+	}
+	if request.Rate <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "rate must be positive")
+	}
+
+	change, err := server.AdminRepo.SetRate(&repository.RateChange{
+		From:   request.FromCurrency,
+		To:     request.ToCurrency,
+		Rate:   request.Rate,
+		Actor:  auth.Actor(ctx),
+		Reason: request.Reason,
+	})
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("ok: set rate request fulfilled")
+	return rateChangeToProto(change), nil
+}
+
+func (server *adminServer) ScheduleRate(ctx context.Context, request *proto.ScheduleRateRequest) (*proto.RateChange, error) {
+	slog.Info("new request: received ScheduleRate request", "actor", auth.Actor(ctx), "from", request.FromCurrency, "to", request.ToCurrency)
+	if err := validatePair(request.FromCurrency, request.ToCurrency); err != nil {
+		return nil, err
+	}
+	if request.Rate <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "rate must be positive")
+	}
+	effectiveAt := time.Unix(request.EffectiveAt, 0)
+	if !effectiveAt.After(time.Now()) {
+		return nil, status.Error(codes.InvalidArgument, "effective_at must be in the future")
+	}
+
+	change, err := server.AdminRepo.ScheduleRate(&repository.RateChange{
+		From:        request.FromCurrency,
+		To:          request.ToCurrency,
+		Rate:        request.Rate,
+		EffectiveAt: effectiveAt,
+		Actor:       auth.Actor(ctx),
+		Reason:      request.Reason,
+	})
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("ok: schedule rate request fulfilled")
+	return rateChangeToProto(change), nil
+}
+
+func (server *adminServer) HaltPair(ctx context.Context, request *proto.PairRequest) (*proto.RateChange, error) {
+	slog.Info("new request: received HaltPair request", "actor", auth.Actor(ctx), "from", request.FromCurrency, "to", request.ToCurrency)
+	if err := validatePair(request.FromCurrency, request.ToCurrency); err != nil {
+		return nil, err
+	}
+
+	change, err := server.AdminRepo.HaltPair(&repository.RateChange{
+		From:   request.FromCurrency,
+		To:     request.ToCurrency,
+		Actor:  auth.Actor(ctx),
+		Reason: request.Reason,
+	})
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("ok: halt pair request fulfilled")
+	return rateChangeToProto(change), nil
+}
+
+func (server *adminServer) ResumePair(ctx context.Context, request *proto.PairRequest) (*proto.RateChange, error) {
+	slog.Info("new request: received ResumePair request", "actor", auth.Actor(ctx), "from", request.FromCurrency, "to", request.ToCurrency)
+	if err := validatePair(request.FromCurrency, request.ToCurrency); err != nil {
+		return nil, err
+	}
+
+	change, err := server.AdminRepo.ResumePair(&repository.RateChange{
+		From:   request.FromCurrency,
+		To:     request.ToCurrency,
+		Actor:  auth.Actor(ctx),
+		Reason: request.Reason,
+	})
+	if errors.Is(err, repository.ErrPairNotHalted) {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("ok: resume pair request fulfilled")
+	return rateChangeToProto(change), nil
+}
+
+func (server *adminServer) ListRateChanges(ctx context.Context, request *proto.ListRateChangesRequest) (*proto.ListRateChangesResponse, error) {
+	slog.Info("new request: received ListRateChanges request", "actor", auth.Actor(ctx))
+	limit := int(request.Limit)
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+
+	changes, err := server.AdminRepo.ListRateChanges(request.FromCurrency, request.ToCurrency, limit)
+	if err != nil {
+		return nil, err
+	}
+	response := &proto.ListRateChangesResponse{Changes: make([]*proto.RateChange, 0, len(changes))}
+	for i := range changes {
+		response.Changes = append(response.Changes, rateChangeToProto(&changes[i]))
+	}
+	slog.Info("ok: list rate changes request fulfilled")
+	return response, nil
+}
+
+// applyScheduledRates runs until the process exits, moving due scheduled
+// rates into effect.
+func applyScheduledRates(repo repository.AdminRepo, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		applied, err := repo.ApplyScheduledRates()
+		if err != nil {
+			slog.Error("scheduled rates: cannot apply: " + err.Error())
+			continue
+		}
+		if applied > 0 {
+			slog.Info("scheduled rates: applied", "count", applied)
+		}
+	}
+}
+
+func validatePair(from string, to string) error {
+	if !isSupportedCurrency(from) || !isSupportedCurrency(to) {
+		slog.Info("bad request: invalid currency")
+		return status.Error(codes.InvalidArgument, "invalid currency")
+	}
+	if from == to {
+		slog.Info("bad request: same currency on both sides")
+		return status.Error(codes.InvalidArgument, "currencies must differ")
+	}
+	return nil
+}
+
+func rateChangeToProto(change *repository.RateChange) *proto.RateChange {
+	response := &proto.RateChange{
+		Id:           change.Id,
+		FromCurrency: change.From,
+		ToCurrency:   change.To,
+		Action:       change.Action,
+		Rate:         change.Rate,
+		EffectiveAt:  change.EffectiveAt.Unix(),
+		Actor:        change.Actor,
+		Reason:       change.Reason,
+		CreatedAt:    change.CreatedAt.Unix(),
+	}
+	if change.AppliedAt != nil {
+		response.AppliedAt = change.AppliedAt.Unix()
+	}
+	return response
+}
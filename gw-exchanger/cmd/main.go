@@ -1,57 +1,106 @@
 package main
 
 import (
-	"fmt"
+	"gw-exchanger/internal/auth"
+	"gw-exchanger/internal/config"
+	"gw-exchanger/internal/repository/migrations"
 	"gw-exchanger/internal/repository/postgres"
 	"log"
 	"net"
 	"os"
 
-	"github.com/jackc/pgx/v5/pgxpool"
-	"github.com/joho/godotenv"
 	proto "github.com/lynxbites/proto-grpc/proto"
-	"golang.org/x/net/context"
+	"github.com/lynxbites/wallet-services/gw-shared/migrate"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
-var db *pgxpool.Pool
-var connStr string
-
-func init() {
-	err := godotenv.Load("config.env")
+func main() {
+	cfg, err := config.NewConfig()
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	connStr = fmt.Sprintf("postgres://%v:%v@%v:%v/%v?sslmode=disable", os.Getenv("POSTGRES_USER"), os.Getenv("POSTGRES_PASSWORD"), os.Getenv("POSTGRES_HOST"), os.Getenv("POSTGRES_PORT"), os.Getenv("POSTGRES_DB"))
-	db, err = pgxpool.New(context.Background(), connStr)
-	if err != nil {
-		log.Fatal(err)
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := migrate.Command(migrations.Files, cfg.DbConfig.Address, os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if cfg.DbConfig.AutoMigrate {
+		if err := migrate.Up(migrations.Files, cfg.DbConfig.Address); err != nil {
+			log.Fatalf("failed to migrate: %v", err)
+		}
 	}
-	// m, err := migrate.New("file://internal/migrations/", connStr)
-	// if err != nil {
-	// 	log.Fatal(err)
-	// }
-	// err = m.Up()
-	// if err != nil {
-	// 	log.Fatal(err)
-	// }
-
-}
 
-func main() {
-	repo, err := postgres.NewPostgresRepo(connStr)
+	repo, err := postgres.NewPostgresRepo(cfg.DbConfig.Address)
 	if err != nil {
 		panic(err)
 	}
-	lis, err := net.Listen("tcp", ":8020")
+	repo.BaseCurrency = cfg.RatesConfig.BaseCurrency
+
+	options, err := serverOptions(cfg)
+	if err != nil {
+		log.Fatalf("failed to configure grpc: %v", err)
+	}
+
+	lis, err := net.Listen("tcp", cfg.ServerConfig.Address)
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
 	}
-	s := grpc.NewServer()
-	proto.RegisterExchangeServiceServer(s, &server{ExchangeRepo: repo})
+	s := grpc.NewServer(options...)
+	proto.RegisterExchangeServiceServer(s, &server{ExchangeRepo: repo, maxRateAge: cfg.RatesConfig.MaxAge})
+
+	go serveAdmin(cfg.AdminConfig.Address, options, repo)
+	go applyScheduledRates(repo, cfg.AdminConfig.ScheduleInterval)
+
 	log.Printf("server listening at %v", lis.Addr())
 	if err := s.Serve(lis); err != nil {
 		log.Fatalf("failed to serve: %v", err)
 	}
 }
+
+func serveAdmin(address string, options []grpc.ServerOption, repo *postgres.PostgresRepo) {
+	lis, err := net.Listen("tcp", address)
+	if err != nil {
+		log.Fatalf("admin: failed to listen: %v", err)
+	}
+	s := grpc.NewServer(options...)
+	proto.RegisterAdminServiceServer(s, &adminServer{AdminRepo: repo})
+	log.Printf("admin server listening at %v", lis.Addr())
+	if err := s.Serve(lis); err != nil {
+		log.Fatalf("admin: failed to serve: %v", err)
+	}
+}
+
+// serverOptions sets up TLS and the auth interceptors shared by both
+// servers. Holders of ADMIN_TOKENS are allowed the whole AdminService on top
+// of whatever GRPC_ALLOW grants them; a client certificate with the same
+// name is not.
+func serverOptions(cfg *config.Config) ([]grpc.ServerOption, error) {
+	tokens := auth.ParseTokens(cfg.ServerConfig.Tokens)
+	allow := auth.ParseAllowList(cfg.ServerConfig.Allow)
+	for token, name := range auth.ParseTokens(cfg.AdminConfig.Tokens) {
+		tokens[token] = name
+		identity := auth.TokenPrefix + name
+		allow[identity] = append(allow[identity], "/"+proto.AdminService_ServiceDesc.ServiceName+"/*")
+	}
+	if len(allow) == 0 {
+		log.Printf("GRPC_ALLOW and ADMIN_TOKENS are empty, every call will be rejected")
+	}
+	authenticator := auth.NewAuthenticator(tokens, allow)
+	options := []grpc.ServerOption{
+		grpc.UnaryInterceptor(authenticator.UnaryInterceptor),
+		grpc.StreamInterceptor(authenticator.StreamInterceptor),
+	}
+
+	if cfg.ServerConfig.TLSCert == "" {
+		log.Printf("GRPC_TLS_CERT is empty, serving without TLS")
+		return options, nil
+	}
+	tlsConfig, err := auth.ServerTLS(cfg.ServerConfig.TLSCert, cfg.ServerConfig.TLSKey, cfg.ServerConfig.ClientCA)
+	if err != nil {
+		return nil, err
+	}
+	return append(options, grpc.Creds(credentials.NewTLS(tlsConfig))), nil
+}
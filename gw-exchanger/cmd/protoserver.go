@@ -5,55 +5,102 @@ import (
 	"errors"
 	"gw-exchanger/internal/repository"
 	"log/slog"
+	"sync"
 	"time"
 
 	proto "github.com/lynxbites/proto-grpc/proto"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type server struct {
 	proto.UnimplementedExchangeServiceServer
 	repository.ExchangeRepo
+	// cacheMu guards the cache, which concurrent calls read and refill.
+	cacheMu     sync.RWMutex
 	cachedRates map[string]float64
+	cachedAsOf  time.Time
 	LastUpdate  time.Time
+	// maxRateAge is how old a quote may be before conversions are refused.
+	maxRateAge time.Duration
 }
 
 func (server *server) GetExchangeRates(ctx context.Context, request *proto.Empty) (*proto.ExchangeRatesResponse, error) {
 	slog.Info("new request: received GetRates request")
+	server.cacheMu.RLock()
 	if !time.Now().After(server.LastUpdate.Add(time.Minute * 5)) {
+		response := &proto.ExchangeRatesResponse{Rates: server.cachedRates, AsOf: server.cachedAsOf.Unix()}
+		server.cacheMu.RUnlock()
 		slog.Info("ok: sending cached rates")
-		return &proto.ExchangeRatesResponse{Rates: server.cachedRates}, nil
+		return response, nil
 	}
+	server.cacheMu.RUnlock()
 
-	newRates, err := server.ExchangeRepo.GetRates()
+	newRates, err := server.ExchangeRepo.GetReferenceRates()
 	if err != nil {
 		return nil, err
 	}
+	server.cacheMu.Lock()
 	server.LastUpdate = time.Now()
-	server.cachedRates = newRates
+	server.cachedRates = newRates.Rates
+	server.cachedAsOf = newRates.AsOf
+	server.cacheMu.Unlock()
 	slog.Info("ok: get rates request fulfilled")
-	return &proto.ExchangeRatesResponse{Rates: newRates}, nil
+	return &proto.ExchangeRatesResponse{Rates: newRates.Rates, AsOf: newRates.AsOf.Unix()}, nil
 }
 
 func (server *server) GetExchangeRateForCurrency(ctx context.Context, request *proto.CurrencyRequest) (*proto.ExchangeRateResponse, error) {
 
 	slog.Info("new request: received GetRates request, %v to %v\n", request.FromCurrency, request.ToCurrency)
-	if request.FromCurrency != "USD" && request.FromCurrency != "RUB" && request.FromCurrency != "EUR" {
-		slog.Info("bad request: invalid currency")
-		return nil, errors.New("Invalid currency")
-	}
-	if request.ToCurrency != "USD" && request.ToCurrency != "RUB" && request.ToCurrency != "EUR" {
+	if !isSupportedCurrency(request.FromCurrency) || !isSupportedCurrency(request.ToCurrency) {
 		slog.Info("bad request: invalid currency")
 		return nil, errors.New("Invalid currency")
 	}
 
-	rate, err := server.ExchangeRepo.Exchange(request.FromCurrency, request.ToCurrency)
+	quote, err := server.ExchangeRepo.Quote(request.FromCurrency, request.ToCurrency)
+	if errors.Is(err, repository.ErrPairHalted) {
+		slog.Info("rejected: trading halted for pair")
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
 	if err != nil {
 		return nil, err
 	}
+	if server.maxRateAge > 0 && time.Since(quote.AsOf) > server.maxRateAge {
+		slog.Warn("rejected: stale rate", "from", quote.From, "to", quote.To, "as_of", quote.AsOf)
+		return nil, staleRateError(quote.AsOf)
+	}
+
+	legs := make([]*proto.RateLeg, 0, len(quote.Legs))
+	for _, leg := range quote.Legs {
+		legs = append(legs, &proto.RateLeg{
+			FromCurrency: leg.From,
+			ToCurrency:   leg.To,
+			Rate:         leg.Rate,
+			Direct:       leg.Direct,
+			AsOf:         leg.AsOf.Unix(),
+		})
+	}
 	slog.Info("ok: get exchange rate for currency request fulfilled")
 	return &proto.ExchangeRateResponse{
 		FromCurrency: request.FromCurrency,
 		ToCurrency:   request.ToCurrency,
-		Rate:         rate,
+		Rate:         quote.Rate,
+		Direct:       quote.Direct,
+		Legs:         legs,
+		AsOf:         quote.AsOf.Unix(),
 	}, nil
 }
+
+func staleRateError(asOf time.Time) error {
+	stale := status.New(codes.Unavailable, "rate is stale, last updated at "+asOf.UTC().Format(time.RFC3339))
+	withInfo, err := stale.WithDetails(&errdetails.ErrorInfo{Reason: proto.ReasonRateStale, Domain: proto.ErrorDomain})
+	if err != nil {
+		return stale.Err()
+	}
+	return withInfo.Err()
+}
+
+func isSupportedCurrency(currency string) bool {
+	return currency == "USD" || currency == "RUB" || currency == "EUR"
+}
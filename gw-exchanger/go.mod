@@ -7,8 +7,9 @@ require (
 	github.com/jackc/pgx/v5 v5.7.4
 	github.com/joho/godotenv v1.5.1
 	github.com/lynxbites/proto-grpc v0.0.0-20250506070042-30693e457fac
+	github.com/lynxbites/wallet-services/gw-shared v0.0.0-00010101000000-000000000000
 	github.com/ory/dockertest v3.3.5+incompatible
-	golang.org/x/net v0.38.0
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20250218202821-56aae31c358a
 	google.golang.org/grpc v1.72.0
 )
 
@@ -35,10 +36,14 @@ require (
 	github.com/sirupsen/logrus v1.9.3 // indirect
 	go.uber.org/atomic v1.7.0 // indirect
 	golang.org/x/crypto v0.36.0 // indirect
+	golang.org/x/net v0.38.0 // indirect
 	golang.org/x/sync v0.12.0 // indirect
 	golang.org/x/sys v0.31.0 // indirect
 	golang.org/x/text v0.23.0 // indirect
-	google.golang.org/genproto/googleapis/rpc v0.0.0-20250218202821-56aae31c358a // indirect
 	google.golang.org/protobuf v1.36.6 // indirect
 	gotest.tools v2.2.0+incompatible // indirect
 )
+
+replace github.com/lynxbites/proto-grpc => ../proto-grpc
+
+replace github.com/lynxbites/wallet-services/gw-shared => ../gw-shared
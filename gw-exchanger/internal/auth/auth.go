@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"log/slog"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+type actorKey struct{}
+
+// Identities carry where they come from, so a certificate cannot pass for
+// the owner of a token with the same name.
+const (
+	TokenPrefix = "token:"
+	CertPrefix  = "cert:"
+)
+
+// Authenticator identifies gRPC callers by the bearer token in the
+// "authorization" metadata, as "token:<name>", or by the common name of a
+// verified client certificate, as "cert:<name>", and lets a call through
+// only if the caller's allow-list matches the method.
+type Authenticator struct {
+	// tokens maps a token to the name of its owner
+	tokens map[string]string
+	// allow maps an identity to the methods it may call
+	allow map[string][]string
+}
+
+func NewAuthenticator(tokens map[string]string, allow map[string][]string) *Authenticator {
+	return &Authenticator{tokens: tokens, allow: allow}
+}
+
+// ParseTokens reads a "name:token,name:token" list.
+func ParseTokens(list string) map[string]string {
+	tokens := make(map[string]string)
+	for _, entry := range strings.Split(list, ",") {
+		name, token, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok || name == "" || token == "" {
+			continue
+		}
+		tokens[token] = name
+	}
+	return tokens
+}
+
+// ParseAllowList reads a "name=method,method;name=method" list. A name
+// starting with "token:" or "cert:" is that identity only, a bare name is
+// both. A method ending in "*" matches every method with that prefix.
+func ParseAllowList(list string) map[string][]string {
+	allow := make(map[string][]string)
+	for _, entry := range strings.Split(list, ";") {
+		name, methods, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || name == "" {
+			continue
+		}
+		identities := []string{name}
+		if !strings.HasPrefix(name, TokenPrefix) && !strings.HasPrefix(name, CertPrefix) {
+			identities = []string{TokenPrefix + name, CertPrefix + name}
+		}
+		for _, method := range strings.Split(methods, ",") {
+			if method = strings.TrimSpace(method); method != "" {
+				for _, identity := range identities {
+					allow[identity] = append(allow[identity], method)
+				}
+			}
+		}
+	}
+	return allow
+}
+
+func (auth *Authenticator) UnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, err := auth.authorize(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (auth *Authenticator) StreamInterceptor(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := auth.authorize(stream.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &authorizedStream{ServerStream: stream, ctx: ctx})
+}
+
+func (auth *Authenticator) authorize(ctx context.Context, method string) (context.Context, error) {
+	actor, err := auth.authenticate(ctx)
+	if err != nil {
+		slog.Info("unauthenticated: rejected call to " + method)
+		return nil, err
+	}
+	if !auth.allowed(actor, method) {
+		slog.Info("permission denied: rejected call to "+method, "actor", actor)
+		return nil, status.Error(codes.PermissionDenied, "method not allowed")
+	}
+	return context.WithValue(ctx, actorKey{}, actor), nil
+}
+
+// authenticate prefers a bearer token; without one it falls back to the
+// client certificate. A token that is presented but unknown is an error
+// even if the certificate is valid.
+func (auth *Authenticator) authenticate(ctx context.Context) (string, error) {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("authorization"); len(values) > 0 {
+			presented, ok := strings.CutPrefix(values[0], "Bearer ")
+			if !ok {
+				return "", status.Error(codes.Unauthenticated, "malformed authorization header")
+			}
+			for token, name := range auth.tokens {
+				if subtle.ConstantTimeCompare([]byte(token), []byte(presented)) == 1 {
+					return TokenPrefix + name, nil
+				}
+			}
+			return "", status.Error(codes.Unauthenticated, "invalid token")
+		}
+	}
+
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(info.State.VerifiedChains) > 0 && len(info.State.VerifiedChains[0]) > 0 {
+			if name := info.State.VerifiedChains[0][0].Subject.CommonName; name != "" {
+				return CertPrefix + name, nil
+			}
+		}
+	}
+	return "", status.Error(codes.Unauthenticated, "missing token or client certificate")
+}
+
+func (auth *Authenticator) allowed(actor string, method string) bool {
+	for _, pattern := range auth.allow[actor] {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(method, prefix) {
+				return true
+			}
+		} else if pattern == method {
+			return true
+		}
+	}
+	return false
+}
+
+// Actor returns the identity of the authenticated caller, with its prefix.
+func Actor(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
+
+type authorizedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (stream *authorizedStream) Context() context.Context {
+	return stream.ctx
+}
@@ -0,0 +1,66 @@
+package auth_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"gw-exchanger/internal/auth"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnaryInterceptor(t *testing.T) {
+	authenticator := auth.NewAuthenticator(
+		auth.ParseTokens("wallet:wallet-token, alice:alice-token"),
+		auth.ParseAllowList("wallet=/proto.ExchangeService/*; token:alice=/proto.AdminService/SetRate"),
+	)
+
+	tests := []struct {
+		name   string
+		token  string
+		cert   string
+		method string
+		code   codes.Code
+		actor  string
+	}{
+		{"wildcard", "wallet-token", "", "/proto.ExchangeService/GetExchangeRates", codes.OK, "token:wallet"},
+		{"exact", "alice-token", "", "/proto.AdminService/SetRate", codes.OK, "token:alice"},
+		{"not allowed", "wallet-token", "", "/proto.AdminService/SetRate", codes.PermissionDenied, ""},
+		{"unknown token", "nope", "", "/proto.ExchangeService/GetExchangeRates", codes.Unauthenticated, ""},
+		{"no token", "", "", "/proto.ExchangeService/GetExchangeRates", codes.Unauthenticated, ""},
+		{"certificate", "", "wallet", "/proto.ExchangeService/GetExchangeRates", codes.OK, "cert:wallet"},
+		// a certificate named like a token owner gets nothing granted to the token
+		{"certificate named like a token", "", "alice", "/proto.AdminService/SetRate", codes.PermissionDenied, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			if test.cert != "" {
+				chain := []*x509.Certificate{{Subject: pkix.Name{CommonName: test.cert}}}
+				ctx = peer.NewContext(ctx, &peer.Peer{AuthInfo: credentials.TLSInfo{State: tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{chain}}}})
+			}
+			if test.token != "" {
+				ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", "Bearer "+test.token))
+			}
+			var actor string
+			_, err := authenticator.UnaryInterceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: test.method}, func(ctx context.Context, req any) (any, error) {
+				actor = auth.Actor(ctx)
+				return nil, nil
+			})
+			if status.Code(err) != test.code {
+				t.Fatalf("expected %v, got %v\n", test.code, err)
+			}
+			if actor != test.actor {
+				t.Fatalf("expected actor %q, got %q\n", test.actor, actor)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+type Config struct {
+	DbConfig     dbConfig
+	RatesConfig  ratesConfig
+	ServerConfig serverConfig
+	AdminConfig  adminConfig
+}
+
+type dbConfig struct {
+	Address string
+	// AutoMigrate applies pending migrations on start.
+	AutoMigrate bool
+}
+
+type ratesConfig struct {
+	// BaseCurrency is the currency cross rates are triangulated through
+	// when a pair has no direct quote.
+	BaseCurrency string
+	// MaxAge is how old a rate may be before conversions at it are refused.
+	MaxAge time.Duration
+}
+
+type serverConfig struct {
+	Address string
+	// TLSCert and TLSKey enable TLS on both gRPC servers; ClientCA
+	// additionally requires client certificates signed by it.
+	TLSCert  string
+	TLSKey   string
+	ClientCA string
+	// Tokens is the raw "name:token,name:token" list of service tokens.
+	Tokens string
+	// Allow is the raw "name=method,method;name=method" allow-list.
+	Allow string
+}
+
+type adminConfig struct {
+	Address string
+	// Tokens is the raw "name:token,name:token" list of admin tokens.
+	Tokens           string
+	ScheduleInterval time.Duration
+}
+
+func NewConfig() (*Config, error) {
+
+	err := godotenv.Load("config.env")
+
+	if err != nil {
+		return nil, err
+	}
+
+	baseCurrency := os.Getenv("RATES_BASE_CURRENCY")
+	if baseCurrency == "" {
+		baseCurrency = "USD"
+	}
+
+	maxAge := 24 * time.Hour
+	if age := os.Getenv("RATES_MAX_AGE"); age != "" {
+		maxAge, err = time.ParseDuration(age)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	address := os.Getenv("GRPC_ADDR")
+	if address == "" {
+		address = ":8020"
+	}
+
+	adminAddress := os.Getenv("ADMIN_ADDR")
+	if adminAddress == "" {
+		adminAddress = ":8021"
+	}
+	scheduleInterval := 30 * time.Second
+	if interval := os.Getenv("RATES_SCHEDULE_INTERVAL"); interval != "" {
+		scheduleInterval, err = time.ParseDuration(interval)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	server := serverConfig{
+		Address:  address,
+		TLSCert:  os.Getenv("GRPC_TLS_CERT"),
+		TLSKey:   os.Getenv("GRPC_TLS_KEY"),
+		ClientCA: os.Getenv("GRPC_TLS_CLIENT_CA"),
+		Tokens:   os.Getenv("GRPC_TOKENS"),
+		Allow:    os.Getenv("GRPC_ALLOW"),
+	}
+	adminTokens := os.Getenv("ADMIN_TOKENS")
+	if err := server.validateTLS(adminTokens); err != nil {
+		return nil, err
+	}
+
+	storage := Config{
+		DbConfig: dbConfig{
+			Address:     fmt.Sprintf("postgres://%v:%v@%v:%v/%v?sslmode=disable", os.Getenv("POSTGRES_USER"), os.Getenv("POSTGRES_PASSWORD"), os.Getenv("POSTGRES_HOST"), os.Getenv("POSTGRES_PORT"), os.Getenv("POSTGRES_DB")),
+			AutoMigrate: os.Getenv("DB_AUTO_MIGRATE") == "true",
+		},
+		RatesConfig: ratesConfig{
+			BaseCurrency: baseCurrency,
+			MaxAge:       maxAge,
+		},
+		ServerConfig: server,
+		AdminConfig: adminConfig{
+			Address:          adminAddress,
+			Tokens:           adminTokens,
+			ScheduleInterval: scheduleInterval,
+		},
+	}
+	return &storage, nil
+}
+
+// validateTLS refuses settings that would quietly weaken the servers: bearer
+// tokens sent in plaintext and a client CA that is ignored without TLS.
+func (server *serverConfig) validateTLS(adminTokens string) error {
+	if (server.TLSCert == "") != (server.TLSKey == "") {
+		return errors.New("GRPC_TLS_CERT and GRPC_TLS_KEY must be set together")
+	}
+	if server.TLSCert != "" {
+		return nil
+	}
+	if server.ClientCA != "" {
+		return errors.New("GRPC_TLS_CLIENT_CA needs GRPC_TLS_CERT and GRPC_TLS_KEY")
+	}
+	if server.Tokens != "" || adminTokens != "" {
+		return errors.New("GRPC_TOKENS and ADMIN_TOKENS need TLS, set GRPC_TLS_CERT and GRPC_TLS_KEY")
+	}
+	return nil
+}
@@ -1 +1 @@
-DROP TABLE IF EXISTS public.rates
\ No newline at end of file
+DROP TABLE IF EXISTS public.rates;
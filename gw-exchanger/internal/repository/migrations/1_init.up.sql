@@ -3,4 +3,4 @@ CREATE TABLE IF NOT EXISTS public.rates
     usd numeric NOT NULL,
     rub numeric NOT NULL,
     eur numeric NOT NULL
-)
\ No newline at end of file
+);
@@ -1 +1 @@
-DELETE * FROM rates
\ No newline at end of file
+DELETE FROM rates;
@@ -1 +1 @@
-INSERT INTO rates (usd, rub, eur) VALUES (1, 80.24, 0.8851)
\ No newline at end of file
+INSERT INTO rates (usd, rub, eur) VALUES (1, 80.24, 0.8851);
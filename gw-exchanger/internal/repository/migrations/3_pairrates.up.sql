@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS public.pair_rates
+(
+    from_currency text COLLATE pg_catalog."default" NOT NULL,
+    to_currency text COLLATE pg_catalog."default" NOT NULL,
+    rate numeric NOT NULL,
+    updated_at timestamp with time zone NOT NULL DEFAULT now(),
+    CONSTRAINT pair_rates_primary PRIMARY KEY (from_currency, to_currency),
+    CONSTRAINT positive_rate CHECK (rate > 0::numeric),
+    CONSTRAINT distinct_currencies CHECK (from_currency <> to_currency)
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS public.trading_halts;
+DROP TABLE IF EXISTS public.rate_changes;
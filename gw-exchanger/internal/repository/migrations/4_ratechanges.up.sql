@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS public.rate_changes
+(
+    id bigserial NOT NULL,
+    from_currency text COLLATE pg_catalog."default" NOT NULL,
+    to_currency text COLLATE pg_catalog."default" NOT NULL,
+    action text COLLATE pg_catalog."default" NOT NULL,
+    rate numeric,
+    effective_at timestamp with time zone NOT NULL DEFAULT now(),
+    applied_at timestamp with time zone,
+    actor text COLLATE pg_catalog."default" NOT NULL,
+    reason text COLLATE pg_catalog."default" NOT NULL DEFAULT '',
+    created_at timestamp with time zone NOT NULL DEFAULT now(),
+    CONSTRAINT rate_changes_primary PRIMARY KEY (id),
+    CONSTRAINT known_action CHECK (action IN ('set', 'schedule', 'halt', 'resume'))
+);
+
+CREATE INDEX IF NOT EXISTS rate_changes_pending ON public.rate_changes (effective_at) WHERE action = 'schedule' AND applied_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS public.trading_halts
+(
+    from_currency text COLLATE pg_catalog."default" NOT NULL,
+    to_currency text COLLATE pg_catalog."default" NOT NULL,
+    actor text COLLATE pg_catalog."default" NOT NULL,
+    reason text COLLATE pg_catalog."default" NOT NULL DEFAULT '',
+    halted_at timestamp with time zone NOT NULL DEFAULT now(),
+    CONSTRAINT trading_halts_primary PRIMARY KEY (from_currency, to_currency)
+);
@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS pair_rates_touch_updated_at ON public.pair_rates;
+DROP TRIGGER IF EXISTS rates_touch_updated_at ON public.rates;
+DROP FUNCTION IF EXISTS public.touch_updated_at();
+ALTER TABLE public.rates DROP COLUMN IF EXISTS updated_at;
@@ -0,0 +1,14 @@
+ALTER TABLE public.rates ADD COLUMN IF NOT EXISTS updated_at timestamp with time zone NOT NULL DEFAULT now();
+
+CREATE OR REPLACE FUNCTION public.touch_updated_at() RETURNS trigger AS $$
+BEGIN
+    NEW.updated_at = now();
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS rates_touch_updated_at ON public.rates;
+CREATE TRIGGER rates_touch_updated_at BEFORE UPDATE ON public.rates FOR EACH ROW EXECUTE FUNCTION public.touch_updated_at();
+
+DROP TRIGGER IF EXISTS pair_rates_touch_updated_at ON public.pair_rates;
+CREATE TRIGGER pair_rates_touch_updated_at BEFORE UPDATE ON public.pair_rates FOR EACH ROW EXECUTE FUNCTION public.touch_updated_at();
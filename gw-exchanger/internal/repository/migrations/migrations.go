@@ -0,0 +1,8 @@
+// Package migrations embeds the exchanger's SQL migrations, they are applied
+// with gw-shared/migrate.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var Files embed.FS
@@ -0,0 +1,188 @@
+package postgres
+
+import (
+	"context"
+	"gw-exchanger/internal/repository"
+	"log/slog"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const rateChangeColumns = "id, from_currency, to_currency, action, coalesce(rate, 0), effective_at, applied_at, actor, reason, created_at"
+
+func (repo *PostgresRepo) SetRate(change *repository.RateChange) (*repository.RateChange, error) {
+
+	ctx := context.Background()
+	tx, err := repo.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := upsertPairRate(ctx, tx, change.From, change.To, change.Rate); err != nil {
+		slog.Error("internal server error: cannot update pair_rates")
+		return nil, err
+	}
+	change.Action = "set"
+	recorded, err := recordChange(ctx, tx, change)
+	if err != nil {
+		return nil, err
+	}
+	return recorded, tx.Commit(ctx)
+}
+
+func (repo *PostgresRepo) ScheduleRate(change *repository.RateChange) (*repository.RateChange, error) {
+
+	change.Action = "schedule"
+	ctx := context.Background()
+	row := repo.db.QueryRow(ctx, "insert into rate_changes (from_currency, to_currency, action, rate, effective_at, actor, reason) values ($1, $2, $3, $4, $5, $6, $7) returning "+rateChangeColumns,
+		change.From, change.To, change.Action, change.Rate, change.EffectiveAt, change.Actor, change.Reason)
+	recorded, err := scanRateChange(row)
+	if err != nil {
+		slog.Error("internal server error: cannot insert into rate_changes")
+		return nil, err
+	}
+	return recorded, nil
+}
+
+func (repo *PostgresRepo) HaltPair(change *repository.RateChange) (*repository.RateChange, error) {
+
+	ctx := context.Background()
+	tx, err := repo.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, "insert into trading_halts (from_currency, to_currency, actor, reason) values ($1, $2, $3, $4) on conflict (from_currency, to_currency) do update set actor = excluded.actor, reason = excluded.reason, halted_at = now()",
+		change.From, change.To, change.Actor, change.Reason)
+	if err != nil {
+		slog.Error("internal server error: cannot insert into trading_halts")
+		return nil, err
+	}
+	change.Action = "halt"
+	recorded, err := recordChange(ctx, tx, change)
+	if err != nil {
+		return nil, err
+	}
+	return recorded, tx.Commit(ctx)
+}
+
+func (repo *PostgresRepo) ResumePair(change *repository.RateChange) (*repository.RateChange, error) {
+
+	ctx := context.Background()
+	tx, err := repo.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, "delete from trading_halts where (from_currency = $1 and to_currency = $2) or (from_currency = $2 and to_currency = $1)", change.From, change.To)
+	if err != nil {
+		slog.Error("internal server error: cannot delete from trading_halts")
+		return nil, err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, repository.ErrPairNotHalted
+	}
+	change.Action = "resume"
+	recorded, err := recordChange(ctx, tx, change)
+	if err != nil {
+		return nil, err
+	}
+	return recorded, tx.Commit(ctx)
+}
+
+func (repo *PostgresRepo) ListRateChanges(from string, to string, limit int) ([]repository.RateChange, error) {
+
+	rows, err := repo.db.Query(context.Background(), "select "+rateChangeColumns+" from rate_changes where ($1 = '' or from_currency = $1) and ($2 = '' or to_currency = $2) order by id desc limit $3", from, to, limit)
+	if err != nil {
+		slog.Error("internal server error: cannot query rate_changes")
+		return nil, err
+	}
+	changes, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (repository.RateChange, error) {
+		change, err := scanRateChange(row)
+		if err != nil {
+			return repository.RateChange{}, err
+		}
+		return *change, nil
+	})
+	if err != nil {
+		slog.Error("internal server error: cannot scan into repository.RateChange")
+		return nil, err
+	}
+	return changes, nil
+}
+
+// ApplyScheduledRates moves every due scheduled rate into pair_rates, oldest
+// first, and marks it applied. Rows are locked with skip locked so several
+// instances can run it at once.
+func (repo *PostgresRepo) ApplyScheduledRates() (int, error) {
+
+	ctx := context.Background()
+	tx, err := repo.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, "select "+rateChangeColumns+" from rate_changes where action = 'schedule' and applied_at is null and effective_at <= now() order by effective_at, id for update skip locked")
+	if err != nil {
+		slog.Error("internal server error: cannot query scheduled rates")
+		return 0, err
+	}
+	due, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*repository.RateChange, error) {
+		return scanRateChange(row)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, change := range due {
+		if err := upsertPairRate(ctx, tx, change.From, change.To, change.Rate); err != nil {
+			slog.Error("internal server error: cannot apply scheduled rate")
+			return 0, err
+		}
+		if _, err := tx.Exec(ctx, "update rate_changes set applied_at = now() where id = $1", change.Id); err != nil {
+			return 0, err
+		}
+	}
+	return len(due), tx.Commit(ctx)
+}
+
+// upsertPairRate stores the quote for a pair and drops the quote for the
+// inverse pair, so both directions stay consistent.
+func upsertPairRate(ctx context.Context, tx pgx.Tx, from string, to string, rate float64) error {
+	_, err := tx.Exec(ctx, "insert into pair_rates (from_currency, to_currency, rate, updated_at) values ($1, $2, $3, now()) on conflict (from_currency, to_currency) do update set rate = excluded.rate, updated_at = excluded.updated_at", from, to, rate)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, "delete from pair_rates where from_currency = $1 and to_currency = $2", to, from)
+	return err
+}
+
+// recordChange appends an immediate change to the history. Only set carries
+// a rate, and it is applied as soon as it is recorded.
+func recordChange(ctx context.Context, tx pgx.Tx, change *repository.RateChange) (*repository.RateChange, error) {
+	var rate any
+	if change.Action == "set" {
+		rate = change.Rate
+	}
+	row := tx.QueryRow(ctx, "insert into rate_changes (from_currency, to_currency, action, rate, applied_at, actor, reason) values ($1, $2, $3, $4, case when $3 = 'set' then now() end, $5, $6) returning "+rateChangeColumns,
+		change.From, change.To, change.Action, rate, change.Actor, change.Reason)
+	recorded, err := scanRateChange(row)
+	if err != nil {
+		slog.Error("internal server error: cannot insert into rate_changes")
+		return nil, err
+	}
+	return recorded, nil
+}
+
+func scanRateChange(row pgx.Row) (*repository.RateChange, error) {
+	change := new(repository.RateChange)
+	err := row.Scan(&change.Id, &change.From, &change.To, &change.Action, &change.Rate, &change.EffectiveAt, &change.AppliedAt, &change.Actor, &change.Reason, &change.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return change, nil
+}
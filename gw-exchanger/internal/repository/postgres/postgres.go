@@ -2,14 +2,19 @@ package postgres
 
 import (
 	"context"
+	"fmt"
+	"gw-exchanger/internal/repository"
 	"log"
 	"log/slog"
+	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type PostgresRepo struct {
 	db *pgxpool.Pool
+	// BaseCurrency is used to triangulate pairs that have no direct quote.
+	BaseCurrency string
 }
 
 type Rates struct {
@@ -24,41 +29,186 @@ func NewPostgresRepo(connStr string) (*PostgresRepo, error) {
 	if err != nil {
 		return &PostgresRepo{}, err
 	}
-	return &PostgresRepo{db: pool}, nil
+	return &PostgresRepo{db: pool, BaseCurrency: "USD"}, nil
 
 }
 
 func (repo *PostgresRepo) GetRates() (map[string]float64, error) {
 
+	reference, err := repo.GetReferenceRates()
+	if err != nil {
+		return nil, err
+	}
+	return reference.Rates, nil
+}
+
+func (repo *PostgresRepo) GetReferenceRates() (*repository.ReferenceRates, error) {
+
 	rates := new(Rates)
-	err := repo.db.QueryRow(context.Background(), "select (usd, rub, eur) from rates").Scan(rates)
+	var asOf time.Time
+	err := repo.db.QueryRow(context.Background(), "select usd, rub, eur, updated_at from rates").Scan(&rates.USD, &rates.RUB, &rates.EUR, &asOf)
 	if err != nil {
 		slog.Error("internal server error: cannot scan into Rates")
 		return nil, err
 	}
-	return map[string]float64{
-		"USD": rates.USD,
-		"RUB": rates.RUB,
-		"EUR": rates.EUR,
+	return &repository.ReferenceRates{
+		Rates: map[string]float64{
+			"USD": rates.USD,
+			"RUB": rates.RUB,
+			"EUR": rates.EUR,
+		},
+		AsOf: asOf,
 	}, nil
 }
 
 func (repo *PostgresRepo) Exchange(from string, to string) (float64, error) {
 
-	rates := new(Rates)
-	err := repo.db.QueryRow(context.Background(), "select (usd, rub, eur) from rates").Scan(rates)
+	quote, err := repo.Quote(from, to)
 	if err != nil {
-		slog.Error("internal server error: cannot scan into Rates")
 		return 0, err
 	}
+	log.Printf("Converted %v to %v, exchange rate - %v", from, to, quote.Rate)
+	return quote.Rate, nil
+}
+
+// Quote returns the rate for a pair. A directly quoted pair (in either
+// direction) wins; otherwise the rate is triangulated through the base
+// currency, using direct quotes for the legs where they exist and the
+// reference rates for the rest. The quote is refused if the pair or any of
+// its legs is halted.
+func (repo *PostgresRepo) Quote(from string, to string) (*repository.Quote, error) {
+
+	reference, err := repo.GetReferenceRates()
+	if err != nil {
+		return nil, err
+	}
+	base := repo.BaseCurrency
+	for _, currency := range []string{from, to, base} {
+		if _, ok := reference.Rates[currency]; !ok {
+			return nil, fmt.Errorf("unsupported currency %v", currency)
+		}
+	}
+
+	pairs, err := repo.getPairRates(from, to, base)
+	if err != nil {
+		return nil, err
+	}
+
+	quote := triangulate(reference, pairs, from, to, base)
+	halted, err := repo.isHalted(quote)
+	if err != nil {
+		return nil, err
+	}
+	if halted {
+		return nil, repository.ErrPairHalted
+	}
+	return quote, nil
+}
 
-	ratesMap := map[string]float64{
-		"USD": rates.USD,
-		"RUB": rates.RUB,
-		"EUR": rates.EUR,
+func triangulate(reference *repository.ReferenceRates, pairs map[[2]string]pairRate, from string, to string, base string) *repository.Quote {
+
+	quote := &repository.Quote{From: from, To: to}
+	if from == to {
+		quote.Rate = 1
+		quote.Direct = true
+		quote.AsOf = time.Now()
+		return quote
+	}
+	if leg, ok := directLeg(pairs, from, to); ok {
+		quote.Rate = leg.Rate
+		quote.Direct = true
+		quote.Legs = []repository.Leg{leg}
+		quote.AsOf = leg.AsOf
+		return quote
 	}
 
-	rate := ratesMap[to] / ratesMap[from]
-	log.Printf("Converted %v to %v, exchange rate - %v", from, to, rate)
-	return rate, nil
+	if from == base || to == base {
+		leg := referenceLeg(reference, from, to)
+		quote.Rate = leg.Rate
+		quote.Legs = []repository.Leg{leg}
+		quote.AsOf = leg.AsOf
+		return quote
+	}
+
+	first, ok := directLeg(pairs, from, base)
+	if !ok {
+		first = referenceLeg(reference, from, base)
+	}
+	second, ok := directLeg(pairs, base, to)
+	if !ok {
+		second = referenceLeg(reference, base, to)
+	}
+	quote.Legs = []repository.Leg{first, second}
+	if !first.Direct && !second.Direct {
+		// both legs come from the same reference row, so divide once
+		// instead of multiplying two rounded legs
+		quote.Rate = referenceLeg(reference, from, to).Rate
+	} else {
+		quote.Rate = first.Rate * second.Rate
+	}
+	quote.AsOf = first.AsOf
+	if second.AsOf.Before(quote.AsOf) {
+		quote.AsOf = second.AsOf
+	}
+	return quote
+}
+
+// isHalted reports whether trading is halted for the pair of the quote or
+// for any of its legs, in either direction.
+func (repo *PostgresRepo) isHalted(quote *repository.Quote) (bool, error) {
+
+	froms := []string{quote.From}
+	tos := []string{quote.To}
+	for _, leg := range quote.Legs {
+		froms = append(froms, leg.From)
+		tos = append(tos, leg.To)
+	}
+	var halted bool
+	err := repo.db.QueryRow(context.Background(), "select exists (select 1 from trading_halts h join unnest($1::text[], $2::text[]) as p(from_currency, to_currency) on (h.from_currency = p.from_currency and h.to_currency = p.to_currency) or (h.from_currency = p.to_currency and h.to_currency = p.from_currency))", froms, tos).Scan(&halted)
+	if err != nil {
+		slog.Error("internal server error: cannot query trading_halts")
+		return false, err
+	}
+	return halted, nil
+}
+
+type pairRate struct {
+	rate      float64
+	updatedAt time.Time
+}
+
+func (repo *PostgresRepo) getPairRates(currencies ...string) (map[[2]string]pairRate, error) {
+
+	rows, err := repo.db.Query(context.Background(), "select from_currency, to_currency, rate, updated_at from pair_rates where from_currency = any($1) and to_currency = any($1)", currencies)
+	if err != nil {
+		slog.Error("internal server error: cannot query pair_rates")
+		return nil, err
+	}
+	defer rows.Close()
+
+	pairs := make(map[[2]string]pairRate)
+	for rows.Next() {
+		var from, to string
+		var pair pairRate
+		if err := rows.Scan(&from, &to, &pair.rate, &pair.updatedAt); err != nil {
+			slog.Error("internal server error: cannot scan pair rate")
+			return nil, err
+		}
+		pairs[[2]string{from, to}] = pair
+	}
+	return pairs, rows.Err()
+}
+
+func directLeg(pairs map[[2]string]pairRate, from string, to string) (repository.Leg, bool) {
+	if pair, ok := pairs[[2]string{from, to}]; ok {
+		return repository.Leg{From: from, To: to, Rate: pair.rate, Direct: true, AsOf: pair.updatedAt}, true
+	}
+	if pair, ok := pairs[[2]string{to, from}]; ok {
+		return repository.Leg{From: from, To: to, Rate: 1 / pair.rate, Direct: true, AsOf: pair.updatedAt}, true
+	}
+	return repository.Leg{}, false
+}
+
+func referenceLeg(reference *repository.ReferenceRates, from string, to string) repository.Leg {
+	return repository.Leg{From: from, To: to, Rate: reference.Rates[to] / reference.Rates[from], AsOf: reference.AsOf}
 }
@@ -2,7 +2,9 @@ package postgres_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"gw-exchanger/internal/repository"
 	"gw-exchanger/internal/repository/postgres"
 	"log"
 	"maps"
@@ -126,3 +128,124 @@ func TestExchange(t *testing.T) {
 	}
 
 }
+
+func TestQuote(t *testing.T) {
+	repo, err := postgres.NewPostgresRepo(connStr)
+	if err != nil {
+		t.Fatalf("Couldn't connect to db.")
+	}
+
+	quote, err := repo.Quote("RUB", "EUR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if quote.Direct || len(quote.Legs) != 2 {
+		t.Fatalf("expected a derived quote through USD, got %+v\n", quote)
+	}
+	if quote.Rate != 0.011030658025922234 {
+		t.Fatalf("expected %v, got %v\n", 0.011030658025922234, quote.Rate)
+	}
+	if time.Since(quote.AsOf) > time.Minute {
+		t.Fatalf("expected a fresh as of time, got %v\n", quote.AsOf)
+	}
+
+	_, err = db.Exec(context.Background(), "insert into pair_rates (from_currency, to_currency, rate) values ('EUR', 'RUB', 95)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Exec(context.Background(), "delete from pair_rates")
+
+	quote, err = repo.Quote("RUB", "EUR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !quote.Direct || len(quote.Legs) != 1 {
+		t.Fatalf("expected a direct quote, got %+v\n", quote)
+	}
+	if quote.Rate != 1.0/95 {
+		t.Fatalf("expected %v, got %v\n", 1.0/95, quote.Rate)
+	}
+}
+
+func TestAdminRates(t *testing.T) {
+	repo, err := postgres.NewPostgresRepo(connStr)
+	if err != nil {
+		t.Fatalf("Couldn't connect to db.")
+	}
+	defer db.Exec(context.Background(), "delete from pair_rates")
+
+	_, err = repo.SetRate(&repository.RateChange{From: "EUR", To: "RUB", Rate: 95, Actor: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	quote, err := repo.Quote("EUR", "RUB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !quote.Direct || quote.Rate != 95 {
+		t.Fatalf("expected direct rate 95, got %+v\n", quote)
+	}
+
+	_, err = repo.HaltPair(&repository.RateChange{From: "EUR", To: "RUB", Actor: "bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.Quote("RUB", "EUR")
+	if !errors.Is(err, repository.ErrPairHalted) {
+		t.Fatalf("expected %v, got %v\n", repository.ErrPairHalted, err)
+	}
+	_, err = repo.ResumePair(&repository.RateChange{From: "RUB", To: "EUR", Actor: "bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a halted leg stops the cross rates that go through it
+	_, err = repo.HaltPair(&repository.RateChange{From: "USD", To: "RUB", Actor: "bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.Quote("EUR", "RUB")
+	if err != nil {
+		t.Fatalf("expected the direct quote to pass, got %v\n", err)
+	}
+	_, err = repo.Quote("RUB", "EUR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(context.Background(), "delete from pair_rates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.Quote("EUR", "RUB")
+	if !errors.Is(err, repository.ErrPairHalted) {
+		t.Fatalf("expected %v, got %v\n", repository.ErrPairHalted, err)
+	}
+	_, err = repo.ResumePair(&repository.RateChange{From: "USD", To: "RUB", Actor: "bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = repo.ScheduleRate(&repository.RateChange{From: "EUR", To: "RUB", Rate: 97, EffectiveAt: time.Now().Add(-time.Second), Actor: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	applied, err := repo.ApplyScheduledRates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if applied != 1 {
+		t.Fatalf("expected 1 applied rate, got %v\n", applied)
+	}
+
+	changes, err := repo.ListRateChanges("", "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	actions := ""
+	for _, change := range changes {
+		actions += change.Action + ":" + change.Actor + " "
+	}
+	if actions != "schedule:alice resume:bob halt:bob resume:bob halt:bob set:alice " {
+		t.Fatalf("unexpected history: %v\n", actions)
+	}
+}
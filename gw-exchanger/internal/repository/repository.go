@@ -1,6 +1,70 @@
 package repository
 
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrPairHalted    = errors.New("trading is halted for this pair")
+	ErrPairNotHalted = errors.New("trading is not halted for this pair")
+)
+
 type ExchangeRepo interface {
 	GetRates() (map[string]float64, error)
+	GetReferenceRates() (*ReferenceRates, error)
 	Exchange(string, string) (float64, error)
+	Quote(string, string) (*Quote, error)
+}
+
+type AdminRepo interface {
+	SetRate(change *RateChange) (*RateChange, error)
+	ScheduleRate(change *RateChange) (*RateChange, error)
+	HaltPair(change *RateChange) (*RateChange, error)
+	ResumePair(change *RateChange) (*RateChange, error)
+	ListRateChanges(from string, to string, limit int) ([]RateChange, error)
+	ApplyScheduledRates() (int, error)
+}
+
+// ReferenceRates are the rates of every currency against the base of the
+// rates row, as of the last update of that row.
+type ReferenceRates struct {
+	Rates map[string]float64
+	AsOf  time.Time
+}
+
+// Quote is a conversion rate together with the way it was obtained. AsOf is
+// the time of the oldest leg.
+type Quote struct {
+	From   string
+	To     string
+	Rate   float64
+	Direct bool
+	Legs   []Leg
+	AsOf   time.Time
+}
+
+// Leg is a single step of a quote. Direct legs come from an explicit pair
+// quote, the rest are derived from the reference rates.
+type Leg struct {
+	From   string
+	To     string
+	Rate   float64
+	Direct bool
+	AsOf   time.Time
+}
+
+// RateChange is an entry of the rate history. Scheduled changes stay
+// pending until AppliedAt is set.
+type RateChange struct {
+	Id          int64
+	From        string
+	To          string
+	Action      string
+	Rate        float64
+	EffectiveAt time.Time
+	AppliedAt   *time.Time
+	Actor       string
+	Reason      string
+	CreatedAt   time.Time
 }
@@ -0,0 +1,139 @@
+// Package events is the contract between the wallet, which publishes an event
+// for every large operation, and the broker, which stores them.
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// CurrentVersion is the schema version publishers write.
+const CurrentVersion = 3
+
+type Type string
+
+const (
+	TypeDeposit  Type = "deposit"
+	TypeWithdraw Type = "withdraw"
+	TypeExchange Type = "exchange"
+)
+
+var (
+	ErrUnknownVersion = errors.New("unknown event schema version")
+	ErrInvalidEvent   = errors.New("invalid event")
+)
+
+// Event is an operation on a wallet. TargetCurrency is only set for
+// exchanges, where Amount is in Currency. UserId is the id the wallet gives
+// the user; usernames are not part of events.
+type Event struct {
+	SchemaVersion  int       `json:"schema_version"`
+	Id             string    `json:"id"`
+	Type           Type      `json:"type"`
+	UserId         string    `json:"user_id"`
+	Amount         float64   `json:"amount"`
+	Currency       string    `json:"currency"`
+	TargetCurrency string    `json:"target_currency,omitempty"`
+	OccurredAt     time.Time `json:"occurred_at"`
+}
+
+// RoutingKey is the topic key the event is published under.
+func (event *Event) RoutingKey() string {
+	return "wallet.event." + string(event.Type)
+}
+
+// Validate checks a current version event.
+func (event *Event) Validate() error {
+	if event.SchemaVersion != CurrentVersion {
+		return fmt.Errorf("%w: %d", ErrUnknownVersion, event.SchemaVersion)
+	}
+	if err := validateCommon(event.Id, event.UserId, event.Type, event.Amount); err != nil {
+		return err
+	}
+	if !isCurrency(event.Currency) {
+		return fmt.Errorf("%w: bad currency %q", ErrInvalidEvent, event.Currency)
+	}
+	if event.Type == TypeExchange {
+		if !isCurrency(event.TargetCurrency) || event.TargetCurrency == event.Currency {
+			return fmt.Errorf("%w: bad target currency %q", ErrInvalidEvent, event.TargetCurrency)
+		}
+	} else if event.TargetCurrency != "" {
+		return fmt.Errorf("%w: target currency on a %s", ErrInvalidEvent, event.Type)
+	}
+	if event.OccurredAt.IsZero() {
+		return fmt.Errorf("%w: no occurred_at", ErrInvalidEvent)
+	}
+	return nil
+}
+
+// Encode validates the event and marshals it.
+func Encode(event *Event) ([]byte, error) {
+	if err := event.Validate(); err != nil {
+		return nil, err
+	}
+	return json.Marshal(event)
+}
+
+// Decode reads an event of any known version, upgrading older ones to the
+// current schema. Errors wrap ErrUnknownVersion or ErrInvalidEvent.
+func Decode(body []byte) (*Event, error) {
+	var header struct {
+		SchemaVersion *int `json:"schema_version"`
+	}
+	if err := json.Unmarshal(body, &header); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidEvent, err)
+	}
+
+	// version 1 predates the schema_version field
+	if header.SchemaVersion == nil {
+		return decodeV1(body)
+	}
+	if *header.SchemaVersion == 2 {
+		return decodeV2(body)
+	}
+	if *header.SchemaVersion != CurrentVersion {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownVersion, *header.SchemaVersion)
+	}
+
+	var event Event
+	if err := json.Unmarshal(body, &event); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidEvent, err)
+	}
+	if err := event.Validate(); err != nil {
+		return nil, err
+	}
+	event.OccurredAt = event.OccurredAt.UTC()
+	return &event, nil
+}
+
+func validateCommon(id string, userId string, eventType Type, amount float64) error {
+	if id == "" {
+		return fmt.Errorf("%w: no id", ErrInvalidEvent)
+	}
+	if userId == "" {
+		return fmt.Errorf("%w: no user", ErrInvalidEvent)
+	}
+	switch eventType {
+	case TypeDeposit, TypeWithdraw, TypeExchange:
+	default:
+		return fmt.Errorf("%w: unknown type %q", ErrInvalidEvent, eventType)
+	}
+	if amount <= 0 {
+		return fmt.Errorf("%w: amount must be positive", ErrInvalidEvent)
+	}
+	return nil
+}
+
+func isCurrency(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, c := range code {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
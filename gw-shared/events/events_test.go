@@ -0,0 +1,139 @@
+package events_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lynxbites/wallet-services/gw-shared/events"
+)
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		err  error
+	}{
+		{"current", `{"schema_version":3,"id":"1","type":"deposit","user_id":"0b7c6e0e-3f4c-4a8e-9d55-7d3e2f1c9a10","amount":50000,"currency":"USD","occurred_at":"2025-03-01T12:00:00Z"}`, nil},
+		{"v2", `{"schema_version":2,"id":"1","type":"deposit","user":"user","amount":50000,"currency":"USD","occurred_at":"2025-03-01T12:00:00Z"}`, nil},
+		{"exchange", `{"schema_version":2,"id":"1","type":"exchange","user":"user","amount":50000,"currency":"USD","target_currency":"EUR","occurred_at":"2025-03-01T12:00:00Z"}`, nil},
+		// version 1 has no currency
+		{"v1", `{"Id":"1","User":"user","OperationType":"withdraw","Amount":50000,"Timestamp":"2025-03-01 12:00:00.5 +0000 UTC"}`, events.ErrInvalidEvent},
+		{"unknown version", `{"schema_version":4,"id":"1"}`, events.ErrUnknownVersion},
+		{"no user id", `{"schema_version":3,"id":"1","type":"deposit","user":"user","amount":50000,"currency":"USD","occurred_at":"2025-03-01T12:00:00Z"}`, events.ErrInvalidEvent},
+		{"no currency", `{"schema_version":2,"id":"1","type":"deposit","user":"user","amount":50000,"occurred_at":"2025-03-01T12:00:00Z"}`, events.ErrInvalidEvent},
+		{"exchange without target", `{"schema_version":2,"id":"1","type":"exchange","user":"user","amount":50000,"currency":"USD","occurred_at":"2025-03-01T12:00:00Z"}`, events.ErrInvalidEvent},
+		{"v1 unknown type", `{"Id":"1","User":"user","OperationType":"gift","Amount":50000}`, events.ErrInvalidEvent},
+		{"not json", `not json`, events.ErrInvalidEvent},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			event, err := events.Decode([]byte(test.body))
+			if !errors.Is(err, test.err) {
+				t.Fatalf("expected %v, got %v\n", test.err, err)
+			}
+			if err == nil && event.SchemaVersion != events.CurrentVersion {
+				t.Fatalf("expected version %v, got %v\n", events.CurrentVersion, event.SchemaVersion)
+			}
+		})
+	}
+}
+
+func TestDecodeV1Reasons(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		reason string
+	}{
+		{"no timestamp", `{"Id":"1","User":"user","OperationType":"deposit","Amount":50000}`, "unreadable Timestamp"},
+		{"bad timestamp", `{"Id":"1","User":"user","OperationType":"deposit","Amount":50000,"Timestamp":"yesterday"}`, "unreadable Timestamp"},
+		{"no currency", `{"Id":"1","User":"user","OperationType":"deposit","Amount":50000,"Timestamp":"2025-03-01 12:00:00.5 +0000 UTC"}`, "bad currency"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := events.Decode([]byte(test.body))
+			if !errors.Is(err, events.ErrInvalidEvent) || !strings.Contains(err.Error(), test.reason) {
+				t.Fatalf("expected %v: %v, got %v\n", events.ErrInvalidEvent, test.reason, err)
+			}
+		})
+	}
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	event := &events.Event{
+		SchemaVersion: events.CurrentVersion,
+		Id:            "1",
+		Type:          events.TypeWithdraw,
+		UserId:        "0b7c6e0e-3f4c-4a8e-9d55-7d3e2f1c9a10",
+		Amount:        50000,
+		Currency:      "RUB",
+		OccurredAt:    time.Now().UTC(),
+	}
+	body, err := events.Encode(event)
+	if err != nil {
+		t.Fatalf("expected no error, got %v\n", err)
+	}
+	decoded, err := events.Decode(body)
+	if err != nil {
+		t.Fatalf("expected no error, got %v\n", err)
+	}
+	if *decoded != *event {
+		t.Fatalf("expected %+v, got %+v\n", event, decoded)
+	}
+}
+
+func TestDecodeV2User(t *testing.T) {
+	event, err := events.Decode([]byte(`{"schema_version":2,"id":"1","type":"deposit","user":"user","amount":50000,"currency":"USD","occurred_at":"2025-03-01T12:00:00Z"}`))
+	if err != nil {
+		t.Fatalf("expected no error, got %v\n", err)
+	}
+	if event.UserId != "user" {
+		t.Fatalf("expected %v, got %v\n", "user", event.UserId)
+	}
+}
+
+func TestEncodeSecurity(t *testing.T) {
+	event := &events.SecurityEvent{SchemaVersion: events.CurrentVersion, Id: "1", Type: events.SecurityLoginLocked, IP: "10.0.0.1", OccurredAt: time.Now()}
+	if _, err := events.EncodeSecurity(event); err != nil {
+		t.Fatalf("expected %v, got %v\n", nil, err)
+	}
+	if key := event.RoutingKey(); key != "security.login_locked" {
+		t.Fatalf("expected %v, got %v\n", "security.login_locked", key)
+	}
+	body, _ := events.EncodeSecurity(event)
+	decoded, err := events.DecodeSecurity(body)
+	if err != nil || decoded.Id != event.Id || decoded.Type != event.Type || decoded.IP != event.IP {
+		t.Fatalf("expected %+v, got %+v, %v\n", event, decoded, err)
+	}
+
+	event.IP = ""
+	if _, err := events.EncodeSecurity(event); !errors.Is(err, events.ErrInvalidEvent) {
+		t.Fatalf("expected %v, got %v\n", events.ErrInvalidEvent, err)
+	}
+	if _, err := events.DecodeSecurity([]byte(`{"schema_version":3,"id":"1","type":"new_device"}`)); !errors.Is(err, events.ErrInvalidEvent) {
+		t.Fatalf("expected %v, got %v\n", events.ErrInvalidEvent, err)
+	}
+}
+
+func TestUserIdMappings(t *testing.T) {
+	var exported bytes.Buffer
+	for _, mapping := range []events.UserIdMapping{{Id: "0b7c6e0e-1", Username: "alice"}, {Id: "0b7c6e0e-2", Username: "bob"}} {
+		if err := events.WriteUserIdMapping(&exported, &mapping); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ids, err := events.ReadUserIdMappings(&exported)
+	if err != nil {
+		t.Fatalf("expected %v, got %v\n", nil, err)
+	}
+	if len(ids) != 2 || ids["alice"] != "0b7c6e0e-1" || ids["bob"] != "0b7c6e0e-2" {
+		t.Fatalf("expected both users, got %v\n", ids)
+	}
+
+	if _, err := events.ReadUserIdMappings(strings.NewReader("{\"id\": \"0b7c6e0e-1\", \"username\": \"alice\"}\n{\"id\": \"0b7c")); err == nil {
+		t.Fatalf("expected an error for a truncated export, got %v\n", err)
+	}
+}
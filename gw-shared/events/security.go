@@ -0,0 +1,68 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+type SecurityType string
+
+const (
+	// SecurityLoginLocked is sent when failed logins lock a username or an
+	// address. UserId is empty when an address, or a username nobody has, is
+	// locked; Details["scope"] tells which.
+	SecurityLoginLocked SecurityType = "login_locked"
+	// SecurityNewDevice is sent when a user logs in with a user agent they
+	// have not used before.
+	SecurityNewDevice SecurityType = "new_device"
+)
+
+// SecurityEvent is something about an account the owner or the operators
+// should know of. It is published apart from operations, under
+// security.<type>.
+type SecurityEvent struct {
+	SchemaVersion int               `json:"schema_version"`
+	Id            string            `json:"id"`
+	Type          SecurityType      `json:"type"`
+	UserId        string            `json:"user_id,omitempty"`
+	IP            string            `json:"ip,omitempty"`
+	Details       map[string]string `json:"details,omitempty"`
+	OccurredAt    time.Time         `json:"occurred_at"`
+}
+
+func (event *SecurityEvent) RoutingKey() string {
+	return "security." + string(event.Type)
+}
+
+func (event *SecurityEvent) Validate() error {
+	if event.SchemaVersion != CurrentVersion {
+		return fmt.Errorf("%w: %d", ErrUnknownVersion, event.SchemaVersion)
+	}
+	if event.Id == "" || event.Type == "" || event.OccurredAt.IsZero() {
+		return fmt.Errorf("%w: security event needs id, type and occurred_at", ErrInvalidEvent)
+	}
+	if event.UserId == "" && event.IP == "" {
+		return fmt.Errorf("%w: security event needs a user or an ip", ErrInvalidEvent)
+	}
+	return nil
+}
+
+func EncodeSecurity(event *SecurityEvent) ([]byte, error) {
+	if err := event.Validate(); err != nil {
+		return nil, err
+	}
+	return json.Marshal(event)
+}
+
+// DecodeSecurity reads a security event and validates it.
+func DecodeSecurity(body []byte) (*SecurityEvent, error) {
+	var event SecurityEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidEvent, err)
+	}
+	if err := event.Validate(); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
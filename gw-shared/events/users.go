@@ -0,0 +1,49 @@
+package events
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// UserIdMapping is one line of the map the wallet exports with
+// "app users export": the id events name the user by since version 3 and
+// the username version 2 events carried. The broker reads it to move data
+// stored under usernames to ids.
+type UserIdMapping struct {
+	Id       string `json:"id"`
+	Username string `json:"username"`
+}
+
+// WriteUserIdMapping writes one mapping as a line of JSON.
+func WriteUserIdMapping(w io.Writer, mapping *UserIdMapping) error {
+	line, err := json.Marshal(mapping)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(line, '\n'))
+	return err
+}
+
+// ReadUserIdMappings reads the exported lines into a username to id map.
+// Blank lines are skipped; anything else that is not a complete mapping is
+// an error, so a truncated export is not applied halfway.
+func ReadUserIdMappings(r io.Reader) (map[string]string, error) {
+	ids := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var mapping UserIdMapping
+		if err := json.Unmarshal(scanner.Bytes(), &mapping); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if mapping.Id == "" || mapping.Username == "" {
+			return nil, fmt.Errorf("line %d: id and username are required", line)
+		}
+		ids[mapping.Username] = mapping.Id
+	}
+	return ids, scanner.Err()
+}
@@ -0,0 +1,53 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// v1Timestamp is the layout of time.Time.String(), which is what version 1
+// publishers put into Timestamp.
+const v1Timestamp = "2006-01-02 15:04:05.999999999 -0700 MST"
+
+// eventV1 is the original wallet message: Go field names, no currency and
+// the time as a string.
+type eventV1 struct {
+	Id            string
+	User          string
+	OperationType string
+	Amount        float64
+	Timestamp     string
+}
+
+// decodeV1 reads a version 1 message and checks it like a current one. Like
+// version 2, it named the user by username, which ends up in UserId. Nothing
+// is made up for what it lacks: a missing or unreadable Timestamp is an
+// error, and so is the currency, which was not recorded then, so version 1
+// messages are dead lettered with the reason.
+func decodeV1(body []byte) (*Event, error) {
+	var old eventV1
+	if err := json.Unmarshal(body, &old); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidEvent, err)
+	}
+	if err := validateCommon(old.Id, old.User, Type(old.OperationType), old.Amount); err != nil {
+		return nil, err
+	}
+
+	occurredAt, err := time.Parse(v1Timestamp, old.Timestamp)
+	if err != nil {
+		return nil, fmt.Errorf("%w: unreadable Timestamp %q", ErrInvalidEvent, old.Timestamp)
+	}
+	event := &Event{
+		SchemaVersion: CurrentVersion,
+		Id:            old.Id,
+		Type:          Type(old.OperationType),
+		UserId:        old.User,
+		Amount:        old.Amount,
+		OccurredAt:    occurredAt.UTC(),
+	}
+	if err := event.Validate(); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
@@ -0,0 +1,30 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// eventV2 is the current event with the user named by username.
+type eventV2 struct {
+	Event
+	User string `json:"user"`
+}
+
+// decodeV2 upgrades a version 2 message. The wallet cannot be asked for the
+// id from here, so the username is kept in its place until the broker moves
+// it to the id with the map from ReadUserIdMappings.
+func decodeV2(body []byte) (*Event, error) {
+	var old eventV2
+	if err := json.Unmarshal(body, &old); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidEvent, err)
+	}
+	event := old.Event
+	event.SchemaVersion = CurrentVersion
+	event.UserId = old.User
+	if err := event.Validate(); err != nil {
+		return nil, err
+	}
+	event.OccurredAt = event.OccurredAt.UTC()
+	return &event, nil
+}
@@ -0,0 +1,15 @@
+module github.com/lynxbites/wallet-services/gw-shared
+
+go 1.23.2
+
+require (
+	github.com/golang-migrate/migrate/v4 v4.18.3
+	github.com/rabbitmq/amqp091-go v1.10.0
+)
+
+require (
+	github.com/hashicorp/errwrap v1.1.0 // indirect
+	github.com/hashicorp/go-multierror v1.1.1 // indirect
+	github.com/lib/pq v1.10.9 // indirect
+	go.uber.org/atomic v1.7.0 // indirect
+)
@@ -0,0 +1,132 @@
+// Package migrate runs the versioned SQL migrations a service embeds, both
+// at startup and from its "migrate" subcommand. golang-migrate holds a
+// postgres advisory lock while it migrates, so replicas starting at the same
+// time apply the migrations one after another.
+package migrate
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"strconv"
+
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+)
+
+const usage = "usage: app migrate up|down [steps]|status"
+
+type Status struct {
+	Version uint
+	Dirty   bool
+	Applied []uint
+	Pending []uint
+}
+
+// New opens the migrations in files, named N_name.up.sql and
+// N_name.down.sql, against the database.
+func New(files fs.FS, connStr string) (*migrate.Migrate, error) {
+	src, err := iofs.New(files, ".")
+	if err != nil {
+		return nil, err
+	}
+	return migrate.NewWithSourceInstance("iofs", src, connStr)
+}
+
+func Up(files fs.FS, connStr string) error {
+	m, err := New(files, connStr)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+	if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return err
+	}
+	return nil
+}
+
+// Down rolls back the given number of migrations.
+func Down(files fs.FS, connStr string, steps int) error {
+	m, err := New(files, connStr)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+	if err := m.Steps(-steps); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return err
+	}
+	return nil
+}
+
+func GetStatus(files fs.FS, connStr string) (*Status, error) {
+	m, err := New(files, connStr)
+	if err != nil {
+		return nil, err
+	}
+	defer m.Close()
+
+	status := new(Status)
+	status.Version, status.Dirty, err = m.Version()
+	if err != nil && !errors.Is(err, migrate.ErrNilVersion) {
+		return nil, err
+	}
+
+	src, err := iofs.New(files, ".")
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	version, err := src.First()
+	for err == nil {
+		if version <= status.Version {
+			status.Applied = append(status.Applied, version)
+		} else {
+			status.Pending = append(status.Pending, version)
+		}
+		version, err = src.Next(version)
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	return status, nil
+}
+
+// Command handles the "migrate" subcommand, args are the arguments after
+// it. It prints the status once it is done.
+func Command(files fs.FS, connStr string, args []string) error {
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+
+	switch args[0] {
+	case "up":
+		if err := Up(files, connStr); err != nil {
+			return err
+		}
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			var err error
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps <= 0 {
+				return errors.New(usage)
+			}
+		}
+		if err := Down(files, connStr, steps); err != nil {
+			return err
+		}
+	case "status":
+	default:
+		return errors.New(usage)
+	}
+
+	status, err := GetStatus(files, connStr)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("version: %v, dirty: %v\n", status.Version, status.Dirty)
+	fmt.Printf("applied: %v\n", status.Applied)
+	fmt.Printf("pending: %v\n", status.Pending)
+	return nil
+}
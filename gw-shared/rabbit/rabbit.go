@@ -0,0 +1,224 @@
+// Package rabbit keeps an AMQP connection open for as long as the service
+// runs, redialing with exponential backoff whenever it is lost.
+package rabbit
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	minBackoff = 500 * time.Millisecond
+	maxBackoff = 30 * time.Second
+	// closedPoll is how long Channel waits for a channel that has closed
+	// but not yet been noticed by the reconnect loop.
+	closedPoll = 100 * time.Millisecond
+)
+
+var (
+	ErrNotConnected = errors.New("rabbitmq: not connected")
+	ErrClosed       = errors.New("rabbitmq: client closed")
+	ErrNacked       = errors.New("rabbitmq: publish not confirmed")
+)
+
+// SetupFunc declares exchanges, queues and bindings. It runs on every new
+// connection, so it must be safe to repeat.
+type SetupFunc func(ch *amqp.Channel) error
+
+// Client owns one connection and one channel, which is in confirm mode. Its
+// methods are safe for concurrent use.
+type Client struct {
+	url    string
+	setup  SetupFunc
+	logger *slog.Logger
+
+	mu      sync.Mutex
+	channel *amqp.Channel
+	// ready is closed once channel is set, and replaced when it is lost.
+	ready  chan struct{}
+	closed bool
+	done   chan struct{}
+}
+
+// NewClient starts connecting in the background and returns at once.
+func NewClient(url string, setup SetupFunc, logger *slog.Logger) *Client {
+	client := &Client{
+		url:    url,
+		setup:  setup,
+		logger: logger,
+		ready:  make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go client.run()
+	return client
+}
+
+// Channel returns the current channel, waiting for a connection if there is
+// none. The channel can close at any time; callers that hold on to it should
+// come back for a new one when it does.
+func (client *Client) Channel(ctx context.Context) (*amqp.Channel, error) {
+	for {
+		client.mu.Lock()
+		ch, ready, closed := client.channel, client.ready, client.closed
+		client.mu.Unlock()
+		if closed {
+			return nil, ErrClosed
+		}
+
+		wait := ready
+		if ch != nil {
+			if !ch.IsClosed() {
+				return ch, nil
+			}
+			wait = nil
+		}
+		select {
+		case <-wait:
+		case <-time.After(closedPoll):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-client.done:
+			return nil, ErrClosed
+		}
+	}
+}
+
+// Publish publishes on the current channel. It does not wait for a
+// connection and returns ErrNotConnected while there is none.
+func (client *Client) Publish(ctx context.Context, exchange string, key string, msg amqp.Publishing) error {
+	client.mu.Lock()
+	ch, closed := client.channel, client.closed
+	client.mu.Unlock()
+	if closed {
+		return ErrClosed
+	}
+	if ch == nil || ch.IsClosed() {
+		return ErrNotConnected
+	}
+	return ch.PublishWithContext(ctx, exchange, key, false, false, msg)
+}
+
+// PublishConfirmed publishes like Publish and then waits until the server
+// has taken the message. A nack, or a channel lost before the confirm
+// arrives, returns ErrNacked.
+func (client *Client) PublishConfirmed(ctx context.Context, exchange string, key string, msg amqp.Publishing) error {
+	client.mu.Lock()
+	ch, closed := client.channel, client.closed
+	client.mu.Unlock()
+	if closed {
+		return ErrClosed
+	}
+	if ch == nil || ch.IsClosed() {
+		return ErrNotConnected
+	}
+	confirm, err := ch.PublishWithDeferredConfirmWithContext(ctx, exchange, key, false, false, msg)
+	if err != nil {
+		return err
+	}
+	acked, err := confirm.WaitContext(ctx)
+	if err != nil {
+		return err
+	}
+	if !acked {
+		return ErrNacked
+	}
+	return nil
+}
+
+// Close stops reconnecting and closes the connection.
+func (client *Client) Close() {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	if !client.closed {
+		client.closed = true
+		close(client.done)
+	}
+}
+
+func (client *Client) run() {
+	for attempt := 0; ; {
+		conn, ch, err := client.connect()
+		if err != nil {
+			delay := backoff(attempt)
+			attempt++
+			client.logger.Warn("rabbitmq: couldn't connect, retrying", "error", err.Error(), "attempt", attempt, "delay", delay.String())
+			select {
+			case <-time.After(delay):
+				continue
+			case <-client.done:
+				return
+			}
+		}
+		attempt = 0
+
+		connClosed := conn.NotifyClose(make(chan *amqp.Error, 1))
+		chClosed := ch.NotifyClose(make(chan *amqp.Error, 1))
+		client.mu.Lock()
+		client.channel = ch
+		close(client.ready)
+		client.mu.Unlock()
+		client.logger.Info("rabbitmq: connected")
+
+		var reason *amqp.Error
+		stop := false
+		select {
+		case reason = <-connClosed:
+		case reason = <-chClosed:
+		case <-client.done:
+			stop = true
+		}
+
+		client.mu.Lock()
+		client.channel = nil
+		client.ready = make(chan struct{})
+		client.mu.Unlock()
+		conn.Close()
+		if stop {
+			return
+		}
+		if reason != nil {
+			client.logger.Warn("rabbitmq: connection lost, reconnecting", "error", reason.Error())
+		} else {
+			client.logger.Warn("rabbitmq: connection closed, reconnecting")
+		}
+	}
+}
+
+func (client *Client) connect() (*amqp.Connection, *amqp.Channel, error) {
+	conn, err := amqp.Dial(client.url)
+	if err != nil {
+		return nil, nil, err
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	if err := ch.Confirm(false); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	if client.setup != nil {
+		if err := client.setup(ch); err != nil {
+			conn.Close()
+			return nil, nil, err
+		}
+	}
+	return conn, ch, nil
+}
+
+// backoff doubles from minBackoff up to maxBackoff, with the upper half
+// jittered so that restarted services do not redial in step.
+func backoff(attempt int) time.Duration {
+	delay := maxBackoff
+	if attempt < 16 {
+		delay = min(minBackoff<<attempt, maxBackoff)
+	}
+	return delay/2 + rand.N(delay/2+1)
+}
@@ -0,0 +1,11 @@
+package proto_grpc
+
+// Reasons carried in errdetails.ErrorInfo of ExchangeService errors, so
+// clients can tell them apart from transport failures with the same code.
+const (
+	// ReasonRateStale is returned with codes.Unavailable when the rate is
+	// older than the exchanger's maximum age.
+	ReasonRateStale = "RATE_STALE"
+
+	ErrorDomain = "gw-exchanger"
+)